@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
@@ -10,44 +11,17 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
-)
-
 
-//掉头pngquant做颜色量化
-func Quantize(rawPng []byte, nColors int) ([]byte, error) {
-	exePath, err := exec.LookPath("pngquant")
-	
-	if err != nil {
-		executablePath, _ := os.Executable()
-		exeDir := filepath.Dir(executablePath)
-		localPngquant := filepath.Join(exeDir, "pngquant.exe")
-		
-		if _, statErr := os.Stat(localPngquant); statErr == nil {
-			exePath = localPngquant
-		} else {
-			return nil, fmt.Errorf("pngquant not found in PATH or alongside executable")
-		}
-	}
+	"palquant"
+)
 
-	cmd := exec.Command(exePath, "--force", "--speed", "1", fmt.Sprintf("%d", nColors), "-")
-	cmd.Stdin = bytes.NewReader(rawPng)
-	var outBuf bytes.Buffer
-	var errBuf bytes.Buffer
-	cmd.Stdout = &outBuf
-	cmd.Stderr = &errBuf
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("pngquant failed: %v (Stderr: %s)", err, errBuf.String())
-	}
-	
-	if outBuf.Len() == 0 {
-		return nil, fmt.Errorf("pngquant produced empty output")
-	}
-	return outBuf.Bytes(), nil
+//颜色量化 (默认Floyd–Steinberg抖动, 与原pngquant默认一致)
+func Quantize(rawPng []byte, nColors int, dither palquant.Dither) ([]byte, error) {
+	return palquant.QuantizePNG(rawPng, palquant.Options{Colors: nColors, Dither: dither})
 }
 
 func u16(b []byte) uint16 {
@@ -173,7 +147,8 @@ func Export(path string) {
 	fmt.Printf("Done. Total exported: %d\n", count)
 }
 
-func patchImage(binData []byte, fpath string) error {
+//heatDir非空时沿用原调色板，偏离调色板的像素热图写到heatDir
+func patchImage(binData []byte, fpath string, dither palquant.Dither, heatDir string) error {
 	base := filepath.Base(fpath)
 	parts := strings.Split(strings.TrimSuffix(base, ".png"), "_")
 	
@@ -197,13 +172,30 @@ func patchImage(binData []byte, fpath string) error {
 	rawPng, err := ioutil.ReadFile(fpath)
 	if err != nil { return fmt.Errorf("read file error: %v", err) }
 
-	//量化
-	qPngData, err := Quantize(rawPng, 16)
-	if err != nil { return fmt.Errorf("quantize error: %v", err) }
+	keepPalette := heatDir != ""
+	var img image.Image
+	var report palquant.OffPalette
+	if keepPalette {
+		//沿用原调色板
+		if int(offset)+48 > len(binData) {
+			return fmt.Errorf("offset out of range reading palette")
+		}
+		palette := make(color.Palette, 16)
+		for i := range palette {
+			palette[i] = ps1ToColor(u16(binData[int(offset)+16+i*2:]))
+		}
+		src, _, err := image.Decode(bytes.NewReader(rawPng))
+		if err != nil { return fmt.Errorf("decode error: %v", err) }
+		img, report = palquant.KeepPalette(src, palette)
+	} else {
+		//量化
+		qPngData, err := Quantize(rawPng, 16, dither)
+		if err != nil { return fmt.Errorf("quantize error: %v", err) }
 
-	//解码
-	img, _, err := image.Decode(bytes.NewReader(qPngData))
-	if err != nil { return fmt.Errorf("decode error: %v", err) }
+		//解码
+		img, _, err = image.Decode(bytes.NewReader(qPngData))
+		if err != nil { return fmt.Errorf("decode error: %v", err) }
+	}
 
 	//尺寸校验
 	bounds := img.Bounds()
@@ -223,7 +215,7 @@ func patchImage(binData []byte, fpath string) error {
 		return fmt.Errorf("offset out of range writing palette")
 	}
 
-	for i := 0; i < 16; i++ {
+	for i := 0; i < 16 && !keepPalette; i++ {
 		var c color.Color
 		if i < len(palettedImg.Palette) {
 			c = palettedImg.Palette[i]
@@ -265,10 +257,21 @@ func patchImage(binData []byte, fpath string) error {
 	}
 	
 	fmt.Println("OK")
+	if keepPalette {
+		fmt.Println("  Keep palette:", report)
+		if report.Pixels > 0 {
+			os.MkdirAll(heatDir, 0755)
+			heatPath := palquant.HeatmapPath(filepath.Join(heatDir, base))
+			if err := report.WriteHeatmap(heatPath); err != nil {
+				return fmt.Errorf("heatmap error: %v", err)
+			}
+			fmt.Println("  Heatmap saved:", heatPath)
+		}
+	}
 	return nil
 }
 
-func Import(targetPath string, singlePngPath string) {
+func Import(targetPath string, singlePngPath string, dither palquant.Dither, keepPalette bool) {
 	//读取目标
 	fmt.Printf("Loading target file: %s ... ", targetPath)
 	binData, err := ioutil.ReadFile(targetPath)
@@ -296,8 +299,12 @@ func Import(targetPath string, singlePngPath string) {
 	successCount := 0
 	errorCount := 0
 
+	heatDir := ""
+	if keepPalette {
+		heatDir = targetPath + "_offpal"
+	}
 	for _, fpath := range files {
-		err := patchImage(binData, fpath)
+		err := patchImage(binData, fpath, dither, heatDir)
 		if err != nil {
 			fmt.Printf("FAILED: %s\nReason: %v\n", filepath.Base(fpath), err)
 			errorCount++
@@ -321,24 +328,33 @@ func Import(targetPath string, singlePngPath string) {
 }
 
 func main() {
-	if len(os.Args) < 3 {
+	ditherFlag := flag.String("dither", "fs", "dithering: none, fs, ordered / 抖动方式")
+	keepFlag := flag.Bool("keep-palette", false, "keep the original palette, write off-palette heatmaps to <T_FILE>_offpal / 沿用原调色板")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 {
 		fmt.Println("Usage:")
 		fmt.Println("  tool export <T_FILE>")
-		fmt.Println("  tool import <T_FILE> [Optional: SinglePngPath]")
+		fmt.Println("  tool [-dither fs|ordered|none] [-keep-palette] import <T_FILE> [Optional: SinglePngPath]")
 		return
 	}
 
-	mode := os.Args[1]
-	file := os.Args[2]
+	mode := args[0]
+	file := args[1]
 
 	if mode == "export" {
 		Export(file)
 	} else if mode == "import" {
 		singlePng := ""
-		if len(os.Args) >= 4 {
-			singlePng = os.Args[3]
+		if len(args) >= 3 {
+			singlePng = args[2]
+		}
+		dither, err := palquant.ParseDither(*ditherFlag)
+		if err != nil {
+			log.Fatal(err)
 		}
-		Import(file, singlePng)
+		Import(file, singlePng, dither, *keepFlag)
 	} else {
 		fmt.Println("Unknown mode")
 	}
@@ -0,0 +1,7 @@
+module RTIM_TOOL
+
+go 1.22.2
+
+require palquant v0.0.0
+
+replace palquant => ../../../palquant
@@ -10,11 +10,11 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"palquant"
 	"timtool/psxtim"
 )
 
@@ -26,13 +26,15 @@ const (
 
 func main() {
 	checksumFlag := flag.Bool("checksum", false, "Enable dynamic KF2 checksum calculation / 打开文件校验")
+	ditherFlag := flag.String("dither", "fs", "4/8bpp dithering: none, fs, ordered / 抖动方式")
+	keepFlag := flag.Bool("keep-palette", false, "4/8bpp: keep the original CLUT, write off-palette heatmaps to <FILE>_offpal / 沿用原调色板")
 	flag.Parse()
 
 	args := flag.Args()
 	if len(args) < 2 {
 		fmt.Println("Usage:")
 		fmt.Println("  tool export <FILE>")
-		fmt.Println("  tool [-checksum] import <FILE> [Optional: SinglePngPath]")
+		fmt.Println("  tool [-checksum] [-dither fs|ordered|none] [-keep-palette] import <FILE> [Optional: SinglePngPath]")
 		return
 	}
 
@@ -45,7 +47,9 @@ func main() {
 		if len(args) >= 3 {
 			single = args[2]
 		}
-		importTIMs(file, single, *checksumFlag)
+		dither, err := palquant.ParseDither(*ditherFlag)
+		if err != nil { log.Fatal(err) }
+		importTIMs(file, single, *checksumFlag, dither, *keepFlag)
 	}
 }
 
@@ -71,7 +75,7 @@ func exportTIMs(path string) {
 	}
 }
 
-func importTIMs(targetPath, singlePng string, forceChecksum bool) {
+func importTIMs(targetPath, singlePng string, forceChecksum bool, dither palquant.Dither, keepPalette bool) {
 	binData, err := ioutil.ReadFile(targetPath)
 	if err != nil { log.Fatal(err) }
 
@@ -94,7 +98,9 @@ func importTIMs(targetPath, singlePng string, forceChecksum bool) {
 
 	updated := 0
 	for _, fpath := range files {
-		if err := patchTIM(binData, fpath, shouldFix); err != nil {
+		heatDir := ""
+		if keepPalette { heatDir = targetPath + "_offpal" }
+		if err := patchTIM(binData, fpath, shouldFix, dither, heatDir); err != nil {
 			fmt.Printf("Err %s: %v\n", filepath.Base(fpath), err)
 		} else {
 			updated++
@@ -109,7 +115,8 @@ func importTIMs(targetPath, singlePng string, forceChecksum bool) {
 
 
 //文件校验部分
-func patchTIM(binData []byte, pngPath string, fixChecksum bool) error {
+//heatDir非空时沿用原TIM的CLUT(4/8bpp)，偏离调色板的像素热图写到heatDir
+func patchTIM(binData []byte, pngPath string, fixChecksum bool, dither palquant.Dither, heatDir string) error {
 	base := filepath.Base(pngPath)
 	parts := strings.Split(strings.TrimSuffix(base, ".png"), "_")
 	if len(parts) < 5 { return fmt.Errorf("bad filename fmt") }
@@ -119,24 +126,42 @@ func patchTIM(binData []byte, pngPath string, fixChecksum bool) error {
 	bppStr := strings.TrimSuffix(parts[4], "bpp")
 	bpp, _ := strconv.Atoi(bppStr)
 
+	if offset < 0 || offset >= len(binData) { return fmt.Errorf("offset %X outside the file", offset) }
+	origTimReader := bytes.NewReader(binData[offset:])
+	origTim, err := psxtim.Decode(origTimReader)
+	if err != nil { return fmt.Errorf("failed to parse orig TIM: %v", err) }
+
 	rawPng, err := ioutil.ReadFile(pngPath)
 	if err != nil { return err }
-	var qPngData []byte
-	if bpp == 4 || bpp == 8 {
-		colors := 16
-		if bpp == 8 { colors = 256 }
-		qPngData, err = quantize(rawPng, colors)
+	keep := heatDir != "" && (bpp == 4 || bpp == 8)
+	var img image.Image
+	var report palquant.OffPalette
+	if keep {
+		//沿用原CLUT: 映射到导出时用的第一个CLUT
+		if origTim.BPP != bpp { return fmt.Errorf("orig TIM is %dbpp, png name says %dbpp", origTim.BPP, bpp) }
+		origImg, err := origTim.ToImage(0)
 		if err != nil { return err }
-	} else { qPngData = rawPng }
-
-	img, _, err := image.Decode(bytes.NewReader(qPngData))
-	if err != nil { return err }
+		src, err := png.Decode(bytes.NewReader(rawPng))
+		if err != nil { return err }
+		img, report = palquant.KeepPalette(src, origImg.(*image.Paletted).Palette)
+	} else {
+		qPngData := rawPng
+		if bpp == 4 || bpp == 8 {
+			colors := 16
+			if bpp == 8 { colors = 256 }
+			qPngData, err = palquant.QuantizePNG(rawPng, palquant.Options{Colors: colors, Dither: dither})
+			if err != nil { return err }
+		}
+		img, _, err = image.Decode(bytes.NewReader(qPngData))
+		if err != nil { return err }
+	}
 	newTim, err := psxtim.FromImage(img, bpp)
 	if err != nil { return err }
-
-	origTimReader := bytes.NewReader(binData[offset:])
-	origTim, err := psxtim.Decode(origTimReader)
-	if err != nil { return fmt.Errorf("failed to parse orig TIM: %v", err) }
+	if keep {
+		//CLUT原样写回
+		newTim.NumCluts, newTim.ColorsPerClut = origTim.NumCluts, origTim.ColorsPerClut
+		newTim.ClutData = origTim.ClutData
+	}
 	
 	newTim.OrgX = origTim.OrgX; newTim.OrgY = origTim.OrgY
 	newTim.ClutOrgX = origTim.ClutOrgX; newTim.ClutOrgY = origTim.ClutOrgY
@@ -180,28 +205,15 @@ func patchTIM(binData []byte, pngPath string, fixChecksum bool) error {
 		fmt.Printf("Imp: %s -> %X [OK]\n", base, offset)
 	}
 
-	return nil
-}
-
-func quantize(raw []byte, nColors int) ([]byte, error) {
-	exePath, err := exec.LookPath("pngquant")
-	
-	if err != nil {
-		executablePath, _ := os.Executable()
-		exeDir := filepath.Dir(executablePath)
-		localPngquant := filepath.Join(exeDir, "pngquant.exe")
-		
-		if _, statErr := os.Stat(localPngquant); statErr == nil {
-			exePath = localPngquant
-		} else {
-			return nil, fmt.Errorf("pngquant not found in PATH or alongside tool")
+	if keep {
+		fmt.Printf("  Keep palette: %v\n", report)
+		if report.Pixels > 0 {
+			os.MkdirAll(heatDir, 0755)
+			heatPath := palquant.HeatmapPath(filepath.Join(heatDir, base))
+			if err := report.WriteHeatmap(heatPath); err != nil { return err }
+			fmt.Printf("  Heatmap saved: %s\n", heatPath)
 		}
 	}
 
-	cmd := exec.Command(exePath, "--force", "--speed", "1", fmt.Sprintf("%d", nColors), "-")
-	cmd.Stdin = bytes.NewReader(raw)
-	var out, stderr bytes.Buffer
-	cmd.Stdout = &out; cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil { return nil, fmt.Errorf("pngquant: %v (%s)", err, stderr.String()) }
-	return out.Bytes(), nil
-}
\ No newline at end of file
+	return nil
+}
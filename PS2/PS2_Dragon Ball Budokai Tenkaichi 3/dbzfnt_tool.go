@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/binary"
 	"fmt"
 	"image"
 	"image/color"
@@ -10,6 +11,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"palquant"
+	"ps2gs"
 )
 
 const (
@@ -28,6 +32,18 @@ var (
 )
 
 func main() {
+	// -keep-palette may appear anywhere after the mode
+	keepPalette := false
+	args := os.Args[:1]
+	for _, a := range os.Args[1:] {
+		if a == "-keep-palette" {
+			keepPalette = true
+		} else {
+			args = append(args, a)
+		}
+	}
+	os.Args = args
+
 	if len(os.Args) < 3 {
 		printUsage()
 		return
@@ -46,7 +62,7 @@ func main() {
 			printUsage()
 			return
 		}
-		doRepack(os.Args[2], os.Args[3], os.Args[4], os.Args[5])
+		doRepack(os.Args[2], os.Args[3], os.Args[4], os.Args[5], keepPalette)
 	default:
 		printUsage()
 	}
@@ -56,7 +72,8 @@ func printUsage() {
 	fmt.Println("DBZ Budokai Tenkaichi 3 Font Tool / aikika 202512")
 	fmt.Println("Usage:")
 	fmt.Println("  EXTRACT TO PNG: dbzfnt_tool -e <file.fnt>")
-	fmt.Println("  REBUILD FNT:  dbzfnt_tool -r <orig.fnt> <clut1.png> <clut2.png> <out.fnt>")
+	fmt.Println("  REBUILD FNT:  dbzfnt_tool -r <orig.fnt> <clut1.png> <clut2.png> <out.fnt> [-keep-palette]")
+	fmt.Println("  -keep-palette: report pixels that are not one of the 4 CLUT shades, heatmap in <clutN>_offpal.png")
 
 }
 
@@ -73,7 +90,8 @@ func doExtract(fpath string) {
 	f.Read(rawPacked)
 
 	fmt.Println("  Applying Unswizzle4 (Native)...")
-	unswizzledPacked := Unswizzle4(rawPacked, FntWidth, FntHeight)
+	unswizzledPacked, err := ps2gs.Unswizzle(rawPacked, FntWidth, FntHeight, ps2gs.PSMT4)
+	if err != nil { log.Fatal(err) }
 
 	indices := make([]uint8, FntWidth*FntHeight)
 	for i, b := range unswizzledPacked {
@@ -90,7 +108,7 @@ func doExtract(fpath string) {
 }
 
 
-func doRepack(origFntPath, png1Path, png2Path, outFntPath string) {
+func doRepack(origFntPath, png1Path, png2Path, outFntPath string, keepPalette bool) {
 	fmt.Printf("Repacking %s + %s -> %s ...\n", png1Path, png2Path, outFntPath)
 
 	img1 := loadPng(png1Path)
@@ -102,20 +120,32 @@ func doRepack(origFntPath, png1Path, png2Path, outFntPath string) {
 	
 	// -------------------------------------------------------
 	linearIndices := make([]byte, FntWidth*FntHeight)
-	
-	for y := 0; y < FntHeight; y++ {
-		for x := 0; x < FntWidth; x++ {
-			c1 := img1.At(x, y)
-			c2 := img2.At(x, y)
+
+	if keepPalette {
+		// 两张图分别对应两个CLUT: clut1按 i%4 取色, clut2按 i/4 取色
+		clut1, clut2 := readFntCluts(origFntPath)
+		locked1 := keepClut(img1, clut1, png1Path)
+		locked2 := keepClut(img2, clut2, png2Path)
+		for i := range linearIndices {
+			idx1 := locked1.Pix[i] % 4
+			idx2 := locked2.Pix[i] / 4
+			linearIndices[i] = (idx2 << 2) | idx1
+		}
+	} else {
+		for y := 0; y < FntHeight; y++ {
+			for x := 0; x < FntWidth; x++ {
+				c1 := img1.At(x, y)
+				c2 := img2.At(x, y)
 			
-			// 找到最近的颜色索引 (0-3)
-			idx1 := findNearestColorIndex(c1)
-			idx2 := findNearestColorIndex(c2)
+				// 找到最近的颜色索引 (0-3)
+				idx1 := findNearestColorIndex(c1)
+				idx2 := findNearestColorIndex(c2)
 			
-			// 合并: High 2 bits = idx2, Low 2 bits = idx1
-			combined := (idx2 << 2) | idx1
+				// 合并: High 2 bits = idx2, Low 2 bits = idx1
+				combined := (idx2 << 2) | idx1
 			
-			linearIndices[y*FntWidth+x] = combined
+				linearIndices[y*FntWidth+x] = combined
+			}
 		}
 	}
 
@@ -132,7 +162,8 @@ func doRepack(origFntPath, png1Path, png2Path, outFntPath string) {
 
 	// -------------------------------------------------------
 	fmt.Println("  Applying Swizzle4 (Native)...")
-	swizzledData := Swizzle4(linearPacked, FntWidth, FntHeight)
+	swizzledData, err := ps2gs.Swizzle(linearPacked, FntWidth, FntHeight, ps2gs.PSMT4)
+	if err != nil { log.Fatal(err) }
 
 	// -------------------------------------------------------
 	inputData, err := os.ReadFile(origFntPath)
@@ -153,6 +184,22 @@ func doRepack(origFntPath, png1Path, png2Path, outFntPath string) {
 }
 
 
+// keepClut maps img onto the CLUT it was exported with and reports the pixels
+// that were not one of its shades.
+func keepClut(img image.Image, pal color.Palette, pngPath string) *image.Paletted {
+	if img.Bounds().Dx() != FntWidth || img.Bounds().Dy() != FntHeight {
+		log.Fatalf("%s size mismatch: expected %dx%d", pngPath, FntWidth, FntHeight)
+	}
+	locked, report := palquant.KeepPalette(img, pal)
+	fmt.Printf("  %s: %s\n", filepath.Base(pngPath), report)
+	if report.Pixels > 0 {
+		heatPath := palquant.HeatmapPath(pngPath)
+		if err := report.WriteHeatmap(heatPath); err != nil { log.Fatal(err) }
+		fmt.Printf("  -> Heatmap: %s\n", heatPath)
+	}
+	return locked
+}
+
 func loadPng(path string) image.Image {
 	f, err := os.Open(path)
 	if err != nil { log.Fatal(err) }
@@ -192,6 +239,56 @@ func findNearestColorIndex(c color.Color) uint8 {
 	return uint8(bestIdx)
 }
 
+// readFntCluts returns the two 16-colour CLUTs of the FNT for -keep-palette.
+// They are taken from the GIF IMAGE packets outside the pixel data, either two
+// 16-entry uploads or one of 32, and only used when clut1 repeats every 4
+// entries and clut2 in runs of 4, as makeClut1/makeClut2 do. Otherwise the
+// built-in grey ramps are used.
+func readFntCluts(fntPath string) (color.Palette, color.Palette) {
+	data, err := os.ReadFile(fntPath)
+	if err != nil { log.Fatal(err) }
+
+	var entries []color.Color
+	for off := 0; off+16 <= len(data); off += 16 {
+		if off >= FntPixelOffset && off < FntPixelOffset+FntPixelSize {
+			continue
+		}
+		tag := binary.LittleEndian.Uint64(data[off:])
+		flg := tag >> 58 & 3
+		nloop := int(tag & 0x7FFF)
+		if flg != 2 || off+16+nloop*16 > len(data) {
+			continue
+		}
+		payload := data[off+16 : off+16+nloop*16]
+		switch nloop {
+		case 2: // 16 x ABGR1555
+			for i := 0; i < 16; i++ {
+				entries = append(entries, decodeABGR1555(binary.LittleEndian.Uint16(payload[i*2:]), "ps2"))
+			}
+		case 4, 8: // 16 or 32 x RGBA8888
+			for i := 0; i < nloop*4; i++ {
+				entries = append(entries, decodeRGBA8888(binary.LittleEndian.Uint32(payload[i*4:]), "ps2"))
+			}
+		default:
+			continue
+		}
+		off += nloop * 16
+	}
+	if len(entries) != 32 {
+		fmt.Println("  Warning: CLUTs not found in the FNT, keeping to the built-in grey ramps")
+		return makeClut1(), makeClut2()
+	}
+	clut1, clut2 := color.Palette(entries[:16]), color.Palette(entries[16:])
+	for i := 0; i < 16; i++ {
+		if clut1[i] != clut1[i%4] || clut2[i] != clut2[i/4*4] {
+			fmt.Println("  Warning: FNT CLUTs are not laid out as i%4 / i/4, keeping to the built-in grey ramps")
+			return makeClut1(), makeClut2()
+		}
+	}
+	fmt.Println("  Keeping to the CLUTs stored in the FNT")
+	return clut1, clut2
+}
+
 func makeClut1() color.Palette {
 	p := make(color.Palette, 16)
 	pattern := []color.RGBA{ColBlack, ColDGray, ColLGray, ColWhite}
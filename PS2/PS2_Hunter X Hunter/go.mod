@@ -0,0 +1,13 @@
+module rh2_tool
+
+go 1.22.2
+
+require (
+	palquant v0.0.0
+	ps2gs v0.0.0
+)
+
+replace (
+	palquant => ../../palquant
+	ps2gs => ../ps2gs
+)
@@ -9,9 +9,19 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"palquant"
 )
 
 func main() {
+	// -keep-palette may appear anywhere after the command
+	keepPalette := false
+	args := os.Args[:1]
+	for _, a := range os.Args[1:] {
+		if a == "-keep-palette" { keepPalette = true } else { args = append(args, a) }
+	}
+	os.Args = args
+
 	if len(os.Args) < 2 {
 		printUsage()
 		return
@@ -49,7 +59,7 @@ func main() {
 			printUsage()
 			return
 		}
-		doInject(os.Args[2], os.Args[3], os.Args[4])
+		doInject(os.Args[2], os.Args[3], os.Args[4], keepPalette)
 
 	case "-c": // Inject CVT
 		if len(os.Args) < 4 {
@@ -59,7 +69,7 @@ func main() {
 		}
 		outCvt := os.Args[3]
 		if len(os.Args) >= 5 { outCvt = os.Args[4] }
-		doCvtInject(os.Args[2], os.Args[3], outCvt)
+		doCvtInject(os.Args[2], os.Args[3], outCvt, keepPalette)
 
 	case "-x": // Extract CVT
 		if len(os.Args) < 3 {
@@ -86,9 +96,23 @@ func printUsage() {
 	fmt.Println("\nUsage:")
 	fmt.Printf("  Convert RH2 to PNG:      %s -e <file.rh2> [out.png]\n", exe)
 	fmt.Printf("  Batch RH2 to PNG:        %s -e <folder>\n", exe)
-	fmt.Printf("  Convert PNG to RH2:      %s -i <src.png> <template.rh2> <out.rh2>\n", exe)
-	fmt.Printf("  Inject PNG into CVT:     %s -c <src.png> <target.cvt> [out.cvt]\n", exe)
+	fmt.Printf("  Convert PNG to RH2:      %s -i <src.png> <template.rh2> <out.rh2> [-keep-palette]\n", exe)
+	fmt.Printf("  Inject PNG into CVT:     %s -c <src.png> <target.cvt> [out.cvt] [-keep-palette]\n", exe)
 	fmt.Printf("  Extract RH2 from CVT:    %s -x <file.cvt> [out_folder]\n", exe)
+	fmt.Println("\n  -keep-palette: keep the original CLUT, map pixels onto it and write <out>_offpal.png")
+}
+
+// reportOffPalette prints how many pixels missed the kept CLUT and saves the
+// heatmap next to outPath.
+func reportOffPalette(report *palquant.OffPalette, outPath string) {
+	if report == nil { return }
+	fmt.Println("  Keep palette:", report)
+	if report.Pixels == 0 { return }
+	heatPath := palquant.HeatmapPath(outPath)
+	if err := report.WriteHeatmap(heatPath); err != nil {
+		fmt.Printf("  Error Heatmap: %v\n", err); return
+	}
+	fmt.Println("  Heatmap saved:", heatPath)
 }
 
 // --- Handlers ---
@@ -138,7 +162,7 @@ func doConvertToPng(rh2Path, pngPath string) {
 	fmt.Println("Saved:", pngPath)
 }
 
-func doInject(pngPath, tmplPath, outPath string) {
+func doInject(pngPath, tmplPath, outPath string, keepPalette bool) {
 	f, err := os.Open(pngPath)
 	if err != nil { fmt.Printf("Error: %v\n", err); return }
 	defer f.Close()
@@ -148,13 +172,14 @@ func doInject(pngPath, tmplPath, outPath string) {
 	tmpl, err := os.ReadFile(tmplPath)
 	if err != nil { fmt.Printf("Error: %v\n", err); return }
 
-	newData, err := InjectPNGToRH2(img, tmpl)
+	newData, report, err := InjectPNGToRH2(img, tmpl, keepPalette)
 	if err != nil { fmt.Printf("Error: %v\n", err); return }
 
 	if err := os.WriteFile(outPath, newData, 0644); err != nil {
 		fmt.Printf("Error: %v\n", err); return
 	}
 	fmt.Println("Saved:", outPath)
+	reportOffPalette(report, outPath)
 }
 
 func doCvtExtract(cvtPath, outDir string) {
@@ -236,7 +261,7 @@ func doCvtExtract(cvtPath, outDir string) {
 	fmt.Printf("Done. Extracted %d files.\n", count)
 }
 
-func doCvtInject(pngPath, cvtPath, outCvtPath string) {
+func doCvtInject(pngPath, cvtPath, outCvtPath string, keepPalette bool) {
 	fmt.Printf("Injecting %s into %s...\n", filepath.Base(pngPath), filepath.Base(cvtPath))
 	cvtData, err := os.ReadFile(cvtPath)
 	if err != nil { fmt.Printf("Error: %v\n", err); return }
@@ -246,6 +271,7 @@ func doCvtInject(pngPath, cvtPath, outCvtPath string) {
 	fmt.Println("Target Internal Name:", targetName)
 
 	found := false
+	var report *palquant.OffPalette
 	dataLen := int64(len(cvtData))
 	pos := int64(0)
 
@@ -285,7 +311,7 @@ func doCvtInject(pngPath, cvtPath, outCvtPath string) {
 				f.Close()
 				if err != nil { fmt.Printf("Error Decode: %v\n", err); return }
 				
-				newRH2, err := InjectPNGToRH2(pngImg, tmplData)
+				newRH2, off, err := InjectPNGToRH2(pngImg, tmplData, keepPalette)
 				if err != nil { fmt.Println("Error Inject:", err); return }
 				
 				if int64(len(newRH2)) != size {
@@ -293,6 +319,7 @@ func doCvtInject(pngPath, cvtPath, outCvtPath string) {
 				}
 				
 				copy(cvtData[pos:], newRH2)
+				report = off
 				found = true
 				break
 			}
@@ -308,4 +335,5 @@ func doCvtInject(pngPath, cvtPath, outCvtPath string) {
 		fmt.Printf("Error Write: %v\n", err); return
 	}
 	fmt.Println("Success! Saved to", outCvtPath)
+	reportOffPalette(report, outCvtPath)
 }
\ No newline at end of file
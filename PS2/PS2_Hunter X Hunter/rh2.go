@@ -8,6 +8,9 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+
+	"palquant"
+	"ps2gs"
 )
 
 type QRS struct {
@@ -66,31 +69,18 @@ func parseRH2(data []byte) []QRS {
 	return blocks
 }
 
-func RH2ToImage(data []byte) (image.Image, error) {
-	if len(data) < 0x60 { return nil, fmt.Errorf("file too small") }
-	
-	mode := binary.LittleEndian.Uint16(data[0x50:])
-	w := int(binary.LittleEndian.Uint16(data[0x54:]))
-	h := int(binary.LittleEndian.Uint16(data[0x56:]))
-	
-	blocks := parseRH2(data)
-	if len(blocks) == 0 {
-		return nil, fmt.Errorf("no image blocks found")
-	}
-	
+// readRH2Palette decodes the CLUT in block 0: 16 ABGR1555 entries for 4bpp,
+// 256 CSM1 entries (ABGR1555 or RGBX8888, by marker) for 8bpp. Direct color
+// textures have none.
+func readRH2Palette(data []byte, blocks []QRS, mode uint16) []color.RGBA {
 	var palette []color.RGBA
-	startBlockIdx := 0
-	
-	// 1. Identify Mode and Load Palette (if indexed)
+	palOffset := blocks[0].s + 0x18
 	if mode == 0x14 { // 4bpp
-		palOffset := blocks[0].s + 0x18
 		for i := 0; i < 16; i++ {
 			v := binary.LittleEndian.Uint16(data[palOffset+i*2:])
 			palette = append(palette, decodeABGR1555(v))
 		}
-		startBlockIdx = 1 // Block 0 is palette
 	} else if mode == 0x13 { // 8bpp
-		palOffset := blocks[0].s + 0x18
 		marker := binary.BigEndian.Uint16(data[blocks[0].s+8:])
 		
 		if marker == 0x2080 { // ABGR1555
@@ -98,7 +88,7 @@ func RH2ToImage(data []byte) (image.Image, error) {
 			for i := 0; i < 256; i++ {
 				rawPal[i] = binary.LittleEndian.Uint16(data[palOffset+i*2:])
 			}
-			unswizzled := palCSM1(rawPal)
+			unswizzled := ps2gs.UnswizzleCSM1_16(rawPal)
 			for _, v := range unswizzled {
 				palette = append(palette, decodeABGR1555(v))
 			}
@@ -107,17 +97,34 @@ func RH2ToImage(data []byte) (image.Image, error) {
 			for i := 0; i < 256; i++ {
 				rawPal[i] = binary.LittleEndian.Uint32(data[palOffset+i*4:])
 			}
-			unswizzled := palCSM1_32(rawPal)
+			unswizzled := ps2gs.UnswizzleCSM1_32(rawPal)
 			for _, v := range unswizzled {
 				palette = append(palette, decodeRGBX8888(v))
 			}
 		}
+	}
+	return palette
+}
+
+func RH2ToImage(data []byte) (image.Image, error) {
+	if len(data) < 0x60 { return nil, fmt.Errorf("file too small") }
+	
+	mode := binary.LittleEndian.Uint16(data[0x50:])
+	w := int(binary.LittleEndian.Uint16(data[0x54:]))
+	h := int(binary.LittleEndian.Uint16(data[0x56:]))
+	
+	blocks := parseRH2(data)
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no image blocks found")
+	}
+	
+	// 1. Identify Mode and Load Palette (if indexed)
+	palette := readRH2Palette(data, blocks, mode)
+	startBlockIdx := 0
+	if mode == 0x14 || mode == 0x13 {
 		startBlockIdx = 1 // Block 0 is palette
-	} else {
-		// Assume 16-bit Direct Color (No Palette)
-		// Block 0 is the first tile
-		startBlockIdx = 0
 	}
+	// Otherwise 16-bit Direct Color (No Palette), Block 0 is the first tile
 
 	img := image.NewRGBA(image.Rect(0, 0, w, h))
 
@@ -147,7 +154,7 @@ func RH2ToImage(data []byte) (image.Image, error) {
 			size := (tw * th) / 2
 			if pixOffset+size > len(data) { continue }
 			raw := data[pixOffset : pixOffset+size]
-			swapped := swapNibbles(raw)
+			swapped := ps2gs.SwapNibbles(raw)
 			for py := 0; py < th; py++ {
 				for px := 0; px < tw; px += 2 {
 					idx := (py*tw + px) / 2
@@ -162,7 +169,11 @@ func RH2ToImage(data []byte) (image.Image, error) {
 			size := tw * th
 			if pixOffset+size > len(data) { continue }
 			raw := data[pixOffset : pixOffset+size]
-			unswizzled := ps2Swizzle(raw, tw, th, false)
+			unswizzled, err := ps2gs.Unswizzle(raw, tw, th, ps2gs.PSMT8)
+			if err != nil {
+				fmt.Printf("Warning: tile %d: %v, skipped\n", ti, err)
+				continue
+			}
 			for py := 0; py < th; py++ {
 				for px := 0; px < tw; px++ {
 					idx := unswizzled[py*tw+px]
@@ -186,8 +197,11 @@ func RH2ToImage(data []byte) (image.Image, error) {
 	return img, nil
 }
 
-func InjectPNGToRH2(pngImg image.Image, rh2Data []byte) ([]byte, error) {
-	if len(rh2Data) < 0x60 { return nil, fmt.Errorf("template too small") }
+// InjectPNGToRH2 rebuilds the template with the PNG. With keepPalette the CLUT
+// in the template is left alone and the pixels are mapped onto it; the
+// returned report says how many were not in it (nil for direct color).
+func InjectPNGToRH2(pngImg image.Image, rh2Data []byte, keepPalette bool) ([]byte, *palquant.OffPalette, error) {
+	if len(rh2Data) < 0x60 { return nil, nil, fmt.Errorf("template too small") }
 	
 	mode := binary.LittleEndian.Uint16(rh2Data[0x50:])
 	w := int(binary.LittleEndian.Uint16(rh2Data[0x54:]))
@@ -200,14 +214,33 @@ func InjectPNGToRH2(pngImg image.Image, rh2Data []byte) ([]byte, error) {
 
 	blocks := parseRH2(rh2Data)
 	if len(blocks) == 0 {
-		return nil, fmt.Errorf("template has no blocks")
+		return nil, nil, fmt.Errorf("template has no blocks")
 	}
 
 	var pal []color.RGBA
 	startBlockIdx := 0
-	
+
+	// Palette-locked: map the whole image onto the template CLUT once, tiles
+	// then take their indices from it and no palette is written.
+	var locked *image.Paletted
+	var report *palquant.OffPalette
+	if keepPalette && (mode == 0x14 || mode == 0x13) {
+		pal = readRH2Palette(rh2Data, blocks, mode)
+		if len(pal) == 0 {
+			return nil, nil, fmt.Errorf("template palette format not recognised")
+		}
+		goPal := make(color.Palette, len(pal))
+		for i, c := range pal { goPal[i] = c }
+		var off palquant.OffPalette
+		locked, off = palquant.KeepPalette(pngImg, goPal)
+		report = &off
+	}
+
 	// 1. Palette Injection
-	if mode == 0x14 {
+	if locked != nil {
+		startBlockIdx = 1
+		fmt.Printf("  Mode: 0x%X, keeping template palette (%d colors)\n", mode, len(pal))
+	} else if mode == 0x14 {
 		startBlockIdx = 1
 		palOffset := blocks[0].s + 0x18
 		pal = extractPalette(pngImg, 16)
@@ -231,7 +264,7 @@ func InjectPNGToRH2(pngImg image.Image, rh2Data []byte) ([]byte, error) {
 			fmt.Println("  Mode: 8bpp (ABGR1555)")
 			vals := make([]uint16, 256)
 			for i, c := range pal { vals[i] = encodeABGR1555(c) }
-			swizzled := palCSM1(vals)
+			swizzled := ps2gs.SwizzleCSM1_16(vals)
 			buf := new(bytes.Buffer)
 			binary.Write(buf, binary.LittleEndian, swizzled)
 			if palOffset+buf.Len() <= len(rh2Data) {
@@ -241,7 +274,7 @@ func InjectPNGToRH2(pngImg image.Image, rh2Data []byte) ([]byte, error) {
 			fmt.Println("  Mode: 8bpp (RGBX8888)")
 			vals := make([]uint32, 256)
 			for i, c := range pal { vals[i] = encodeRGBX8888(c) }
-			swizzled := palCSM1_32(vals)
+			swizzled := ps2gs.SwizzleCSM1_32(vals)
 			buf := new(bytes.Buffer)
 			binary.Write(buf, binary.LittleEndian, swizzled)
 			if palOffset+buf.Len() <= len(rh2Data) {
@@ -291,7 +324,7 @@ func InjectPNGToRH2(pngImg image.Image, rh2Data []byte) ([]byte, error) {
 		pixOffset := q.s + 0x18
 		
 		if mode == 0x14 {
-			indexed := imageToIndexed(tile, pal)
+			indexed := tileIndices(tile, pal, locked, tx, ty)
 			packed := make([]byte, 0, len(indexed)/2)
 			for j := 0; j < len(indexed); j += 2 {
 				p1 := indexed[j] & 0xF
@@ -299,13 +332,17 @@ func InjectPNGToRH2(pngImg image.Image, rh2Data []byte) ([]byte, error) {
 				if j+1 < len(indexed) { p2 = indexed[j+1] & 0xF }
 				packed = append(packed, (p1<<4)|p2)
 			}
-			swapped := swapNibbles(packed)
+			swapped := ps2gs.SwapNibbles(packed)
 			if pixOffset+len(swapped) <= len(outData) {
 				copy(outData[pixOffset:], swapped)
 			}
 		} else if mode == 0x13 {
-			indexed := imageToIndexed(tile, pal)
-			swizzled := ps2Swizzle(indexed, tw, th, true)
+			indexed := tileIndices(tile, pal, locked, tx, ty)
+			swizzled, err := ps2gs.Swizzle(indexed, tw, th, ps2gs.PSMT8)
+			if err != nil {
+				fmt.Printf("Warning: tile %d: %v, skipped\n", ti, err)
+				continue
+			}
 			if pixOffset+len(swizzled) <= len(outData) {
 				copy(outData[pixOffset:], swizzled)
 			}
@@ -327,5 +364,23 @@ func InjectPNGToRH2(pngImg image.Image, rh2Data []byte) ([]byte, error) {
 		processedCount++
 	}
 	
-	return outData, nil
+	return outData, report, nil
+}
+
+// tileIndices indexes a tile against pal, or cuts it out of the palette-locked
+// image when there is one. Pixels past the image edge get index 0.
+func tileIndices(tile *image.RGBA, pal []color.RGBA, locked *image.Paletted, tx, ty int) []uint8 {
+	if locked == nil {
+		return imageToIndexed(tile, pal)
+	}
+	tw, th := tile.Bounds().Dx(), tile.Bounds().Dy()
+	out := make([]uint8, tw*th)
+	for y := 0; y < th; y++ {
+		for x := 0; x < tw; x++ {
+			if p := image.Pt(tx+x, ty+y); p.In(locked.Bounds()) {
+				out[y*tw+x] = locked.ColorIndexAt(p.X, p.Y)
+			}
+		}
+	}
+	return out
 }
\ No newline at end of file
@@ -143,61 +143,3 @@ func imageToIndexed(img image.Image, pal []color.RGBA) []uint8 {
 	}
 	return out
 }
-
-// --- Swizzle Logic ---
-
-func swapNibbles(data []byte) []byte {
-	res := make([]byte, len(data))
-	for i, b := range data {
-		res[i] = (b&0x0F)<<4 | (b&0xF0)>>4
-	}
-	return res
-}
-
-func ps2Swizzle(data []byte, w, h int, swizzle bool) []byte {
-	out := make([]byte, w*h)
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			blk := (y & (^0xF)) * w
-			blk += (x & (^0xF)) * 2
-			swap := (((y + 2) >> 2) & 0x1) * 4
-			py := (((y & (^3)) >> 1) + (y & 1)) & 0x7
-			col := py*w*2 + ((x+swap)&0x7)*4
-			bn := ((y >> 1) & 1) + ((x >> 2) & 2)
-			sid := blk + col + bn
-
-			if swizzle {
-				out[sid] = data[y*w+x]
-			} else {
-				if sid < len(data) {
-					out[y*w+x] = data[sid]
-				}
-			}
-		}
-	}
-	return out
-}
-
-// CSM1 for 16-bit palette
-func palCSM1(entries []uint16) []uint16 {
-	out := make([]uint16, 0, len(entries))
-	for i := 0; i < 256; i += 32 {
-		out = append(out, entries[i:i+8]...)
-		out = append(out, entries[i+16:i+24]...) // Swap middle blocks
-		out = append(out, entries[i+8:i+16]...)
-		out = append(out, entries[i+24:i+32]...)
-	}
-	return out
-}
-
-// CSM1 for 32-bit palette (RGBX8888)
-func palCSM1_32(entries []uint32) []uint32 {
-	out := make([]uint32, 0, len(entries))
-	for i := 0; i < 256; i += 32 {
-		out = append(out, entries[i:i+8]...)
-		out = append(out, entries[i+16:i+24]...) // Swap middle blocks
-		out = append(out, entries[i+8:i+16]...)
-		out = append(out, entries[i+24:i+32]...)
-	}
-	return out
-}
\ No newline at end of file
@@ -10,6 +10,8 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+
+	"palquant"
 )
 
 type TIM2Header struct {
@@ -22,10 +24,21 @@ type TIM2Header struct {
 }
 
 type PictureHeader struct {
-	TotalSize   uint32
-	PictureSize uint32
-	HeaderSize  uint16
-	ColorCount  uint16
+	TotalSize      uint32 // header + image + CLUT
+	ClutSize       uint32
+	ImageSize      uint32 // all mip levels
+	HeaderSize     uint16 // with the mipmap header and user data
+	ClutColors     uint16
+	PictFormat     uint8
+	MipMapTextures uint8
+	ClutType       uint8
+	ImageType      uint8
+	ImageWidth     uint16
+	ImageHeight    uint16
+	GsTex0         uint64
+	GsTex1         uint64
+	GsTexaFbaPabe  uint32
+	GsTexClut      uint32
 }
 
 type ExtractInfo struct {
@@ -137,13 +150,25 @@ func createOutputDir(inputPath string) (string, error) {
 }
 
 func saveJsonRecord(record ExtractRecord, outDir string) error {
+	return writeJsonRecord(record, filepath.Join(outDir, "extract_info.json"))
+}
+
+func writeJsonRecord(record ExtractRecord, jsonPath string) error {
+	var w pendingWrites
+	defer w.discard()
+	if err := stageJsonRecord(&w, record, jsonPath); err != nil {
+		return err
+	}
+	return w.commit()
+}
+
+func stageJsonRecord(w *pendingWrites, record ExtractRecord, jsonPath string) error {
 	jsonData, err := json.MarshalIndent(record, "", "  ")
 	if err != nil {
 		return fmt.Errorf("JSON serialization error: %v", err)
 	}
 
-	jsonPath := filepath.Join(outDir, "extract_info.json")
-	if err := os.WriteFile(jsonPath, jsonData, 0644); err != nil {
+	if err := w.add(jsonPath, jsonData); err != nil {
 		return fmt.Errorf("failed to write JSON file: %v", err)
 	}
 
@@ -165,26 +190,13 @@ func readJsonRecord(jsonPath string) (ExtractRecord, error) {
 	return record, nil
 }
 
-func findTargetFileInfo(record ExtractRecord, filename string) (ExtractInfo, bool) {
-	for _, info := range record.ExtractFiles {
+func findTargetFileInfo(record ExtractRecord, filename string) (int, bool) {
+	for i, info := range record.ExtractFiles {
 		if info.Filename == filename {
-			return info, true
+			return i, true
 		}
 	}
-	return ExtractInfo{}, false
-}
-
-func validateFileSize(file *os.File, expectedSize int) error {
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to get file info: %v", err)
-	}
-
-	if int(fileInfo.Size()) != expectedSize {
-		return fmt.Errorf("file size mismatch! Expected: %d, Actual: %d", expectedSize, fileInfo.Size())
-	}
-
-	return nil
+	return -1, false
 }
 
 func importTIM2(sourceFile *os.File, targetFile *os.File, offset int64, size int) error {
@@ -295,7 +307,7 @@ func extractMode(inputPath string) {
 	fmt.Printf("\nExtraction complete! Found %d TIM2 files\n", index)
 }
 
-func importMode(tm2Path, jsonPath, binPath string) {
+func importMode(tm2Path, jsonPath, binPath, tablePath string, scan bool) {
 	tm2Filename := filepath.Base(tm2Path)
 
 	record, err := readJsonRecord(jsonPath)
@@ -304,11 +316,12 @@ func importMode(tm2Path, jsonPath, binPath string) {
 		return
 	}
 
-	targetInfo, found := findTargetFileInfo(record, tm2Filename)
+	targetIndex, found := findTargetFileInfo(record, tm2Filename)
 	if !found {
 		fmt.Printf("record for file %s not found in JSON\n", tm2Filename)
 		return
 	}
+	targetInfo := record.ExtractFiles[targetIndex]
 
 	sourceFile, err := os.Open(tm2Path)
 	if err != nil {
@@ -330,8 +343,33 @@ func importMode(tm2Path, jsonPath, binPath string) {
 	}
 
 	expectedSize := int(endOffset - startOffset + 1)
-	if err := validateFileSize(sourceFile, expectedSize); err != nil {
-		fmt.Println(err)
+	sourceInfo, err := sourceFile.Stat()
+	if err != nil {
+		fmt.Printf("failed to get file info: %v\n", err)
+		return
+	}
+	if int(sourceInfo.Size()) != expectedSize {
+		tm2Data, err := os.ReadFile(tm2Path)
+		if err != nil {
+			fmt.Printf("failed to read source file: %v\n", err)
+			return
+		}
+		// nothing is replaced until the BIN, the record and the -t file are all written
+		var w pendingWrites
+		defer w.discard()
+		if err := importResized(&w, tm2Data, binPath, &record, targetIndex, tablePath, scan); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := stageJsonRecord(&w, record, jsonPath); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := w.commit(); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("Successfully imported %s to %s at position 0x%X, %s updated\n", tm2Filename, binPath, startOffset, jsonPath)
 		return
 	}
 
@@ -350,9 +388,44 @@ func importMode(tm2Path, jsonPath, binPath string) {
 }
 
 func main() {
+	// -swizzle, -dither <mode> and -keep-palette may follow any TIM2/PNG command,
+	// -t <tables.json> and -noscan the import
+	swizzled := false
+	keepPalette := false
+	dither := palquant.DitherFloydSteinberg
+	tablePath := ""
+	scan := true
+	args := os.Args[:1]
+	for i := 1; i < len(os.Args); i++ {
+		switch {
+		case os.Args[i] == "-swizzle":
+			swizzled = true
+		case os.Args[i] == "-keep-palette":
+			keepPalette = true
+		case os.Args[i] == "-noscan":
+			scan = false
+		case os.Args[i] == "-t" && i+1 < len(os.Args):
+			tablePath = os.Args[i+1]
+			i++
+		case os.Args[i] == "-dither" && i+1 < len(os.Args):
+			d, err := palquant.ParseDither(os.Args[i+1])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			dither = d
+			i++
+		default:
+			args = append(args, os.Args[i])
+		}
+	}
+	os.Args = args
+
 	if len(os.Args) < 3 {
 		fmt.Println("Usage: tim2_extractor -e <input.bin>")
-		fmt.Println("       tim2_extractor -i <input.tm2> -j <info.json> -b <target.bin>")
+		fmt.Println("       tim2_extractor -i <input.tm2> -j <info.json> -b <target.bin> [-t <tables.json>] [-noscan]")
+		fmt.Println("       tim2_extractor -topng <input.tm2> [-swizzle]")
+		fmt.Println("       tim2_extractor -frompng <input.tm2> [-o <output.tm2>] [-swizzle] [-dither fs|ordered|none] [-keep-palette]")
 		return
 	}
 
@@ -367,11 +440,26 @@ func main() {
 		extractMode(os.Args[2])
 	case "-i":
 		if len(os.Args) != 7 || os.Args[3] != "-j" || os.Args[5] != "-b" {
-			fmt.Println("Usage: ka_tim2_tool -i <input.tm2> -j <info.json> -b <target.bin>")
+			fmt.Println("Usage: ka_tim2_tool -i <input.tm2> -j <info.json> -b <target.bin> [-t <tables.json>] [-noscan]")
+			return
+		}
+		importMode(os.Args[2], os.Args[4], os.Args[6], tablePath, scan)
+	case "-topng":
+		if len(os.Args) != 3 {
+			fmt.Println("Usage: ka_tim2_tool -topng <input.tm2> [-swizzle]")
+			return
+		}
+		tim2ToPngMode(os.Args[2], swizzled)
+	case "-frompng":
+		outPath := os.Args[2]
+		if len(os.Args) == 5 && os.Args[3] == "-o" {
+			outPath = os.Args[4]
+		} else if len(os.Args) != 3 {
+			fmt.Println("Usage: ka_tim2_tool -frompng <input.tm2> [-o <output.tm2>] [-swizzle] [-dither fs|ordered|none] [-keep-palette]")
 			return
 		}
-		importMode(os.Args[2], os.Args[4], os.Args[6])
+		pngToTim2Mode(os.Args[2], outPath, swizzled, dither, keepPalette)
 	default:
-		fmt.Println("Invalid mode. Use -e for extract or -i for import")
+		fmt.Println("Invalid mode. Use -e for extract, -i for import, -topng or -frompng")
 	}
-}
\ No newline at end of file
+}
\ No newline at end of file
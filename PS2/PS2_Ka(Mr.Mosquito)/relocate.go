@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// When an imported TIM2 is not the size of the one in its slot, that TIM2 is
+// replaced and everything after it moves; whatever follows it in the slot
+// stays with it. Offsets into the moved data are then found in two ways:
+//
+//   - tables described in a JSON file passed with -t (see tableDesc);
+//   - a scan of the rest of the file for 32-bit words that hit the start of
+//     a later TIM2, the end of the slot or the end of the file. Words inside
+//     the TIM2s are skipped. Other offsets, e.g. into the data between TIM2s,
+//     are left to -t.
+//
+// Every patched word is printed so the scan can be checked; -noscan turns it
+// off when it patches something it should not.
+
+// tableFile is the -t description, with offsets in the BIN as it is before the
+// import. A resizing import writes it back with the tables' new offsets.
+//
+//	{
+//	  "align": 2048,
+//	  "tables": [
+//	    {"name": "textures", "offset": "0x40", "count": 12, "stride": 8,
+//	     "field": 0, "base": "0x0", "unit": 1, "size_field": 4}
+//	  ]
+//	}
+type tableFile struct {
+	// Align is what the size change is rounded up to, so later data stays
+	// aligned. At least 16 (the TIM2 scan step) and the largest table unit.
+	Align  int         `json:"align,omitempty"`
+	Tables []tableDesc `json:"tables"`
+}
+
+// tableDesc describes count entries of stride bytes at Offset. The 32-bit
+// word at Field in each entry holds (target - Base) / Unit; the optional
+// SizeField is the size of the block the entry points at, and is adjusted
+// when that block is the imported TIM2.
+type tableDesc struct {
+	Name      string `json:"name,omitempty"`
+	Offset    string `json:"offset"`
+	Count     int    `json:"count"`
+	Stride    int    `json:"stride"`
+	Field     int    `json:"field"`
+	Base      string `json:"base,omitempty"`
+	Unit      int    `json:"unit"`
+	SizeField *int   `json:"size_field,omitempty"`
+}
+
+// relocation is the replacement of [start, end) by a block delta bytes bigger.
+type relocation struct {
+	start, end, delta int64
+}
+
+// shift maps an offset in the old file to the new one. Offsets into the
+// replaced block stay where they are.
+func (r relocation) shift(off int64) int64 {
+	if off >= r.end {
+		return off + r.delta
+	}
+	return off
+}
+
+func parseHex(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 0, 64)
+}
+
+func readTableFile(path string) (tableFile, error) {
+	var tf tableFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return tf, fmt.Errorf("failed to read table file: %v", err)
+	}
+	if err := json.Unmarshal(data, &tf); err != nil {
+		return tf, fmt.Errorf("table file parsing error: %v", err)
+	}
+	for i, t := range tf.Tables {
+		if t.Stride == 0 {
+			tf.Tables[i].Stride = 4
+		}
+		if t.Unit == 0 {
+			tf.Tables[i].Unit = 1
+		}
+		if t.Count <= 0 || t.Field < 0 || t.Field+4 > tf.Tables[i].Stride || t.Unit < 0 {
+			return tf, fmt.Errorf("table %d (%s): bad count, stride, field or unit", i, t.Name)
+		}
+		if t.SizeField != nil && (*t.SizeField < 0 || *t.SizeField+4 > tf.Tables[i].Stride) {
+			return tf, fmt.Errorf("table %d (%s): size_field outside the entry", i, t.Name)
+		}
+	}
+	return tf, nil
+}
+
+// writeTableFile stages tf with its tables and bases moved by rel.
+func writeTableFile(w *pendingWrites, path string, tf tableFile, rel relocation) error {
+	for i := range tf.Tables {
+		t := &tf.Tables[i]
+		off, _ := parseHex(t.Offset)
+		t.Offset = fmt.Sprintf("0x%X", rel.shift(off))
+		if t.Base != "" {
+			base, _ := parseHex(t.Base)
+			t.Base = fmt.Sprintf("0x%X", rel.shift(base))
+		}
+	}
+	data, err := json.MarshalIndent(tf, "", "  ")
+	if err != nil {
+		return fmt.Errorf("table file serialization error: %v", err)
+	}
+	if err := w.add(path, data); err != nil {
+		return fmt.Errorf("failed to write table file: %v", err)
+	}
+	return nil
+}
+
+// pendingWrites are files written under temporary names next to the ones
+// they replace. Nothing is replaced before commit, so a failed import leaves
+// the BIN, its record and the -t file as they were.
+type pendingWrites []pendingWrite
+
+type pendingWrite struct{ tmp, path string }
+
+func (p *pendingWrites) add(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	*p = append(*p, pendingWrite{tmp: f.Name(), path: path})
+	return nil
+}
+
+// commit renames every staged file over its target.
+func (p pendingWrites) commit() error {
+	for _, w := range p {
+		if err := os.Rename(w.tmp, w.path); err != nil {
+			return fmt.Errorf("failed to replace %s: %v", w.path, err)
+		}
+	}
+	return nil
+}
+
+// discard removes staged files that were not committed.
+func (p pendingWrites) discard() {
+	for _, w := range p {
+		os.Remove(w.tmp)
+	}
+}
+
+// alignDelta rounds the size change up to a multiple of align, so the block
+// gets zero padding rather than being cut.
+func alignDelta(delta int64, align int) int64 {
+	a := int64(align)
+	if r := delta % a; r > 0 {
+		delta += a - r
+	} else if r < 0 {
+		delta -= r
+	}
+	return delta
+}
+
+// patchTables rewrites the described tables in out and returns the old
+// offsets of the words it handled, so the scan leaves them alone.
+func patchTables(old, out []byte, tables []tableDesc, rel relocation) (map[int64]bool, error) {
+	done := map[int64]bool{}
+	for _, t := range tables {
+		off, err := parseHex(t.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: bad offset %q", t.Name, t.Offset)
+		}
+		base, err := parseHex(t.Base)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: bad base %q", t.Name, t.Base)
+		}
+		tableEnd := off + int64(t.Count*t.Stride)
+		if off < 0 || tableEnd > int64(len(old)) {
+			return nil, fmt.Errorf("table %s: 0x%X-0x%X is outside the file", t.Name, off, tableEnd)
+		}
+		if off < rel.end && tableEnd > rel.start {
+			return nil, fmt.Errorf("table %s: overlaps the replaced TIM2", t.Name)
+		}
+
+		unit := int64(t.Unit)
+		for i := 0; i < t.Count; i++ {
+			entry := off + int64(i*t.Stride)
+			pos := entry + int64(t.Field)
+			done[pos] = true
+			v := int64(binary.LittleEndian.Uint32(old[pos:]))
+			target := base + v*unit
+			nv := rel.shift(target) - rel.shift(base)
+			if nv%unit != 0 {
+				return nil, fmt.Errorf("table %s entry %d: 0x%X is not a multiple of unit %d after the move", t.Name, i, nv, unit)
+			}
+			if nv/unit != v {
+				binary.LittleEndian.PutUint32(out[rel.shift(pos):], uint32(nv/unit))
+				fmt.Printf("  %s[%d] @0x%X: 0x%X -> 0x%X\n", t.Name, i, rel.shift(pos), v, nv/unit)
+			}
+
+			if t.SizeField != nil && target == rel.start {
+				spos := entry + int64(*t.SizeField)
+				done[spos] = true
+				sv := int64(binary.LittleEndian.Uint32(old[spos:]))
+				binary.LittleEndian.PutUint32(out[rel.shift(spos):], uint32(sv+rel.delta))
+				fmt.Printf("  %s[%d] size @0x%X: 0x%X -> 0x%X\n", t.Name, i, rel.shift(spos), sv, sv+rel.delta)
+			}
+		}
+	}
+	return done, nil
+}
+
+// scanPointers returns the old offsets of the words that point at one of
+// starts at or past the end of the replaced block. skip holds [start, end)
+// ranges not to look at.
+func scanPointers(old []byte, skip [][2]int64, starts map[int64]bool, rel relocation) []int64 {
+	n := int64(len(old)) / 4 * 4
+	skipped := make([]bool, n/4)
+	for _, s := range skip {
+		for p := s[0] &^ 3; p < s[1] && p < n; p += 4 {
+			if p >= 0 {
+				skipped[p/4] = true
+			}
+		}
+	}
+
+	var out []int64
+	for p := int64(0); p < n; p += 4 {
+		if skipped[p/4] {
+			continue
+		}
+		if v := int64(binary.LittleEndian.Uint32(old[p:])); v >= rel.end && starts[v] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// importResized replaces the TIM2 at the start of the target's slot with
+// tm2Data, keeps the rest of the slot after it, moves the rest of the file,
+// fixes offsets to it and updates the record to match. Data after the TIM2
+// in tm2Data must be that same rest of the slot, as an extracted file has it.
+// The new BIN and -t file are staged in w for the caller to commit.
+func importResized(w *pendingWrites, tm2Data []byte, binPath string, record *ExtractRecord, target int, tablePath string, scan bool) error {
+	old, err := os.ReadFile(binPath)
+	if err != nil {
+		return fmt.Errorf("failed to read target file: %v", err)
+	}
+
+	var tf tableFile
+	if tablePath != "" {
+		if tf, err = readTableFile(tablePath); err != nil {
+			return err
+		}
+	}
+	align := 16
+	if tf.Align > align {
+		align = tf.Align
+	}
+	for _, t := range tf.Tables {
+		if t.Unit > align {
+			align = t.Unit
+		}
+	}
+
+	info := record.ExtractFiles[target]
+	start, err := parseHex(info.OffsetStart)
+	if err != nil {
+		return fmt.Errorf("failed to parse start offset: %v", err)
+	}
+	end, err := parseHex(info.OffsetEnd)
+	if err != nil {
+		return fmt.Errorf("failed to parse end offset: %v", err)
+	}
+	end++
+	if start < 0 || end > int64(len(old)) || start >= end {
+		return fmt.Errorf("slot 0x%X-0x%X is outside %s", start, end, binPath)
+	}
+
+	oldTim, err := parseTIM2(old[start:end])
+	if err != nil {
+		return fmt.Errorf("slot 0x%X-0x%X: %v", start, end-1, err)
+	}
+	newTim, err := parseTIM2(tm2Data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", info.Filename, err)
+	}
+	tail := old[start+int64(oldTim.size) : end]
+	if extra := tm2Data[newTim.size:]; len(extra) > 0 && !bytes.Equal(extra, tail) {
+		return fmt.Errorf("%s has %d bytes after its TIM2 that are not the %d after the TIM2 in the slot", info.Filename, len(extra), len(tail))
+	}
+
+	rel := relocation{start: start, end: start + int64(oldTim.size)}
+	rel.delta = alignDelta(int64(newTim.size-oldTim.size), align)
+	block := make([]byte, int64(oldTim.size)+rel.delta)
+	copy(block, tm2Data[:newTim.size])
+	fmt.Printf("Resizing TIM2 0x%X-0x%X: %d -> %d bytes (%+d), %d bytes after it in the slot kept\n",
+		start, rel.end-1, oldTim.size, len(block), rel.delta, len(tail))
+
+	out := make([]byte, 0, int64(len(old))+rel.delta)
+	out = append(out, old[:start]...)
+	out = append(out, block...)
+	out = append(out, old[rel.end:]...)
+
+	done, err := patchTables(old, out, tf.Tables, rel)
+	if err != nil {
+		return err
+	}
+
+	if scan {
+		skip := [][2]int64{{start, rel.end}}
+		starts := map[int64]bool{end: true, int64(len(old)): true}
+		for _, e := range record.ExtractFiles {
+			s, err := parseHex(e.OffsetStart)
+			if err != nil || s < 0 || s >= int64(len(old)) {
+				continue
+			}
+			starts[s] = true
+			if f, err := parseTIM2(old[s:]); err == nil {
+				skip = append(skip, [2]int64{s, s + int64(f.size)})
+			}
+		}
+		for _, p := range scanPointers(old, skip, starts, rel) {
+			if done[p] {
+				continue
+			}
+			v := int64(binary.LittleEndian.Uint32(old[p:]))
+			binary.LittleEndian.PutUint32(out[rel.shift(p):], uint32(rel.shift(v)))
+			fmt.Printf("  pointer @0x%X: 0x%X -> 0x%X\n", rel.shift(p), v, rel.shift(v))
+		}
+	}
+
+	for i := range record.ExtractFiles {
+		e := &record.ExtractFiles[i]
+		s, err1 := parseHex(e.OffsetStart)
+		t, err2 := parseHex(e.OffsetEnd)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if i == target {
+			t += rel.delta
+			e.Size = int(t - s + 1)
+		} else if s >= rel.end {
+			s, t = rel.shift(s), rel.shift(t)
+		}
+		e.OffsetStart = fmt.Sprintf("0x%X", s)
+		e.OffsetEnd = fmt.Sprintf("0x%X", t)
+	}
+
+	if err := w.add(binPath, out); err != nil {
+		return fmt.Errorf("failed to write target file: %v", err)
+	}
+	if tablePath != "" {
+		return writeTableFile(w, tablePath, tf, rel)
+	}
+	return nil
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"palquant"
+	"ps2gs"
+)
+
+// TIM2 layout (little endian):
+//
+//	TIM2Header[16], padded to 128 bytes when Format is 1
+//	per picture: PictureHeader[48] [MipMapHeader] [user data] image CLUT
+//
+// The picture header counts its mipmap header and user data in HeaderSize and
+// TotalSize covers the whole picture, so pictures are walked by TotalSize.
+
+// ImageType / ClutType & 0x3F values.
+const (
+	tim2None   = 0
+	tim2RGB16  = 1 // A1B5G5R5
+	tim2RGB24  = 2 // R8G8B8
+	tim2RGB32  = 3 // R8G8B8A8, A 0-0x80
+	tim2Index4 = 4
+	tim2Index8 = 5
+)
+
+// ClutType bit 7 selects CSM2, whose entries are stored in order. CSM1
+// stores a 256 entry CLUT with entries 8-15 and 16-23 of every 32 swapped.
+const clutCSM2 = 0x80
+
+type MipMapHeader struct {
+	GsMiptbp1   uint64
+	GsMiptbp2   uint64
+	MMImageSize [8]uint32 // only the first MipMapTextures are present
+}
+
+// tim2Picture keeps slices into the file data, so encoding writes in place.
+type tim2Picture struct {
+	Header PictureHeader
+	Mip    MipMapHeader
+	levels [][]byte
+	clut   []byte
+}
+
+type tim2File struct {
+	Header   TIM2Header
+	Pictures []*tim2Picture
+	data     []byte
+	size     int // header and pictures; anything after is not TIM2
+}
+
+func parseTIM2(data []byte) (*tim2File, error) {
+	f := &tim2File{data: data}
+	if len(data) < 16 {
+		return nil, fmt.Errorf("too small for a TIM2 header")
+	}
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &f.Header)
+	if string(f.Header.MagicCode[:]) != "TIM2" {
+		return nil, fmt.Errorf("invalid TIM2 magic")
+	}
+
+	off := 16
+	if f.Header.Format == 1 {
+		off = 128
+	}
+	for i := 0; i < int(f.Header.PictureCount); i++ {
+		if off+48 > len(data) {
+			return nil, fmt.Errorf("picture %d: header at 0x%X is past the end", i, off)
+		}
+		p := &tim2Picture{}
+		binary.Read(bytes.NewReader(data[off:off+48]), binary.LittleEndian, &p.Header)
+		h := p.Header
+		imgOff := off + int(h.HeaderSize)
+		clutOff := imgOff + int(h.ImageSize)
+		if int(h.TotalSize) < int(h.HeaderSize) || off+int(h.TotalSize) > len(data) || clutOff+int(h.ClutSize) > len(data) {
+			return nil, fmt.Errorf("picture %d: sizes run past the end of the file", i)
+		}
+		if bitsPerPixel(h.ImageType) == 0 {
+			return nil, fmt.Errorf("picture %d: unsupported image type %d", i, h.ImageType)
+		}
+
+		sizes := []int{int(h.ImageSize)}
+		if h.MipMapTextures > 1 {
+			if h.MipMapTextures > 8 || off+48+16+4*int(h.MipMapTextures) > imgOff {
+				return nil, fmt.Errorf("picture %d: bad mipmap header (%d levels)", i, h.MipMapTextures)
+			}
+			r := bytes.NewReader(data[off+48:])
+			binary.Read(r, binary.LittleEndian, &p.Mip.GsMiptbp1)
+			binary.Read(r, binary.LittleEndian, &p.Mip.GsMiptbp2)
+			binary.Read(r, binary.LittleEndian, p.Mip.MMImageSize[:h.MipMapTextures])
+			sizes = sizes[:0]
+			for _, s := range p.Mip.MMImageSize[:h.MipMapTextures] {
+				sizes = append(sizes, int(s))
+			}
+		}
+		pos := imgOff
+		for l, s := range sizes {
+			w, hh := p.levelDims(l)
+			if need := (w*hh*bitsPerPixel(h.ImageType) + 7) / 8; s < need || pos+s > clutOff {
+				return nil, fmt.Errorf("picture %d level %d: %d bytes, %dx%d needs %d", i, l, s, w, hh, need)
+			}
+			p.levels = append(p.levels, data[pos:pos+s])
+			pos += s
+		}
+		p.clut = data[clutOff : clutOff+int(h.ClutSize)]
+
+		f.Pictures = append(f.Pictures, p)
+		off += int(h.TotalSize)
+	}
+	f.size = off
+	return f, nil
+}
+
+func bitsPerPixel(imageType uint8) int {
+	switch imageType {
+	case tim2RGB16:
+		return 16
+	case tim2RGB24:
+		return 24
+	case tim2RGB32:
+		return 32
+	case tim2Index4:
+		return 4
+	case tim2Index8:
+		return 8
+	}
+	return 0
+}
+
+func (p *tim2Picture) indexed() bool {
+	return p.Header.ImageType == tim2Index4 || p.Header.ImageType == tim2Index8
+}
+
+func (p *tim2Picture) levelDims(l int) (int, int) {
+	w, h := int(p.Header.ImageWidth)>>l, int(p.Header.ImageHeight)>>l
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+func (p *tim2Picture) psm() ps2gs.PSM {
+	switch p.Header.ImageType {
+	case tim2Index4:
+		return ps2gs.PSMT4
+	case tim2Index8:
+		return ps2gs.PSMT8
+	case tim2RGB16:
+		return ps2gs.PSMCT16
+	}
+	return ps2gs.PSMCT32
+}
+
+func (p *tim2Picture) String() string {
+	h := p.Header
+	s := fmt.Sprintf("%dx%d %dbit", h.ImageWidth, h.ImageHeight, bitsPerPixel(h.ImageType))
+	if p.indexed() {
+		csm := "CSM1"
+		if h.ClutType&clutCSM2 != 0 {
+			csm = "CSM2"
+		}
+		s += fmt.Sprintf(", CLUT %d x %dbit %s", h.ClutColors, bitsPerPixel(h.ClutType&0x3F), csm)
+	}
+	if len(p.levels) > 1 {
+		s += fmt.Sprintf(", %d mip levels", len(p.levels))
+	}
+	return s
+}
+
+// Colors are stored as in GS memory: A1B5G5R5, RGB, or RGBA with alpha 0-0x80.
+func decodeTIM2Color(b []byte, bits int) color.NRGBA {
+	switch bits {
+	case 16:
+		v := binary.LittleEndian.Uint16(b)
+		c := color.NRGBA{scale5to8(v), scale5to8(v >> 5), scale5to8(v >> 10), 0}
+		if v&0x8000 != 0 {
+			c.A = 255
+		}
+		return c
+	case 24:
+		return color.NRGBA{b[0], b[1], b[2], 255}
+	}
+	a := int(b[3]) * 255 / 128
+	if a > 255 {
+		a = 255
+	}
+	return color.NRGBA{b[0], b[1], b[2], uint8(a)}
+}
+
+func encodeTIM2Color(dst []byte, c color.NRGBA, bits int) {
+	switch bits {
+	case 16:
+		v := uint16(c.R>>3) | uint16(c.G>>3)<<5 | uint16(c.B>>3)<<10
+		if c.A > 127 {
+			v |= 0x8000
+		}
+		binary.LittleEndian.PutUint16(dst, v)
+	case 24:
+		dst[0], dst[1], dst[2] = c.R, c.G, c.B
+	default:
+		dst[0], dst[1], dst[2], dst[3] = c.R, c.G, c.B, uint8((int(c.A)*128+127)/255)
+	}
+}
+
+func scale5to8(v uint16) uint8 {
+	v &= 0x1F
+	return uint8(v<<3 | v>>2)
+}
+
+// clutOrder maps a palette index to the CLUT entry that holds it.
+func (p *tim2Picture) clutOrder(n int) []int {
+	order := make([]int, n)
+	idx := make([]uint32, n)
+	for i := range idx {
+		idx[i] = uint32(i)
+		order[i] = i
+	}
+	if p.Header.ClutType&clutCSM2 == 0 && n >= 256 {
+		for i, v := range ps2gs.UnswizzleCSM1_32(idx) {
+			order[i] = int(v)
+		}
+	}
+	return order
+}
+
+// clutFormat returns the CLUT entry bits and the number of colors of the
+// first CLUT, 16 or 256 for 4 or 8 bit pictures, once the CLUT is known to
+// hold them.
+func (p *tim2Picture) clutFormat() (bits, n int, err error) {
+	bits = bitsPerPixel(p.Header.ClutType & 0x3F)
+	n = 1 << bitsPerPixel(p.Header.ImageType)
+	if bits < 16 || int(p.Header.ClutColors) < n || len(p.clut) < n*bits/8 {
+		return 0, 0, fmt.Errorf("CLUT type 0x%X with %d colors does not hold %d", p.Header.ClutType, p.Header.ClutColors, n)
+	}
+	return bits, n, nil
+}
+
+// palette returns the first CLUT.
+func (p *tim2Picture) palette() (color.Palette, error) {
+	bits, n, err := p.clutFormat()
+	if err != nil {
+		return nil, err
+	}
+	pal := make(color.Palette, n)
+	for i, e := range p.clutOrder(n) {
+		pal[i] = decodeTIM2Color(p.clut[e*bits/8:], bits)
+	}
+	return pal, nil
+}
+
+// setPalette writes pal, at most as many colors as palette returns, into the
+// first CLUT. Nothing is written if the CLUT cannot hold them.
+func (p *tim2Picture) setPalette(pal color.Palette) error {
+	bits, n, err := p.clutFormat()
+	if err != nil {
+		return err
+	}
+	if len(pal) > n {
+		return fmt.Errorf("palette has %d colors, CLUT holds %d", len(pal), n)
+	}
+	order := p.clutOrder(n)
+	for i, c := range pal {
+		encodeTIM2Color(p.clut[order[i]*bits/8:], color.NRGBAModel.Convert(c).(color.NRGBA), bits)
+	}
+	return nil
+}
+
+// decode converts mip level l to an image: *image.Paletted for indexed
+// pictures, *image.NRGBA otherwise. With swizzled the data is taken to be GS
+// memory laid out for a PSMCT32 upload (not part of the TIM2 standard, but
+// some games store it that way).
+func (p *tim2Picture) decode(l int, swizzled bool) (image.Image, error) {
+	w, h := p.levelDims(l)
+	bits := bitsPerPixel(p.Header.ImageType)
+	data := p.levels[l][:(w*h*bits+7)/8]
+	if swizzled && bits != 24 {
+		var err error
+		if data, err = ps2gs.Unswizzle(data, w, h, p.psm()); err != nil {
+			return nil, err
+		}
+	}
+
+	rect := image.Rect(0, 0, w, h)
+	if p.indexed() {
+		pal, err := p.palette()
+		if err != nil {
+			return nil, err
+		}
+		img := image.NewPaletted(rect, pal)
+		for i := range img.Pix {
+			if bits == 4 {
+				img.Pix[i] = data[i/2] >> (4 * (i & 1)) & 0xF
+			} else {
+				img.Pix[i] = data[i]
+			}
+		}
+		return img, nil
+	}
+
+	img := image.NewNRGBA(rect)
+	step := bits / 8
+	for i := 0; i < w*h; i++ {
+		c := decodeTIM2Color(data[i*step:], bits)
+		copy(img.Pix[i*4:], []uint8{c.R, c.G, c.B, c.A})
+	}
+	return img, nil
+}
+
+// encode writes img into mip level l; it must have the level's size. Level 0
+// of an indexed picture also replaces the first CLUT: a paletted PNG that
+// fits is used as it is, anything else is quantised. Other levels are mapped
+// onto that CLUT. With keepPalette no level touches the CLUT; the pixels are
+// mapped onto it and the returned report counts those that missed.
+func (p *tim2Picture) encode(img image.Image, l int, swizzled bool, dither palquant.Dither, keepPalette bool) (*palquant.OffPalette, error) {
+	w, h := p.levelDims(l)
+	if img.Bounds().Dx() != w || img.Bounds().Dy() != h {
+		return nil, fmt.Errorf("PNG is %dx%d, level %d is %dx%d", img.Bounds().Dx(), img.Bounds().Dy(), l, w, h)
+	}
+	var report *palquant.OffPalette
+	bits := bitsPerPixel(p.Header.ImageType)
+	data := make([]byte, (w*h*bits+7)/8)
+
+	if p.indexed() {
+		n := 1 << bits
+		var pimg *image.Paletted
+		if l == 0 && !keepPalette {
+			if pi, ok := img.(*image.Paletted); ok && len(pi.Palette) <= n && pi.Bounds().Min == (image.Point{}) {
+				pimg = pi
+			} else {
+				var err error
+				if pimg, err = palquant.Quantize(img, palquant.Options{Colors: n, Dither: dither}); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.setPalette(pimg.Palette); err != nil {
+				return nil, err
+			}
+		} else {
+			pal, err := p.palette()
+			if err != nil {
+				return nil, err
+			}
+			if keepPalette {
+				var off palquant.OffPalette
+				pimg, off = palquant.KeepPalette(img, pal)
+				report = &off
+			} else {
+				pimg = palquant.Remap(img, pal, dither)
+			}
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				i, v := y*w+x, pimg.Pix[y*pimg.Stride+x]
+				if bits == 4 {
+					data[i/2] |= (v & 0xF) << (4 * (i & 1))
+				} else {
+					data[i] = v
+				}
+			}
+		}
+	} else {
+		step := bits / 8
+		b := img.Bounds()
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+				encodeTIM2Color(data[(y*w+x)*step:], c, bits)
+			}
+		}
+	}
+
+	if swizzled && bits != 24 {
+		var err error
+		if data, err = ps2gs.Swizzle(data, w, h, p.psm()); err != nil {
+			return nil, err
+		}
+	}
+	copy(p.levels[l], data)
+	return report, nil
+}
+
+// pngName is <base>_<picture>.png, with _mip<level> for the smaller levels.
+func pngName(base string, pic, level int) string {
+	if level == 0 {
+		return fmt.Sprintf("%s_%02d.png", base, pic)
+	}
+	return fmt.Sprintf("%s_%02d_mip%d.png", base, pic, level)
+}
+
+func tim2ToPngMode(tm2Path string, swizzled bool) {
+	data, err := os.ReadFile(tm2Path)
+	if err != nil {
+		fmt.Printf("failed to read file: %v\n", err)
+		return
+	}
+	f, err := parseTIM2(data)
+	if err != nil {
+		fmt.Printf("%s: %v\n", tm2Path, err)
+		return
+	}
+	base := strings.TrimSuffix(tm2Path, filepath.Ext(tm2Path))
+	for i, p := range f.Pictures {
+		fmt.Printf("Picture %d: %s\n", i, p)
+		for l := range p.levels {
+			img, err := p.decode(l, swizzled)
+			if err != nil {
+				fmt.Printf("  level %d: %v\n", l, err)
+				continue
+			}
+			out := pngName(base, i, l)
+			if err := writePng(out, img); err != nil {
+				fmt.Printf("  failed to write %s: %v\n", out, err)
+				continue
+			}
+			fmt.Printf("  -> %s\n", out)
+		}
+	}
+}
+
+// pngToTim2Mode re-encodes every picture and level that has a PNG named as
+// tim2ToPngMode writes them and the same size; the rest is kept byte for byte.
+// With keepPalette the heatmap of each PNG goes next to it.
+func pngToTim2Mode(tm2Path, outPath string, swizzled bool, dither palquant.Dither, keepPalette bool) {
+	data, err := os.ReadFile(tm2Path)
+	if err != nil {
+		fmt.Printf("failed to read file: %v\n", err)
+		return
+	}
+	f, err := parseTIM2(data)
+	if err != nil {
+		fmt.Printf("%s: %v\n", tm2Path, err)
+		return
+	}
+	base := strings.TrimSuffix(tm2Path, filepath.Ext(tm2Path))
+	encoded := 0
+	for i, p := range f.Pictures {
+		for l := range p.levels {
+			name := pngName(base, i, l)
+			img, err := readPng(name)
+			if os.IsNotExist(err) {
+				if l == 0 {
+					fmt.Printf("Picture %d: no %s, kept\n", i, filepath.Base(name))
+					break
+				}
+				continue
+			}
+			var report *palquant.OffPalette
+			if err == nil {
+				report, err = p.encode(img, l, swizzled, dither, keepPalette)
+			}
+			if err != nil {
+				fmt.Printf("Picture %d level %d: %v, kept\n", i, l, err)
+				if l == 0 {
+					break
+				}
+				continue
+			}
+			fmt.Printf("Picture %d level %d: encoded from %s\n", i, l, filepath.Base(name))
+			encoded++
+			if report != nil {
+				fmt.Printf("  Keep palette: %v\n", report)
+				heatPath := palquant.HeatmapPath(name)
+				if err := report.WriteHeatmap(heatPath); err != nil {
+					fmt.Printf("  failed to write %s: %v\n", heatPath, err)
+				} else if report.Pixels > 0 {
+					fmt.Printf("  Heatmap saved to %s\n", filepath.Base(heatPath))
+				}
+			}
+		}
+	}
+	if err := os.WriteFile(outPath, f.data, 0644); err != nil {
+		fmt.Printf("failed to write %s: %v\n", outPath, err)
+		return
+	}
+	fmt.Printf("Encoded %d image(s), saved to %s\n", encoded, outPath)
+}
+
+func readPng(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return png.Decode(file)
+}
+
+func writePng(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return png.Encode(file, img)
+}
@@ -14,6 +14,9 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+
+	"palquant"
+	"ps2gs"
 )
 
 var (
@@ -30,6 +33,18 @@ type texInfo struct {
 }
 
 func main() {
+	// -keep-palette may appear anywhere after the mode
+	keepPalette := false
+	args := os.Args[:1]
+	for _, a := range os.Args[1:] {
+		if a == "-keep-palette" {
+			keepPalette = true
+		} else {
+			args = append(args, a)
+		}
+	}
+	os.Args = args
+
 	if len(os.Args) < 2 {
 		usage()
 		return
@@ -70,7 +85,7 @@ func main() {
 			return
 		}
 		
-		injectPNG(pngPath, binPath, outPath, id)
+		injectPNG(pngPath, binPath, outPath, id, keepPalette)
 	default:
 		usage()
 	}
@@ -82,7 +97,8 @@ func usage() {
 	fmt.Println("\nUsage:")
 	fmt.Printf("  Scan a file       : %s -scan <file.bin>\n", exe)
 	fmt.Printf("  Extract from a dir: %s -ex <folder_path>\n", exe)
-	fmt.Printf("  Inject into a file: %s -inject <in.png> <in.bin> <tex_id> [-o <out.bin>]\n", exe)
+	fmt.Printf("  Inject into a file: %s -inject <in.png> <in.bin> <tex_id> [-o <out.bin>] [-keep-palette]\n", exe)
+	fmt.Println("\n  -keep-palette: keep the texture's CLUT, map pixels onto it and write <out>_offpal.png")
 }
 
 //扫描贴图
@@ -158,7 +174,7 @@ func batchEx(dir string) {
 }
 
 //注入图像数据
-func injectPNG(pngPath, binPath, outPath string, texID int) {
+func injectPNG(pngPath, binPath, outPath string, texID int, keepPalette bool) {
 	fmt.Printf("Injecting %s into %s (Tex ID: %d)...\n", filepath.Base(pngPath), filepath.Base(binPath), texID)
 
 	binData, err := os.ReadFile(binPath)
@@ -200,6 +216,16 @@ func injectPNG(pngPath, binPath, outPath string, texID int) {
 			img.Bounds().Dx(), img.Bounds().Dy(), t.w, t.h)
 	}
 
+	var report palquant.OffPalette
+	if keepPalette {
+		pal, err := readMstPalette(binData, t)
+		if err != nil {
+			log.Fatalf("Error: Could not read texture palette: %v", err)
+		}
+		img, report = palquant.KeepPalette(img, pal)
+		fmt.Printf("  Keeping the original palette (%d colors).\n", len(pal))
+	}
+
 	rawPx, rawPal, err := pngToMst(img, t.bpp)
 	if err != nil {
 		log.Fatalf("Error: Failed to convert png to mst: %v", err)
@@ -215,7 +241,9 @@ func injectPNG(pngPath, binPath, outPath string, texID int) {
 		log.Fatalf("Error: Palette size mismatch (got %d, want %d)", len(rawPal), expectedPalSize)
 	}
 
-	copy(modData[t.pal:], rawPal)
+	if !keepPalette {
+		copy(modData[t.pal:], rawPal)
+	}
 	copy(modData[t.px:], rawPx)
 	
 	if err := os.WriteFile(outPath, modData, 0644); err != nil {
@@ -227,6 +255,17 @@ func injectPNG(pngPath, binPath, outPath string, texID int) {
 	} else {
 		fmt.Printf("Success! Injected data saved to %s\n", filepath.Base(outPath))
 	}
+
+	if keepPalette {
+		fmt.Println("  Keep palette:", report)
+		if report.Pixels > 0 {
+			heatPath := palquant.HeatmapPath(outPath)
+			if err := report.WriteHeatmap(heatPath); err != nil {
+				log.Fatalf("Error: Failed to write heatmap: %v", err)
+			}
+			fmt.Printf("  Heatmap saved to %s\n", filepath.Base(heatPath))
+		}
+	}
 }
 
 
@@ -311,27 +350,16 @@ func savePNG(data []byte, t texInfo, srcPath string) error {
 	rawPx := data[t.px : t.px+pxSize]
 
 	var finalPx []byte
+	var err error
 	if t.bpp == 8 {
-		finalPx = Unswizzle8(rawPx, int(t.w), int(t.h))
+		finalPx, err = ps2gs.Unswizzle(rawPx, int(t.w), int(t.h), ps2gs.PSMT8)
 	} else {
-		finalPx = Unswizzle4By8(rawPx, int(t.w), int(t.h))
-	}
-
-	numColors := 1 << t.bpp
-	palSize := numColors * 4
-	if t.pal+palSize > len(data) { return fmt.Errorf("palette data out of bounds") }
-	rawPal := data[t.pal : t.pal+palSize]
-
-	u32Pal := make([]uint32, numColors)
-	for i := 0; i < numColors; i++ {
-		u32Pal[i] = binary.LittleEndian.Uint32(rawPal[i*4 : i*4+4])
+		finalPx, err = ps2gs.Unswizzle4By8(rawPx, int(t.w), int(t.h))
 	}
-	unswizzledPal := UnswizzleCSM1_32(u32Pal)
+	if err != nil { return err }
 
-	goPal := make(color.Palette, numColors)
-	for i, v := range unswizzledPal {
-		goPal[i] = decodeRGBA8888(v, true)
-	}
+	goPal, err := readMstPalette(data, t)
+	if err != nil { return err }
 	
 	img := image.NewPaletted(image.Rect(0, 0, int(t.w), int(t.h)), goPal)
 	if t.bpp == 8 {
@@ -356,6 +384,26 @@ func savePNG(data []byte, t texInfo, srcPath string) error {
 	return png.Encode(f, img)
 }
 
+// readMstPalette decodes the CSM1 ordered RGBA8888 CLUT of a texture.
+func readMstPalette(data []byte, t texInfo) (color.Palette, error) {
+	numColors := 1 << t.bpp
+	palSize := numColors * 4
+	if t.pal+palSize > len(data) { return nil, fmt.Errorf("palette data out of bounds") }
+	rawPal := data[t.pal : t.pal+palSize]
+
+	u32Pal := make([]uint32, numColors)
+	for i := 0; i < numColors; i++ {
+		u32Pal[i] = binary.LittleEndian.Uint32(rawPal[i*4 : i*4+4])
+	}
+	unswizzledPal := ps2gs.UnswizzleCSM1_32(u32Pal)
+
+	goPal := make(color.Palette, numColors)
+	for i, v := range unswizzledPal {
+		goPal[i] = decodeRGBA8888(v, true)
+	}
+	return goPal, nil
+}
+
 func pngToMst(img image.Image, bpp int) (pixels []byte, palette []byte, err error) {
 	palettedImg, ok := img.(*image.Paletted)
 	if !ok {
@@ -384,7 +432,7 @@ func pngToMst(img image.Image, bpp int) (pixels []byte, palette []byte, err erro
 		}
 	}
 	
-	swizzledPal := SwizzleCSM1_32(linearPal)
+	swizzledPal := ps2gs.SwizzleCSM1_32(linearPal)
 	
 	palette = make([]byte, numColors*4)
 	for i, v := range swizzledPal {
@@ -393,7 +441,7 @@ func pngToMst(img image.Image, bpp int) (pixels []byte, palette []byte, err erro
 
 	linearPx := palettedImg.Pix
 	if bpp == 8 {
-		pixels = Swizzle8(linearPx, palettedImg.Bounds().Dx(), palettedImg.Bounds().Dy())
+		pixels, err = ps2gs.Swizzle(linearPx, palettedImg.Bounds().Dx(), palettedImg.Bounds().Dy(), ps2gs.PSMT8)
 	} else {
 		packedPx := make([]byte, len(linearPx)/2)
 		for i := 0; i < len(packedPx); i++ {
@@ -404,8 +452,9 @@ func pngToMst(img image.Image, bpp int) (pixels []byte, palette []byte, err erro
 			}
 			packedPx[i] = p1 | (p2 << 4)
 		}
-		pixels = Swizzle4By8(packedPx, palettedImg.Bounds().Dx(), palettedImg.Bounds().Dy())
+		pixels, err = ps2gs.Swizzle4By8(packedPx, palettedImg.Bounds().Dx(), palettedImg.Bounds().Dy())
 	}
+	if err != nil { return nil, nil, err }
 	
 	return pixels, palette, nil
 }
\ No newline at end of file
@@ -12,6 +12,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"ps2gs"
 )
 
 const (
@@ -129,7 +131,7 @@ func ripShana(src, dst string) bool {
 	for i := 0; i < 256; i++ {
 		u32Pal[i] = binary.LittleEndian.Uint32(rawPal[i*4 : i*4+4])
 	}
-	u32Pal = UnswizzleCSM1_32(u32Pal) //应用CSM1swizlle
+	u32Pal = ps2gs.UnswizzleCSM1_32(u32Pal) //应用CSM1swizlle
 	goPal := make(color.Palette, 256)
 	for i, v := range u32Pal {
 		goPal[i] = decodeRGBA8888(v, "ps2")
@@ -10,15 +10,22 @@ import (
 	"image/png"
 	"log"
 	"os"
+
+	"palquant"
+	"ps2gs"
 )
 
 func main() {
 	var pngPath, refPath, outPath string
 	var colorCount int
+	var ditherName string
+	var keepPalette bool
 	flag.StringVar(&pngPath, "i", "", "modified png file")
 	flag.StringVar(&refPath, "ref", "", "original .obj template")
 	flag.StringVar(&outPath, "o", "", "output .obj file")
 	flag.IntVar(&colorCount, "c", 0, "colors (16-256). 0 for auto-search.")
+	flag.StringVar(&ditherName, "dither", "fs", "dithering: none, fs, ordered")
+	flag.BoolVar(&keepPalette, "keep-palette", false, "keep the CLUT of -ref, map pixels onto it and write <o>_offpal.png")
 	flag.Parse()
 
 	if pngPath == "" || refPath == "" || outPath == "" {
@@ -28,15 +35,23 @@ func main() {
 		return
 	}
 
+	dither, err := palquant.ParseDither(ditherName)
+	if err != nil {
+		log.Fatal(err)
+	}
 	refData, err := os.ReadFile(refPath)
 	if err != nil {
 		log.Fatal("Read Ref Error:", err)
 	}
 	targetLimit := len(refData)
 
-	if colorCount > 0 {
+	if keepPalette {
+		fmt.Println("Keep Palette Mode: mapping onto the CLUT of the template...")
+		_, effSize := packShana(pngPath, refData, outPath, 256, dither, true, true)
+		printResult(effSize, targetLimit)
+	} else if colorCount > 0 {
 		fmt.Printf("Manual Mode: Testing %d colors...\n", colorCount)
-		_, effSize := packShana(pngPath, refData, outPath, colorCount, true)
+		_, effSize := packShana(pngPath, refData, outPath, colorCount, dither, false, true)
 		printResult(effSize, targetLimit)
 	} else {
 		fmt.Println("Oracle Mode: Searching for the optimal color count...")
@@ -47,7 +62,7 @@ func main() {
 		for low <= high {
 			mid := (low + high) / 2
 			fmt.Printf("  Testing %d colors... ", mid)
-			isValid, effSize := packShana(pngPath, refData, outPath, mid, false)
+			isValid, effSize := packShana(pngPath, refData, outPath, mid, dither, false, false)
 			
 			if isValid && effSize <= targetLimit {
 				fmt.Printf("SUCCESS (%d bytes)\n", effSize)
@@ -61,7 +76,7 @@ func main() {
 		}
 
 		fmt.Printf("\n Optimal color count is %d\n", bestC)
-		packShana(pngPath, refData, outPath, bestC, true)
+		packShana(pngPath, refData, outPath, bestC, dither, false, true)
 		printResult(finalEffSize, targetLimit)
 	}
 }
@@ -75,7 +90,7 @@ func printBanner() {
 
 func printUsage() {
 	fmt.Println("\n用法 / Usage:")
-	fmt.Println("  shana_tx_inject -i mod.png -ref orig.obj -o new.obj [-c 256]")
+	fmt.Println("  shana_tx_inject -i mod.png -ref orig.obj -o new.obj [-c 256] [-dither fs|ordered|none] [-keep-palette]")
 	fmt.Println("\n这是一个命令行工具，请在终端中使用。")
 	fmt.Println("This is a command-line tool, please use it in terminal.")
 }
@@ -85,7 +100,7 @@ func waitForEnter() {
 	fmt.Scanln()
 }
 
-func packShana(pngPath string, refData []byte, outPath string, nColors int, verbose bool) (bool, int) {
+func packShana(pngPath string, refData []byte, outPath string, nColors int, dither palquant.Dither, keepPalette, verbose bool) (bool, int) {
 	
 	secOff := 0x400
 	isAllZero := true
@@ -104,11 +119,38 @@ func packShana(pngPath string, refData []byte, outPath string, nColors int, verb
 	//量化与解码PNG
 	pngRaw, err := os.ReadFile(pngPath)
 	if err != nil { return false, 999999 }
-	qData, err := Quantize(pngRaw, nColors)
-	if err != nil { return false, 999999 }
-	img, err := png.Decode(bytes.NewReader(qData))
-	if err != nil { return false, 999999 }
-	palImg := img.(*image.Paletted)
+	var palImg *image.Paletted
+	if keepPalette {
+		//沿用模板调色板
+		img, err := png.Decode(bytes.NewReader(pngRaw))
+		if err != nil { return false, 999999 }
+		u32Pal := make([]uint32, 256)
+		for i := range u32Pal {
+			u32Pal[i] = binary.LittleEndian.Uint32(refData[i*4:])
+		}
+		goPal := make(color.Palette, 256)
+		for i, v := range ps2gs.UnswizzleCSM1_32(u32Pal) {
+			goPal[i] = decodeRGBA8888(v, "ps2")
+		}
+		var report palquant.OffPalette
+		palImg, report = palquant.KeepPalette(img, goPal)
+		if verbose {
+			fmt.Println("Keep palette:", report)
+			if report.Pixels > 0 {
+				heatPath := palquant.HeatmapPath(outPath)
+				if err := report.WriteHeatmap(heatPath); err != nil {
+					log.Fatal("Heatmap Error:", err)
+				}
+				fmt.Println("Heatmap saved:", heatPath)
+			}
+		}
+	} else {
+		qData, err := Quantize(pngRaw, nColors, dither)
+		if err != nil { return false, 999999 }
+		img, err := png.Decode(bytes.NewReader(qData))
+		if err != nil { return false, 999999 }
+		palImg = img.(*image.Paletted)
+	}
 
 	// RGBA8888 + CSM1
 	u32Pal := make([]uint32, 256)
@@ -120,7 +162,7 @@ func packShana(pngPath string, refData []byte, outPath string, nColors int, verb
 			u32Pal[i] = 0
 		}
 	}
-	u32Pal = SwizzleCSM1_32(u32Pal)
+	u32Pal = ps2gs.SwizzleCSM1_32(u32Pal)
 	palBuf := new(bytes.Buffer)
 	for _, v := range u32Pal {
 		binary.Write(palBuf, binary.LittleEndian, v)
@@ -164,7 +206,9 @@ func packShana(pngPath string, refData []byte, outPath string, nColors int, verb
 	//拷贝头部替换调色板
 	header := make([]byte, secOff)
 	copy(header, refData[:secOff])
-	copy(header[0:1024], palBuf.Bytes())
+	if !keepPalette {
+		copy(header[0:1024], palBuf.Bytes())
+	}
 	final.Write(header)
 
 	//写入索引表
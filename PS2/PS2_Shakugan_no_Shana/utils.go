@@ -2,14 +2,13 @@ package main
 
 import (
 	"bytes"
-	"fmt"
 	"image"
 	"image/color"
 	"image/png"
 	"math"
-	"os"
-	"os/exec"
 	"sort"
+
+	"palquant"
 )
 
 
@@ -178,25 +177,12 @@ func imageToIndexed(img image.Image, pal []color.RGBA) []uint8 {
 }
 
 // ===========================================================================
-// Part 4: Helpers & PNGQuant
+// Part 4: Helpers & 量化
 // ===========================================================================
 
-func Quantize(rawPng []byte, nColors int) ([]byte, error) {
-	exeName := "pngquant"
-	if _, err := os.Stat("pngquant.exe"); err == nil {
-		exeName = ".\\pngquant.exe"
-	}
-	cmd := exec.Command(exeName, fmt.Sprintf("%d", nColors), "-")
-	cmd.Stdin = bytes.NewReader(rawPng)
-	var outBuf bytes.Buffer
-	var errBuf bytes.Buffer
-	cmd.Stdout = &outBuf
-	cmd.Stderr = &errBuf
-	
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("%v (Stderr: %s)", err, errBuf.String())
-	}
-	return outBuf.Bytes(), nil
+// Quantize reduces a PNG to nColors, returned as an indexed PNG.
+func Quantize(rawPng []byte, nColors int, dither palquant.Dither) ([]byte, error) {
+	return palquant.QuantizePNG(rawPng, palquant.Options{Colors: nColors, Dither: dither})
 }
 
 func ImgToBytes(img image.Image) []byte {
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// BMFont descriptors in the text and the XML flavour share the same tags and
+// key=value attributes, one tag per line:
+//
+//	common lineHeight=16 base=13 scaleW=256 scaleH=256 pages=1
+//	page id=0 file="font_0.png"
+//	char id=65 x=10 y=0 width=9 height=11 xoffset=0 yoffset=2 xadvance=10 page=0 chnl=15
+type bmChar struct {
+	id, x, y, w, h   int
+	xoff, yoff, xadv int
+	page             int
+}
+
+type bmFont struct {
+	lineHeight, base int
+	pages            map[int]string
+	chars            []bmChar
+}
+
+var bmAttr = regexp.MustCompile(`(\w+)=("[^"]*"|\S+)`)
+
+func readBMFont(path string) (*bmFont, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("BMF")) {
+		return nil, fmt.Errorf("binary BMFont is not supported, export as text or XML")
+	}
+
+	bm := &bmFont{pages: map[int]string{}}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		line = strings.TrimPrefix(strings.TrimSuffix(strings.TrimSuffix(line, ">"), "/"), "<")
+		tag, _, _ := strings.Cut(line, " ")
+
+		attrs := map[string]string{}
+		for _, m := range bmAttr.FindAllStringSubmatch(line, -1) {
+			attrs[m[1]] = strings.Trim(m[2], `"`)
+		}
+		num := func(key string) int {
+			n, _ := strconv.Atoi(attrs[key])
+			return n
+		}
+
+		switch tag {
+		case "common":
+			bm.lineHeight, bm.base = num("lineHeight"), num("base")
+		case "page":
+			bm.pages[num("id")] = attrs["file"]
+		case "char":
+			bm.chars = append(bm.chars, bmChar{
+				id: num("id"), x: num("x"), y: num("y"), w: num("width"), h: num("height"),
+				xoff: num("xoffset"), yoff: num("yoffset"), xadv: num("xadvance"), page: num("page"),
+			})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if bm.lineHeight <= 0 || len(bm.chars) == 0 {
+		return nil, fmt.Errorf("%s: no common lineHeight or no chars", path)
+	}
+	return bm, nil
+}
+
+// bmGlyphs cuts every BMFont glyph into a cell of at least one line height,
+// placed like the TTF glyphs: the bearing is the cell top relative to the
+// baseline, -base for a cell that starts at the line top. The cell grows up
+// and down to hold bitmaps that stick out of the line (descenders, accents)
+// and grows left for a negative xoffset; the FNT has no horizontal bearing, so
+// such a glyph advances by the extra width. The cell is as wide as the advance
+// or the bitmap, whichever is wider. The line height is returned as the
+// physical size. With a chars file only those characters are kept.
+func bmGlyphs(fntPath, charsPath string) ([]glyph, int, error) {
+	bm, err := readBMFont(fntPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var want map[rune]bool
+	if charsPath != "" {
+		txtData, err := os.ReadFile(charsPath)
+		if err != nil {
+			return nil, 0, err
+		}
+		want = map[rune]bool{}
+		for _, r := range string(txtData) {
+			if r >= 0x20 && r != '\n' && r != '\r' && r != '\t' {
+				want[r] = true
+			}
+		}
+	}
+
+	pages := map[int]image.Image{}
+	for id, name := range bm.pages {
+		f, err := os.Open(filepath.Join(filepath.Dir(fntPath), name))
+		if err != nil {
+			return nil, 0, err
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", name, err)
+		}
+		pages[id] = img
+	}
+
+	var glyphs []glyph
+	found := map[rune]bool{}
+	for _, c := range bm.chars {
+		r := rune(c.id)
+		if c.id < 0x20 || (want != nil && !want[r]) {
+			continue
+		}
+		src, ok := pages[c.page]
+		if !ok {
+			return nil, 0, fmt.Errorf("char %d: missing page %d", c.id, c.page)
+		}
+		left, top := min(0, c.xoff), min(0, c.yoff)
+		right, bottom := max(c.xadv, c.xoff+c.w), max(bm.lineHeight, c.yoff+c.h)
+		w, h := right-left, bottom-top
+		if w <= 0 {
+			w = 1
+		}
+
+		cell := image.NewNRGBA(image.Rect(0, 0, w, h))
+		sr := image.Rect(c.x, c.y, c.x+c.w, c.y+c.h).Add(src.Bounds().Min)
+		dr := image.Rect(c.xoff, c.yoff, c.xoff+c.w, c.yoff+c.h).Sub(image.Pt(left, top))
+		xdraw.Draw(cell, dr, src, sr.Min, xdraw.Src)
+
+		found[r] = true
+		glyphs = append(glyphs, glyph{
+			r: r, code: uint32(c.id), w: w, h: h,
+			bear: float32(top - bm.base), isCJK: c.id > 0x7E, cell: cell,
+		})
+	}
+	for r := range want {
+		if !found[r] {
+			fmt.Printf("[!] BMFont has no glyph for U+%04X %q\n", r, r)
+		}
+	}
+	return glyphs, bm.lineHeight, nil
+}
+
+// drawBitmapAtlas pastes the BMFont cells; the HD companion (mul > 1) is a
+// nearest-neighbour enlargement so hand-tuned pixels stay sharp.
+func drawBitmapAtlas(glyphs []glyph, texW, texH, mul int, outName string) {
+	img := image.NewNRGBA(image.Rect(0, 0, texW*mul, texH*mul))
+	for _, g := range glyphs {
+		dr := image.Rect(g.tx*mul, g.ty*mul, (g.tx+g.w)*mul, (g.ty+g.h)*mul)
+		xdraw.NearestNeighbor.Scale(img, dr, g.cell, g.cell.Bounds(), xdraw.Src, nil)
+	}
+
+	pngF, _ := os.Create(outName + ".png")
+	png.Encode(pngF, img)
+	pngF.Close()
+	fmt.Printf("[+] Atlas Saved: %s.png (%dx%d, BMFont x%d)\n", outName, texW*mul, texH*mul, mul)
+}
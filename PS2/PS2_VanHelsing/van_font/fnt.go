@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// P2 FNT layout (little endian):
+//
+//	"P2" count[2] lineHeight[f4] baseHeight[f4] baseWidth[f4] spacing[f4]
+//	count * { code[4] unk0[f4] width[f4] height[f4] unk[f4] bearing[f4] u0 u1 v0 v1 [f4] }
+//
+// Width, height and bearing are in game units, the UVs are normalised to the
+// atlas. unk0 is 0 in the original fonts; what the engine does with it is not
+// known. Only -multipage output puts the atlas page index there.
+type fntGlyph struct {
+	Code    uint32  `json:"code"`
+	Char    string  `json:"char"`
+	Unk0    float32 `json:"unk0"`
+	Width   float32 `json:"width"`
+	Height  float32 `json:"height"`
+	Unk     float32 `json:"unk"`
+	Bearing float32 `json:"bearing"`
+	U0      float32 `json:"u0"`
+	U1      float32 `json:"u1"`
+	V0      float32 `json:"v0"`
+	V1      float32 `json:"v1"`
+}
+
+type fntFile struct {
+	LineHeight float32    `json:"lineHeight"`
+	BaseHeight float32    `json:"baseHeight"`
+	BaseWidth  float32    `json:"baseWidth"`
+	Spacing    float32    `json:"spacing"`
+	Glyphs     []fntGlyph `json:"glyphs"`
+}
+
+const fntRecordSize = 4 + 9*4
+
+func readFNT(path string) (*fntFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 20 || data[0] != 'P' || data[1] != '2' {
+		return nil, fmt.Errorf("%s: not a P2 FNT", path)
+	}
+	count := int(binary.LittleEndian.Uint16(data[2:4]))
+	if len(data) < 20+count*fntRecordSize {
+		return nil, fmt.Errorf("%s: %d glyphs need %d bytes, file has %d", path, count, 20+count*fntRecordSize, len(data))
+	}
+
+	r := bytes.NewReader(data[4:])
+	var hdr [4]float32
+	binary.Read(r, binary.LittleEndian, &hdr)
+	fnt := &fntFile{LineHeight: hdr[0], BaseHeight: hdr[1], BaseWidth: hdr[2], Spacing: hdr[3]}
+	for i := 0; i < count; i++ {
+		var code uint32
+		var v [9]float32
+		binary.Read(r, binary.LittleEndian, &code)
+		binary.Read(r, binary.LittleEndian, &v)
+		fnt.Glyphs = append(fnt.Glyphs, fntGlyph{
+			Code: code, Char: string(rune(code)),
+			Unk0: v[0], Width: v[1], Height: v[2], Unk: v[3], Bearing: v[4],
+			U0: v[5], U1: v[6], V0: v[7], V1: v[8],
+		})
+	}
+	return fnt, nil
+}
+
+func writeFNT(path string, fnt *fntFile) error {
+	var buf bytes.Buffer
+	buf.WriteString("P2")
+	binary.Write(&buf, binary.LittleEndian, uint16(len(fnt.Glyphs)))
+	binary.Write(&buf, binary.LittleEndian, []float32{fnt.LineHeight, fnt.BaseHeight, fnt.BaseWidth, fnt.Spacing})
+	for _, g := range fnt.Glyphs {
+		binary.Write(&buf, binary.LittleEndian, g.Code)
+		binary.Write(&buf, binary.LittleEndian, []float32{g.Unk0, g.Width, g.Height, g.Unk, g.Bearing, g.U0, g.U1, g.V0, g.V1})
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func (f *fntFile) glyph(code uint32) *fntGlyph {
+	for i := range f.Glyphs {
+		if f.Glyphs[i].Code == code {
+			return &f.Glyphs[i]
+		}
+	}
+	return nil
+}
+
+// dumpFNT prints the header and writes all metrics to jsonPath.
+func dumpFNT(fnt *fntFile, jsonPath string) error {
+	fmt.Printf("[*] LineHeight %.2f  BaseHeight %.2f  BaseWidth %.2f  Spacing %.2f  Glyphs %d\n",
+		fnt.LineHeight, fnt.BaseHeight, fnt.BaseWidth, fnt.Spacing, len(fnt.Glyphs))
+	data, err := json.MarshalIndent(fnt, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(jsonPath, data, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("[+] Metrics Saved: %s\n", jsonPath)
+	return nil
+}
+
+// compareFNT prints how b differs from a: header values, missing glyphs and
+// glyphs whose size or bearing changed.
+func compareFNT(a, b *fntFile) {
+	hdr := func(name string, x, y float32) {
+		if x != y {
+			fmt.Printf("  %-10s %.2f -> %.2f\n", name, x, y)
+		}
+	}
+	hdr("LineHeight", a.LineHeight, b.LineHeight)
+	hdr("BaseHeight", a.BaseHeight, b.BaseHeight)
+	hdr("BaseWidth", a.BaseWidth, b.BaseWidth)
+	hdr("Spacing", a.Spacing, b.Spacing)
+
+	missing, changed := 0, 0
+	for _, ga := range a.Glyphs {
+		gb := b.glyph(ga.Code)
+		if gb == nil {
+			missing++
+			continue
+		}
+		if ga.Width != gb.Width || ga.Height != gb.Height || ga.Bearing != gb.Bearing {
+			changed++
+			if changed <= 20 {
+				fmt.Printf("  U+%04X %q  w %.2f -> %.2f  h %.2f -> %.2f  bearing %.2f -> %.2f\n",
+					ga.Code, ga.Char, ga.Width, gb.Width, ga.Height, gb.Height, ga.Bearing, gb.Bearing)
+			}
+		}
+	}
+	fmt.Printf("[*] %d glyphs vs %d, %d missing from the second, %d with different metrics\n",
+		len(a.Glyphs), len(b.Glyphs), missing, changed)
+}
+
+// renderPreview lays out text the way the FNT describes it: every glyph is
+// scaled from its atlas rectangle to width x height game units, its top sits
+// at baseline + bearing and the pen advances by width + spacing. For
+// -multipage output unk0 is taken as the page, read from pageName(atlas, p).
+func renderPreview(fnt *fntFile, atlasPath, text, outPath string) error {
+	ext := filepath.Ext(atlasPath)
+	base := strings.TrimSuffix(atlasPath, ext)
+	pages := map[int]image.Image{}
+	atlas := func(p int) (image.Image, error) {
+		if img, ok := pages[p]; ok {
+			return img, nil
+		}
+		f, err := os.Open(pageName(base, p) + ext)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		img, err := png.Decode(f)
+		if err != nil {
+			return nil, err
+		}
+		pages[p] = img
+		return img, nil
+	}
+
+	ascent := float32(0)
+	for _, g := range fnt.Glyphs {
+		if -g.Bearing > ascent {
+			ascent = -g.Bearing
+		}
+	}
+
+	// measure first
+	lines := strings.Split(strings.ReplaceAll(text, "\\n", "\n"), "\n")
+	width := float32(0)
+	for _, line := range lines {
+		x := float32(0)
+		for _, r := range line {
+			if g := fnt.glyph(uint32(r)); g != nil {
+				x += g.Width + fnt.Spacing
+			}
+		}
+		if x > width {
+			width = x
+		}
+	}
+	margin := 8
+	imgW := int(math.Ceil(float64(width))) + margin*2
+	imgH := int(math.Ceil(float64(fnt.LineHeight)*float64(len(lines)-1)+float64(ascent)+float64(fnt.BaseHeight))) + margin*2
+	dst := image.NewRGBA(image.Rect(0, 0, imgW, imgH))
+	xdraw.Draw(dst, dst.Bounds(), &image.Uniform{color.RGBA{0x20, 0x20, 0x40, 0xff}}, image.Point{}, xdraw.Src)
+
+	var missing []rune
+	seen := map[rune]bool{}
+	for li, line := range lines {
+		baseY := float32(margin) + ascent + fnt.LineHeight*float32(li)
+		x := float32(margin)
+		for _, r := range line {
+			g := fnt.glyph(uint32(r))
+			if g == nil {
+				if !seen[r] {
+					seen[r] = true
+					missing = append(missing, r)
+				}
+				continue
+			}
+			src, err := atlas(int(g.Unk0))
+			if err != nil {
+				return err
+			}
+			b := src.Bounds()
+			sr := image.Rect(
+				int(math.Round(float64(g.U0)*float64(b.Dx()))), int(math.Round(float64(g.V0)*float64(b.Dy()))),
+				int(math.Round(float64(g.U1)*float64(b.Dx()))), int(math.Round(float64(g.V1)*float64(b.Dy()))),
+			)
+			top := baseY + g.Bearing
+			dr := image.Rect(int(x), int(top), int(x+g.Width+0.5), int(top+g.Height+0.5))
+			xdraw.BiLinear.Scale(dst, dr, src, sr.Add(b.Min), xdraw.Over, nil)
+			x += g.Width + fnt.Spacing
+		}
+	}
+	for _, r := range missing {
+		fmt.Printf("[!] No glyph for U+%04X %q\n", r, r)
+	}
+
+	f, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := png.Encode(f, dst); err != nil {
+		return err
+	}
+	fmt.Printf("[+] Preview Saved: %s (%dx%d)\n", outPath, imgW, imgH)
+	return nil
+}
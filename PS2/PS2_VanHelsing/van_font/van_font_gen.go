@@ -1,14 +1,15 @@
 package main
 
 import (
-	"encoding/binary"
 	"flag"
 	"fmt"
 	"image"
 	"image/draw"
 	"image/png"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/opentype"
@@ -22,10 +23,16 @@ type glyph struct {
 	bear   float32
 	isCJK  bool
 	tx, ty int
+	page   int
+	cell   image.Image // BMFont import: the glyph's line box, drawn as is
 }
 
  
 type Rect struct{ x, y, w, h int }
+
+// BinPacker is a MaxRects packer: it keeps every maximal free rectangle and
+// places each glyph where it leaves the shortest leftover side (best short
+// side fit), which wastes far less space than a single guillotine split.
 type BinPacker struct {
 	freeRects     []Rect
 	width, height int
@@ -34,30 +41,130 @@ type BinPacker struct {
 func NewBinPacker(w, h int) *BinPacker {
 	return &BinPacker{freeRects: []Rect{{0, 0, w, h}}, width: w, height: h}
 }
+
 func (bp *BinPacker) Insert(w, h int) (int, int, bool) {
-	bestIdx, bestY, bestX := -1, bp.height+1, bp.width+1
+	bestIdx := -1
+	bestShort, bestLong := bp.width+bp.height, bp.width+bp.height
 	for i, r := range bp.freeRects {
-		if r.w >= w && r.h >= h {
-			if r.y < bestY || (r.y == bestY && r.x < bestX) {
-				bestY, bestX, bestIdx = r.y, r.x, i
+		if r.w < w || r.h < h {
+			continue
+		}
+		short, long := r.w-w, r.h-h
+		if short > long {
+			short, long = long, short
+		}
+		better := short < bestShort || (short == bestShort && long < bestLong)
+		if !better && short == bestShort && long == bestLong {
+			b := bp.freeRects[bestIdx]
+			better = r.y < b.y || (r.y == b.y && r.x < b.x)
+		}
+		if better {
+			bestIdx, bestShort, bestLong = i, short, long
+		}
+	}
+	if bestIdx == -1 {
+		return 0, 0, false
+	}
+
+	used := Rect{bp.freeRects[bestIdx].x, bp.freeRects[bestIdx].y, w, h}
+	var next []Rect
+	for _, r := range bp.freeRects {
+		if used.x >= r.x+r.w || used.x+used.w <= r.x || used.y >= r.y+r.h || used.y+used.h <= r.y {
+			next = append(next, r)
+			continue
+		}
+		if used.x > r.x {
+			next = append(next, Rect{r.x, r.y, used.x - r.x, r.h})
+		}
+		if used.x+used.w < r.x+r.w {
+			next = append(next, Rect{used.x + used.w, r.y, r.x + r.w - used.x - used.w, r.h})
+		}
+		if used.y > r.y {
+			next = append(next, Rect{r.x, r.y, r.w, used.y - r.y})
+		}
+		if used.y+used.h < r.y+r.h {
+			next = append(next, Rect{r.x, used.y + used.h, r.w, r.y + r.h - used.y - used.h})
+		}
+	}
+
+	// drop free rectangles that lie inside another one
+	bp.freeRects = bp.freeRects[:0]
+	for i, a := range next {
+		contained := false
+		for j, b := range next {
+			if i != j && a.x >= b.x && a.y >= b.y && a.x+a.w <= b.x+b.w && a.y+a.h <= b.y+b.h &&
+				(a != b || i > j) {
+				contained = true
+				break
 			}
 		}
+		if !contained {
+			bp.freeRects = append(bp.freeRects, a)
+		}
 	}
-	if bestIdx == -1 { return 0, 0, false }
-	node := bp.freeRects[bestIdx]
-	bp.freeRects = append(bp.freeRects[:bestIdx], bp.freeRects[bestIdx+1:]...)
-	wLeft, hLeft := node.w-w, node.h-h
-	var r1, r2 Rect
-	if wLeft > hLeft {
-		r1 = Rect{node.x, node.y + h, w, hLeft}
-		r2 = Rect{node.x + w, node.y, wLeft, node.h}
-	} else {
-		r1 = Rect{node.x + w, node.y, wLeft, h}
-		r2 = Rect{node.x, node.y + h, node.w, hLeft}
+	return used.x, used.y, true
+}
+
+// packPages places the glyphs on as many texW x texH pages as needed and
+// returns the page count.
+func packPages(glyphs []glyph, texW, texH, pad int) (int, error) {
+	packers := []*BinPacker{NewBinPacker(texW, texH)}
+	for i := range glyphs {
+		if glyphs[i].w+pad > texW || glyphs[i].h+pad > texH {
+			return 0, fmt.Errorf("glyph U+%04X (%dx%d) larger than the texture", glyphs[i].code, glyphs[i].w, glyphs[i].h)
+		}
+		placed := false
+		for p, bp := range packers {
+			if x, y, ok := bp.Insert(glyphs[i].w+pad, glyphs[i].h+pad); ok {
+				glyphs[i].tx, glyphs[i].ty, glyphs[i].page = x, y, p
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			bp := NewBinPacker(texW, texH)
+			packers = append(packers, bp)
+			x, y, _ := bp.Insert(glyphs[i].w+pad, glyphs[i].h+pad)
+			glyphs[i].tx, glyphs[i].ty, glyphs[i].page = x, y, len(packers)-1
+		}
 	}
-	if r1.w > 0 && r1.h > 0 { bp.freeRects = append(bp.freeRects, r1) }
-	if r2.w > 0 && r2.h > 0 { bp.freeRects = append(bp.freeRects, r2) }
-	return bestX, bestY, true
+	return len(packers), nil
+}
+
+// fitSize returns the smallest power-of-two texture (by area, then the
+// wider one) that holds all glyphs on a single page.
+func fitSize(glyphs []glyph, pad, maxDim int) (int, int, bool) {
+	type size struct{ w, h int }
+	var sizes []size
+	for w := 64; w <= maxDim; w *= 2 {
+		for h := w / 2; h <= w; h *= 2 {
+			if h >= 64 {
+				sizes = append(sizes, size{w, h})
+			}
+		}
+	}
+	sort.SliceStable(sizes, func(i, j int) bool { return sizes[i].w*sizes[i].h < sizes[j].w*sizes[j].h })
+	for _, sz := range sizes {
+		bp := NewBinPacker(sz.w, sz.h)
+		ok := true
+		for _, g := range glyphs {
+			if _, _, ok = bp.Insert(g.w+pad, g.h+pad); !ok {
+				break
+			}
+		}
+		if ok {
+			return sz.w, sz.h, true
+		}
+	}
+	return 0, 0, false
+}
+
+// pageName is the output name of atlas page p; page 0 keeps the plain name.
+func pageName(outName string, p int) string {
+	if p == 0 {
+		return outName
+	}
+	return fmt.Sprintf("%s_%d", outName, p)
 }
 
 //根据缩放后的参数绘制贴图
@@ -104,39 +211,8 @@ func drawAtlas(glyphs []glyph, ttfData []byte, texW, texH, drawSize int, outName
 	fmt.Printf("[+] Atlas Saved: %s.png (%dx%d, FontSize: %d)\n", outName, texW, texH, drawSize)
 }
 
-func isPow2(n int) bool { return n > 0 && (n&(n-1)) == 0 }
-
-func main() {
-	tPtr := flag.String("t", "", "TTF Font Path")
-	sPtr := flag.Int("s", 12, "SD Physical Size")
-	fPtr := flag.Int("f", 30, "Game Render Size")
-	cPtr := flag.String("c", "", "Chars TXT Path")
-	wPtr := flag.Int("w", 512, "Texture Width")
-	hPtr := flag.Int("h", 512, "Texture Height")
-	oPtr := flag.String("o", "font_final", "Output Name")
-	hdPtr := flag.Int("hd", 0, "HD Multiplier (e.g. 4 for 2048px)")
-
-	lhPtr := flag.Float64("lh", 30.0, "FNT: Line Height")
-	bhPtr := flag.Float64("bh", 32.0, "FNT: Base Height")
-	bwPtr := flag.Float64("bw", 32.0, "FNT: Base Width")
-	spPtr := flag.Float64("space", 3.0, "FNT: Spacing")
-	flag.Parse()
-
-	if *tPtr == "" || *sPtr <= 0 || *cPtr == "" || !isPow2(*wPtr) {
-		fmt.Println("Usage: van_font_gen -t font.ttf -s 12 -f 30 -c chars.txt -w 512 -hd 4")
-		os.Exit(1)
-	}
-
-	realSize, fakeSize := *sPtr, *fPtr
-	scaleRatio := float32(fakeSize) / float32(realSize)
-
-	ttfData, err := os.ReadFile(*tPtr)
-	if err != nil {
-		fmt.Printf("[-] Error reading TTF: %v\n", err)
-		os.Exit(1)
-	}
-
- 
+//按SD尺寸测量TTF字符
+func ttfGlyphs(ttfData []byte, realSize int, charsPath string) []glyph {
 	f, _ := opentype.Parse(ttfData)
 	faceSD, _ := opentype.NewFace(f, &opentype.FaceOptions{Size: float64(realSize), DPI: 72, Hinting: font.HintingNone})
 	ascentSD := faceSD.Metrics().Ascent.Ceil()
@@ -146,7 +222,7 @@ func main() {
 	allowedASCII := " !\"%&'(),-./0123456789:;?ABCDEFGHIJKLMNOPQRSTUVWXYZ[]abcdefghijklmnopqrstuvwxyz"
 	for _, r := range allowedASCII { finalCharSet[r] = true }
 	
-	txtData, _ := os.ReadFile(*cPtr)
+	txtData, _ := os.ReadFile(charsPath)
 	for _, r := range string(txtData) {
 		if r >= 0x20 && r != '\n' && r != '\r' && r != '\t' { finalCharSet[r] = true }
 	}
@@ -172,55 +248,170 @@ func main() {
 		})
 	}
 	faceSD.Close()
+	return glyphs
+}
+
+func isPow2(n int) bool { return n > 0 && (n&(n-1)) == 0 }
+
+func main() {
+	tPtr := flag.String("t", "", "TTF Font Path")
+	sPtr := flag.Int("s", 12, "SD Physical Size")
+	fPtr := flag.Int("f", 30, "Game Render Size")
+	cPtr := flag.String("c", "", "Chars TXT Path")
+	wPtr := flag.Int("w", 512, "Texture Width")
+	hPtr := flag.Int("h", 512, "Texture Height")
+	oPtr := flag.String("o", "font_final", "Output Name")
+	hdPtr := flag.Int("hd", 0, "HD Multiplier (e.g. 4 for 2048px)")
+
+	lhPtr := flag.Float64("lh", 30.0, "FNT: Line Height")
+	bhPtr := flag.Float64("bh", 32.0, "FNT: Base Height")
+	bwPtr := flag.Float64("bw", 32.0, "FNT: Base Width")
+	spPtr := flag.Float64("space", 3.0, "FNT: Spacing")
+
+	fntPtr := flag.String("fnt", "", "Read FNT: dump metrics to JSON")
+	atlasPtr := flag.String("atlas", "", "Read FNT: atlas PNG for -text preview")
+	textPtr := flag.String("text", "", "Read FNT: sample string to render (\\n for new line)")
+	cmpPtr := flag.String("cmp", "", "Read FNT: second FNT to compare against")
+	bmPtr := flag.String("bm", "", "BMFont .fnt (text or XML) to import instead of a TTF")
+	multiPtr := flag.Bool("multipage", false, "Spill glyphs onto extra atlas pages, page index in the FNT's unk0 field (unverified in the engine)")
+	flag.Parse()
+
+	if *fntPtr != "" {
+		fnt, err := readFNT(*fntPtr)
+		if err != nil {
+			fmt.Printf("[-] Error: %v\n", err)
+			os.Exit(1)
+		}
+		base := strings.TrimSuffix(*fntPtr, filepath.Ext(*fntPtr))
+		if err := dumpFNT(fnt, base+".json"); err != nil {
+			fmt.Printf("[-] Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *cmpPtr != "" {
+			other, err := readFNT(*cmpPtr)
+			if err != nil {
+				fmt.Printf("[-] Error: %v\n", err)
+				os.Exit(1)
+			}
+			compareFNT(fnt, other)
+		}
+		if *atlasPtr != "" && *textPtr != "" {
+			if err := renderPreview(fnt, *atlasPtr, *textPtr, base+"_preview.png"); err != nil {
+				fmt.Printf("[-] Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		return
+	}
+
+	if (*bmPtr == "" && (*tPtr == "" || *sPtr <= 0 || *cPtr == "")) || !isPow2(*wPtr) || !isPow2(*hPtr) {
+		fmt.Println("Usage: van_font_gen -t font.ttf -s 12 -f 30 -c chars.txt -w 512 -h 512 -hd 4")
+		fmt.Println("       van_font_gen -bm pixel.fnt -f 30 [-c chars.txt] -w 512 -h 512 -hd 4")
+		fmt.Println("       van_font_gen -fnt FONT.FNT [-atlas FONT.png -text \"Sample\"] [-cmp other.FNT]")
+		fmt.Println("       -w and -h must be powers of two")
+		os.Exit(1)
+	}
+
+	realSize, fakeSize := *sPtr, *fPtr
+	var glyphs []glyph
+	var ttfData []byte
+	var err error
+	if *bmPtr != "" {
+		//BMFont: 以行高作为物理尺寸
+		glyphs, realSize, err = bmGlyphs(*bmPtr, *cPtr)
+		if err != nil {
+			fmt.Printf("[-] Error reading BMFont: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		ttfData, err = os.ReadFile(*tPtr)
+		if err != nil {
+			fmt.Printf("[-] Error reading TTF: %v\n", err)
+			os.Exit(1)
+		}
+		glyphs = ttfGlyphs(ttfData, realSize, *cPtr)
+	}
+	scaleRatio := float32(fakeSize) / float32(realSize)
 
  
 	sort.Slice(glyphs, func(i, j int) bool {
 		if glyphs[i].h == glyphs[j].h { return glyphs[i].w > glyphs[j].w }
 		return glyphs[i].h > glyphs[j].h
 	})
-	packer := NewBinPacker(*wPtr, *hPtr)
 	pad := 1 
-	for i := range glyphs {
-		x, y, ok := packer.Insert(glyphs[i].w+pad, glyphs[i].h+pad)
-		if !ok {
-			fmt.Printf("[-] FAILED: Out of space at %d chars\n", i)
+	pages, err := packPages(glyphs, *wPtr, *hPtr, pad)
+	if err != nil {
+		fmt.Printf("[-] FAILED: %v\n", err)
+		os.Exit(1)
+	}
+	if pages > 1 {
+		if !*multiPtr {
+			fmt.Printf("[-] FAILED: %d glyphs do not fit one %dx%d page\n", len(glyphs), *wPtr, *hPtr)
+			if fw, fh, ok := fitSize(glyphs, pad, 4096); ok {
+				fmt.Printf("[!] Smallest single page that fits: %dx%d (-w %d -h %d)\n", fw, fh, fw, fh)
+			}
+			fmt.Println("[!] Or pass -multipage to spill onto extra pages (page index goes into the FNT's unk0 field, not verified in the engine)")
 			os.Exit(1)
 		}
-		glyphs[i].tx, glyphs[i].ty = x, y
+		fmt.Printf("[!] %d glyphs do not fit one %dx%d page, spilled onto %d pages\n", len(glyphs), *wPtr, *hPtr, pages)
+		fmt.Println("[!] The page index is written to the first float of each record (0 in the original fonts)")
 	}
 
-	//绘制贴图
-	drawAtlas(glyphs, ttfData, *wPtr, *hPtr, realSize, *oPtr)
+	for p := 0; p < pages; p++ {
+		var pageGlyphs []glyph
+		for _, g := range glyphs {
+			if g.page == p {
+				pageGlyphs = append(pageGlyphs, g)
+			}
+		}
 
-	//绘制HD伴生贴图
-	if *hdPtr > 0 {
-		mul := *hdPtr
-		hdW, hdH := *wPtr * mul, *hPtr * mul
-		hdSize := realSize * mul
-		hdGlyphs := make([]glyph, len(glyphs))
-		copy(hdGlyphs, glyphs)
-		for i := range hdGlyphs {
-			hdGlyphs[i].tx *= mul; hdGlyphs[i].ty *= mul
-			hdGlyphs[i].w *= mul; hdGlyphs[i].h *= mul
+		if *bmPtr != "" {
+			drawBitmapAtlas(pageGlyphs, *wPtr, *hPtr, 1, pageName(*oPtr, p))
+			if *hdPtr > 0 {
+				drawBitmapAtlas(pageGlyphs, *wPtr, *hPtr, *hdPtr, pageName(*oPtr, p)+"_HD")
+			}
+			continue
+		}
+
+		//绘制贴图
+		drawAtlas(pageGlyphs, ttfData, *wPtr, *hPtr, realSize, pageName(*oPtr, p))
+
+		//绘制HD伴生贴图
+		if *hdPtr > 0 {
+			mul := *hdPtr
+			hdW, hdH := *wPtr * mul, *hPtr * mul
+			hdSize := realSize * mul
+			hdGlyphs := make([]glyph, len(pageGlyphs))
+			copy(hdGlyphs, pageGlyphs)
+			for i := range hdGlyphs {
+				hdGlyphs[i].tx *= mul; hdGlyphs[i].ty *= mul
+				hdGlyphs[i].w *= mul; hdGlyphs[i].h *= mul
+			}
+			drawAtlas(hdGlyphs, ttfData, hdW, hdH, hdSize, pageName(*oPtr, p)+"_HD")
 		}
-		drawAtlas(hdGlyphs, ttfData, hdW, hdH, hdSize, *oPtr+"_HD")
 	}
 
 	//写入FNT(基于基础贴图的坐标)
 	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i].code < glyphs[j].code })
-	fntF, _ := os.Create(*oPtr + ".FNT")
-	defer fntF.Close()
-	count := uint16(len(glyphs))
-	fntF.Write([]byte{0x50, 0x32})
-	binary.Write(fntF, binary.LittleEndian, count)
-	binary.Write(fntF, binary.LittleEndian, []float32{float32(*lhPtr), float32(*bhPtr), float32(*bwPtr), float32(*spPtr)})
+	fnt := &fntFile{LineHeight: float32(*lhPtr), BaseHeight: float32(*bhPtr), BaseWidth: float32(*bwPtr), Spacing: float32(*spPtr)}
 	for _, g := range glyphs {
-		binary.Write(fntF, binary.LittleEndian, g.code)
-		u0, u1 := float32(g.tx)/float32(*wPtr), float32(g.tx+g.w)/float32(*wPtr)
-		v0, v1 := float32(g.ty)/float32(*hPtr), float32(g.ty+g.h)/float32(*hPtr)
-		fw, fh, fb := float32(g.w)*scaleRatio, float32(g.h)*scaleRatio, g.bear*scaleRatio
-		binary.Write(fntF, binary.LittleEndian, []float32{0.0, fw, fh, 0.0, fb, u0, u1, v0, v1})
+		//单页时保持原版的0
+		unk0 := float32(0)
+		if *multiPtr {
+			unk0 = float32(g.page)
+		}
+		fnt.Glyphs = append(fnt.Glyphs, fntGlyph{
+			Code: g.code, Unk0: unk0,
+			Width: float32(g.w) * scaleRatio, Height: float32(g.h) * scaleRatio, Bearing: g.bear * scaleRatio,
+			U0: float32(g.tx) / float32(*wPtr), U1: float32(g.tx+g.w) / float32(*wPtr),
+			V0: float32(g.ty) / float32(*hPtr), V1: float32(g.ty+g.h) / float32(*hPtr),
+		})
+	}
+	if err := writeFNT(*oPtr+".FNT", fnt); err != nil {
+		fmt.Printf("[-] Error writing FNT: %v\n", err)
+		os.Exit(1)
 	}
+	count := len(glyphs)
 
 	fmt.Printf("[*] MISSION COMPLETE! Generated %d glyphs.\n", count)
 }
\ No newline at end of file
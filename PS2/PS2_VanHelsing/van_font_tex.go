@@ -4,51 +4,46 @@ import (
 	"encoding/binary"
 	"fmt"
 	"image"
-	_ "image/png"
+	"image/color"
+	"image/png"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
-)
 
+	"palquant"
+	"ps2gs"
+)
 
+// GOELANFONT.TEX layout (little endian):
+//
+//	header[32]: width[4] height[4] bpp[4] psm[4] 0[4] ...
+//	pixels: PSMT8 (psm 0x13) or PSMT4 (psm 0x14), swizzled for a PSMCT32 upload
+//	palette: 256 (8bpp, CSM1 order) or 16 (4bpp) RGBA8888 entries
 
-func Ps2Swizzle8(in []byte, w, h int) []byte {
-	out := make([]byte, len(in))
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			blockLoc := (y & (^0xF)) * w + (x & (^0xF)) * 2
-			swapSel := (((y + 2) >> 2) & 0x1) * 4
-			posY := (((y & (^3)) >> 1) + (y & 1)) & 0x7
-			colLoc := posY*w*2 + ((x + swapSel) & 0x7) * 4
-			byteNum := ((y >> 1) & 1) + ((x >> 2) & 2)
-			swizzleIdx := blockLoc + colLoc + byteNum
+const (
+	psmT8 = 0x13
+	psmT4 = 0x14
+)
 
-			if swizzleIdx < len(out) {
-				out[swizzleIdx] = in[y*w+x]
-			}
-		}
+// packNibbles and unpackNibbles convert between one palette index per byte
+// and packed PSMT4 data, low nibble first.
+func packNibbles(in []byte) []byte {
+	out := make([]byte, (len(in)+1)/2)
+	for i, v := range in {
+		out[i/2] |= (v & 0xF) << (4 * (i & 1))
 	}
 	return out
 }
 
-func SwizzleCSM1(entries []uint32) []uint32 {
-	if len(entries) < 256 {
-		tmp := make([]uint32, 256)
-		copy(tmp, entries)
-		entries = tmp
-	}
-	out := make([]uint32, 0, 256)
-	for i := 0; i < 256; i += 32 {
-		out = append(out, entries[i:i+8]...)
-		out = append(out, entries[i+16:i+24]...)
-		out = append(out, entries[i+8:i+16]...)
-		out = append(out, entries[i+24:i+32]...)
+func unpackNibbles(in []byte, n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = in[i/2] >> (4 * (i & 1)) & 0xF
 	}
 	return out
 }
 
-
 func encodeRGBA8888FullAlpha(c image.Paletted, idx int) uint32 {
 	r16, g16, b16, a16 := c.Palette[idx].RGBA()
 	r := uint32(r16 >> 8)
@@ -60,28 +55,196 @@ func encodeRGBA8888FullAlpha(c image.Paletted, idx int) uint32 {
 	return (a << 24) | (b << 16) | (g << 8) | r
 }
 
+// decodeRGBA8888 is the inverse of encodeRGBA8888FullAlpha, which stores
+// premultiplied color. Each channel is un-premultiplied to the value that
+// encodes back to the stored byte; channels brighter than alpha are kept.
+func decodeRGBA8888(v uint32) color.NRGBA {
+	a := uint8(v >> 24)
+	ch := func(c uint8) uint8 {
+		if a == 0 || a == 255 || c > a {
+			return c
+		}
+		for n := int(c); n < 256; n++ {
+			if r, _, _, _ := (color.NRGBA{uint8(n), 0, 0, a}).RGBA(); uint8(r>>8) == c {
+				return uint8(n)
+			}
+		}
+		return c
+	}
+	return color.NRGBA{ch(uint8(v)), ch(uint8(v >> 8)), ch(uint8(v >> 16)), a}
+}
+
 
 func isPowerOfTwo(n int) bool {
 	return n > 0 && (n&(n-1)) == 0
 }
 
+// rampPalette is the grey ramp used for fonts without a reference TEX: white
+// at rising alpha, which the premultiplied palette stores as v, v, v, v.
+func rampPalette(n int) color.Palette {
+	pal := make(color.Palette, n)
+	for i := range pal {
+		v := uint8(i * 255 / (n - 1))
+		pal[i] = color.NRGBA{255, 255, 255, v}
+	}
+	return pal
+}
+
+// coverage is how much a font pixel shows: alpha times luminance, so white
+// glyphs on a transparent or black background both map onto the ramp.
+func coverage(c color.Color) int {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	lum := (299*int(n.R) + 587*int(n.G) + 114*int(n.B)) / 1000
+	return lum * int(n.A) / 255
+}
+
+// quantizeToRamp maps every pixel to the palette entry with the closest
+// coverage.
+func quantizeToRamp(img image.Image, pal color.Palette) *image.Paletted {
+	levels := make([]int, len(pal))
+	for i, c := range pal {
+		levels[i] = coverage(c)
+	}
+	var lut [256]uint8
+	for v := range lut {
+		best, bestErr := 0, 1<<30
+		for i, l := range levels {
+			d := v - l
+			if d < 0 {
+				d = -d
+			}
+			if d < bestErr {
+				best, bestErr = i, d
+			}
+		}
+		lut[v] = uint8(best)
+	}
+
+	b := img.Bounds()
+	out := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), pal)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			out.Pix[y*out.Stride+x] = lut[coverage(img.At(b.Min.X+x, b.Min.Y+y))]
+		}
+	}
+	return out
+}
+
+type texFile struct {
+	w, h, bpp int
+	pix       []byte // one palette index per byte, unswizzled
+	pal       color.Palette
+}
+
+func readTex(path string) (*texFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 32 {
+		return nil, fmt.Errorf("%s: too small for a TEX header", path)
+	}
+	t := &texFile{
+		w:   int(binary.LittleEndian.Uint32(data[0x00:])),
+		h:   int(binary.LittleEndian.Uint32(data[0x04:])),
+		bpp: int(binary.LittleEndian.Uint32(data[0x08:])),
+	}
+	psm := binary.LittleEndian.Uint32(data[0x0C:])
+	if !isPowerOfTwo(t.w) || !isPowerOfTwo(t.h) || t.w > 1024 || t.h > 1024 {
+		return nil, fmt.Errorf("%s: bad size %dx%d", path, t.w, t.h)
+	}
+
+	var pixSize, palCount int
+	switch {
+	case t.bpp == 8 && psm == psmT8:
+		pixSize, palCount = t.w*t.h, 256
+	case t.bpp == 4 && psm == psmT4:
+		pixSize, palCount = (t.w*t.h+1)/2, 16
+	default:
+		return nil, fmt.Errorf("%s: unsupported bpp %d / psm 0x%X", path, t.bpp, psm)
+	}
+	if len(data) < 32+pixSize+palCount*4 {
+		return nil, fmt.Errorf("%s: truncated (%d bytes, need %d)", path, len(data), 32+pixSize+palCount*4)
+	}
+
+	pixels := data[32 : 32+pixSize]
+	u32Pal := make([]uint32, palCount)
+	for i := range u32Pal {
+		u32Pal[i] = binary.LittleEndian.Uint32(data[32+pixSize+i*4:])
+	}
+	if t.bpp == 8 {
+		if t.pix, err = ps2gs.Unswizzle(pixels, t.w, t.h, ps2gs.PSMT8); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		u32Pal = ps2gs.UnswizzleCSM1_32(u32Pal)
+	} else {
+		linear, err := ps2gs.Unswizzle(pixels, t.w, t.h, ps2gs.PSMT4)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		t.pix = unpackNibbles(linear, t.w*t.h)
+	}
+	for _, v := range u32Pal {
+		t.pal = append(t.pal, decodeRGBA8888(v))
+	}
+	return t, nil
+}
+
+func texToPng(texPath, outPath string) {
+	t, err := readTex(texPath)
+	if err != nil {
+		log.Fatal("Read error:", err)
+	}
+	img := image.NewPaletted(image.Rect(0, 0, t.w, t.h), t.pal)
+	copy(img.Pix, t.pix)
+
+	outF, err := os.Create(outPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outF.Close()
+	if err := png.Encode(outF, img); err != nil {
+		log.Fatal("Encode error:", err)
+	}
+	fmt.Printf("Decoded %dx%d %dbpp TEX. Saved to: %s\n", t.w, t.h, t.bpp, outPath)
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("PS2 TEX Tool (Alpha x2 / Raw Version)")
-		fmt.Println("Usage: tex_tool <input.png> [-o output.TEX]")
+		fmt.Println("Usage: tex_tool <input.png> [-o output.TEX] [-4] [-ref original.TEX]")
+		fmt.Println("       tex_tool <input.TEX> [-o output.png]")
+		fmt.Println("  -4    write a 4bpp (PSMT4, 16 color) TEX")
+		fmt.Println("  -ref  map input to the nearest colors of this TEX's palette instead of the built-in grey ramp")
 		return
 	}
 
 	pngPath := os.Args[1]
 	outPath := ""
+	refPath := ""
+	bpp := 8
 
 	for i := 1; i < len(os.Args); i++ {
-		if os.Args[i] == "-o" && i+1 < len(os.Args) {
+		switch {
+		case os.Args[i] == "-o" && i+1 < len(os.Args):
 			outPath = os.Args[i+1]
-			break
+			i++
+		case os.Args[i] == "-ref" && i+1 < len(os.Args):
+			refPath = os.Args[i+1]
+			i++
+		case os.Args[i] == "-4":
+			bpp = 4
 		}
 	}
 
+	if strings.EqualFold(filepath.Ext(pngPath), ".tex") {
+		if outPath == "" {
+			outPath = strings.TrimSuffix(pngPath, filepath.Ext(pngPath)) + ".png"
+		}
+		texToPng(pngPath, outPath)
+		return
+	}
+
 	if outPath == "" {
 		ext := filepath.Ext(pngPath)
 		outPath = strings.TrimSuffix(pngPath, ext) + ".TEX"
@@ -98,9 +261,23 @@ func main() {
 		log.Fatal("Decode error:", err)
 	}
 
+	colors := 1 << bpp
 	palImg, ok := img.(*image.Paletted)
-	if !ok {
-		log.Fatal("Error: PNG must be Indexed (8bpp).")
+	if refPath != "" {
+		// 参考调色板的颜色不一定是灰阶，按最近颜色映射
+		ref, err := readTex(refPath)
+		if err != nil {
+			log.Fatal("Reference error:", err)
+		}
+		if len(ref.pal) > colors {
+			log.Fatalf("Error: %s has %d colors, a %dbpp TEX holds %d.", refPath, len(ref.pal), bpp, colors)
+		}
+		fmt.Printf("Mapping to the %d color palette of %s...\n", len(ref.pal), refPath)
+		palImg = palquant.Remap(img, ref.pal, palquant.DitherNone)
+	} else if !ok || len(palImg.Palette) > colors {
+		pal := rampPalette(colors)
+		fmt.Printf("Quantising to a %d color ramp...\n", len(pal))
+		palImg = quantizeToRamp(img, pal)
 	}
 
 	w := palImg.Bounds().Dx()
@@ -109,27 +286,40 @@ func main() {
 	if !isPowerOfTwo(w) || !isPowerOfTwo(h) || w > 1024 || h > 1024 {
 		log.Fatalf("Error: Dimension %dx%d invalid. Must be power of 2 and <= 1024.", w, h)
 	}
-
-	fmt.Printf("Encoding %dx%d TEX with Full Alpha (x2)...\n", w, h)
+	fmt.Printf("Encoding %dx%d %dbpp TEX with Full Alpha (x2)...\n", w, h, bpp)
 
 	header := make([]byte, 32)
 	binary.LittleEndian.PutUint32(header[0x00:], uint32(w))
 	binary.LittleEndian.PutUint32(header[0x04:], uint32(h))
-	binary.LittleEndian.PutUint32(header[0x08:], 8)
-	binary.LittleEndian.PutUint32(header[0x0C:], 0x13) // 强制模式 0x13
+	binary.LittleEndian.PutUint32(header[0x08:], uint32(bpp))
+	binary.LittleEndian.PutUint32(header[0x0C:], psmT8) // 强制模式 0x13
 	binary.LittleEndian.PutUint32(header[0x10:], 0)
 
-	swizzledPixels := Ps2Swizzle8(palImg.Pix, w, h)
+	pix := palImg.Pix
+	if palImg.Stride != w {
+		pix = make([]byte, 0, w*h)
+		for y := 0; y < h; y++ {
+			pix = append(pix, palImg.Pix[y*palImg.Stride:y*palImg.Stride+w]...)
+		}
+	}
 
-	u32Pal := make([]uint32, 256)
-	for i := 0; i < 256; i++ {
+	var swizzledPixels []byte
+	u32Pal := make([]uint32, colors)
+	for i := range u32Pal {
 		if i < len(palImg.Palette) {
 			u32Pal[i] = encodeRGBA8888FullAlpha(*palImg, i)
-		} else {
-			u32Pal[i] = 0
 		}
 	}
-	swizzledPal := SwizzleCSM1(u32Pal)
+	if bpp == 4 {
+		binary.LittleEndian.PutUint32(header[0x0C:], psmT4)
+		swizzledPixels, err = ps2gs.Swizzle(packNibbles(pix), w, h, ps2gs.PSMT4)
+	} else {
+		swizzledPixels, err = ps2gs.Swizzle(pix, w, h, ps2gs.PSMT8)
+		u32Pal = ps2gs.SwizzleCSM1_32(u32Pal)
+	}
+	if err != nil {
+		log.Fatal("Swizzle error: ", err)
+	}
 
 	outF, err := os.Create(outPath)
 	if err != nil {
@@ -139,9 +329,9 @@ func main() {
 
 	outF.Write(header)
 	outF.Write(swizzledPixels)
-	for _, colorVal := range swizzledPal {
+	for _, colorVal := range u32Pal {
 		binary.Write(outF, binary.LittleEndian, colorVal)
 	}
 
 	fmt.Printf("Success! Alpha boosted. Saved to: %s\n", outPath)
-}
\ No newline at end of file
+}
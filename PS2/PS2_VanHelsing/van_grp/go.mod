@@ -0,0 +1,3 @@
+module van_grp
+
+go 1.22.2
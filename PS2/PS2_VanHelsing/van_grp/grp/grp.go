@@ -0,0 +1,265 @@
+// Package grp reads and writes Van Helsing GRP.bin archives (e.g.
+// INTERFACE.GRP.bin) of both the PS2 and the Xbox release.
+//
+// Header (16 bytes): fileCount[4] dataOffset[4] blockSize[4] pad[4]
+//
+// PS2 entries are 32 bytes, scattered over a table with zero-filled slots:
+//
+//	nameOff[4] hash[4] size[4] u1[4] blockOff[4] blocks[4] u4[4] u5[4]
+//
+// Xbox entries are 36 bytes and packed right after the header; the first 24
+// bytes match the PS2 layout. File data starts at dataOffset + blockOff *
+// block size, where the block size is 32 on PS2 and the header field on Xbox.
+// Names are NUL-terminated paths with backslashes, at absolute offsets.
+package grp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+type Platform int
+
+const (
+	PS2 Platform = iota
+	Xbox
+)
+
+func (p Platform) String() string {
+	if p == Xbox {
+		return "XBOX"
+	}
+	return "PS2"
+}
+
+const (
+	HeaderSize    = 16
+	ps2EntrySize  = 32
+	xboxEntrySize = 36
+	ps2BlockSize  = 32
+)
+
+type Entry struct {
+	Name   string // path with forward slashes
+	Size   uint32
+	Block  uint32 // offset from dataOffset in blocks
+	Blocks uint32
+
+	pos int    // offset of the entry in the header
+	raw []byte // entry bytes, unknown fields are kept as is
+}
+
+type Archive struct {
+	Platform   Platform
+	DataOffset uint32
+	BlockSize  uint32
+	Entries    []Entry
+
+	header []byte // everything before dataOffset
+}
+
+// Parse detects the platform variant and reads the entry table. The Xbox
+// layout is tried first because its table has no gaps and every entry can be
+// checked; the PS2 layout is the fallback.
+func Parse(data []byte) (*Archive, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("file too small")
+	}
+	a, xerr := parseLayout(data, Xbox)
+	if xerr == nil {
+		return a, nil
+	}
+	a, perr := parseLayout(data, PS2)
+	if perr == nil {
+		return a, nil
+	}
+	return nil, fmt.Errorf("not a GRP.bin (XBOX: %v; PS2: %v)", xerr, perr)
+}
+
+func parseLayout(data []byte, p Platform) (*Archive, error) {
+	count := binary.LittleEndian.Uint32(data[0:4])
+	a := &Archive{
+		Platform:   p,
+		DataOffset: binary.LittleEndian.Uint32(data[4:8]),
+		BlockSize:  ps2BlockSize,
+	}
+	entrySize := ps2EntrySize
+	if p == Xbox {
+		entrySize = xboxEntrySize
+		a.BlockSize = binary.LittleEndian.Uint32(data[8:12])
+		if a.BlockSize == 0 || a.BlockSize&(a.BlockSize-1) != 0 {
+			return nil, fmt.Errorf("bad block size %d", a.BlockSize)
+		}
+	}
+	if count == 0 || a.DataOffset < HeaderSize || int(a.DataOffset) > len(data) {
+		return nil, fmt.Errorf("bad header (count %d, data offset 0x%X)", count, a.DataOffset)
+	}
+	a.header = append([]byte(nil), data[:a.DataOffset]...)
+
+	pos := HeaderSize
+	for uint32(len(a.Entries)) < count {
+		if pos+entrySize > int(a.DataOffset) {
+			return nil, fmt.Errorf("entry table runs into data after %d of %d entries", len(a.Entries), count)
+		}
+		if p == PS2 && binary.LittleEndian.Uint32(data[pos:]) == 0 {
+			pos += 4
+			continue
+		}
+		raw := data[pos : pos+entrySize]
+		e := Entry{
+			Size:   binary.LittleEndian.Uint32(raw[8:12]),
+			Block:  binary.LittleEndian.Uint32(raw[16:20]),
+			Blocks: binary.LittleEndian.Uint32(raw[20:24]),
+			pos:    pos,
+			raw:    append([]byte(nil), raw...),
+		}
+		name, err := cString(data[:a.DataOffset], binary.LittleEndian.Uint32(raw[0:4]))
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", len(a.Entries), err)
+		}
+		e.Name = strings.ReplaceAll(name, "\\", "/")
+		end := uint64(a.DataOffset) + uint64(e.Block)*uint64(a.BlockSize) + uint64(e.Size)
+		if end > uint64(len(data)) {
+			return nil, fmt.Errorf("entry %s: data beyond end of file", e.Name)
+		}
+		a.Entries = append(a.Entries, e)
+		pos += entrySize
+	}
+	return a, nil
+}
+
+// cString reads a printable NUL-terminated name from the header.
+func cString(hdr []byte, off uint32) (string, error) {
+	if off < HeaderSize || int(off) >= len(hdr) {
+		return "", fmt.Errorf("name offset 0x%X outside header", off)
+	}
+	end := bytes.IndexByte(hdr[off:], 0)
+	if end <= 0 {
+		return "", fmt.Errorf("bad name at 0x%X", off)
+	}
+	name := hdr[off : int(off)+end]
+	for _, c := range name {
+		if c < 0x20 || c >= 0x7f {
+			return "", fmt.Errorf("bad name at 0x%X", off)
+		}
+	}
+	return string(name), nil
+}
+
+// FileData returns the stored bytes of an entry.
+func (a *Archive) FileData(data []byte, e *Entry) []byte {
+	off := uint64(a.DataOffset) + uint64(e.Block)*uint64(a.BlockSize)
+	return data[off : off+uint64(e.Size)]
+}
+
+// padByte is what the original tools fill the last block of a file with.
+func (a *Archive) padByte() byte {
+	if a.Platform == Xbox {
+		return 0x90
+	}
+	return 0
+}
+
+// Build writes a new archive with files[i] as the data of Entries[i]. Files
+// may be any size: blocks are laid out again in entry order and the name
+// table is rewritten after the entry table. dataOffset stays where it was
+// while the names fit below it, and otherwise moves up, keeping the
+// alignment of the original. Anything between the names and the data other
+// than fill would be lost, so such a header is refused.
+func (a *Archive) Build(files [][]byte) ([]byte, error) {
+	if len(files) != len(a.Entries) {
+		return nil, fmt.Errorf("got %d files for %d entries", len(files), len(a.Entries))
+	}
+
+	entrySize := ps2EntrySize
+	if a.Platform == Xbox {
+		entrySize = xboxEntrySize
+	}
+	tableEnd := HeaderSize
+	namesStart := len(a.header)
+	for _, e := range a.Entries {
+		if end := e.pos + entrySize; end > tableEnd {
+			tableEnd = end
+		}
+		if off := int(binary.LittleEndian.Uint32(e.raw[0:4])); off < namesStart {
+			namesStart = off
+		}
+	}
+	if namesStart < tableEnd {
+		namesStart = tableEnd
+	}
+	fill := a.header[len(a.header)-1]
+	if err := a.checkNameArea(namesStart, fill); err != nil {
+		return nil, err
+	}
+
+	hdr := append([]byte(nil), a.header[:namesStart]...)
+	nameOffs := make([]uint32, len(a.Entries))
+	for i, e := range a.Entries {
+		nameOffs[i] = uint32(len(hdr))
+		hdr = append(hdr, strings.ReplaceAll(e.Name, "/", "\\")...)
+		hdr = append(hdr, 0)
+	}
+
+	// keep dataOffset if the names fit, else align it like the original
+	// (largest power of two dividing it, up to one sector), filled with the
+	// byte the original padding used
+	align := uint32(1)
+	for align < 2048 && a.DataOffset%(align*2) == 0 {
+		align *= 2
+	}
+	for uint32(len(hdr)) < a.DataOffset || uint32(len(hdr))%align != 0 {
+		hdr = append(hdr, fill)
+	}
+	dataOffset := uint32(len(hdr))
+	binary.LittleEndian.PutUint32(hdr[4:8], dataOffset)
+
+	var block uint32
+	for i := range a.Entries {
+		e := &a.Entries[i]
+		size := uint32(len(files[i]))
+		blocks := (size + a.BlockSize - 1) / a.BlockSize
+
+		raw := hdr[e.pos : e.pos+entrySize]
+		copy(raw, e.raw)
+		binary.LittleEndian.PutUint32(raw[0:4], nameOffs[i])
+		binary.LittleEndian.PutUint32(raw[8:12], size)
+		binary.LittleEndian.PutUint32(raw[16:20], block)
+		binary.LittleEndian.PutUint32(raw[20:24], blocks)
+
+		e.Size, e.Block, e.Blocks, e.raw = size, block, blocks, append([]byte(nil), raw...)
+		block += blocks
+	}
+
+	out := bytes.NewBuffer(append([]byte(nil), hdr...))
+	for i, e := range a.Entries {
+		out.Write(files[i])
+		for pad := e.Blocks*a.BlockSize - e.Size; pad > 0; pad-- {
+			out.WriteByte(a.padByte())
+		}
+	}
+
+	a.DataOffset = dataOffset
+	a.header = hdr
+	return out.Bytes(), nil
+}
+
+// checkNameArea makes sure the header from namesStart on holds nothing but
+// the entry names and fill (the fill byte or zero), as Build rewrites it.
+func (a *Archive) checkNameArea(namesStart int, fill byte) error {
+	named := make([]bool, len(a.header))
+	for _, e := range a.Entries {
+		off := int(binary.LittleEndian.Uint32(e.raw[0:4]))
+		for i := off; i <= off+len(e.Name) && i < len(named); i++ {
+			named[i] = true
+		}
+	}
+	for i := namesStart; i < len(a.header); i++ {
+		if c := a.header[i]; !named[i] && c != fill && c != 0 {
+			return fmt.Errorf("header has data at 0x%X between the names and the file data, cannot rebuild", i)
+		}
+	}
+	return nil
+}
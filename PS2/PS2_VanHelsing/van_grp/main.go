@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"van_grp/grp"
+)
+
+func unpack(binPath, outDir string) error {
+	data, err := os.ReadFile(binPath)
+	if err != nil {
+		return err
+	}
+
+	if outDir == "" {
+		outDir = binPath + "_extracted"
+	}
+
+	a, err := grp.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("[*] Unpacking (%s) '%s' to '%s'...\n", a.Platform, binPath, outDir)
+	fmt.Printf("  - File count: %d\n", len(a.Entries))
+	fmt.Printf("  - Data offset: %d\n", a.DataOffset)
+	fmt.Printf("  - Block size: %d\n", a.BlockSize)
+
+	for i := range a.Entries {
+		e := &a.Entries[i]
+		outPath := filepath.Join(outDir, filepath.FromSlash(e.Name))
+		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(outPath, a.FileData(data, e), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("  -> Extracted: %s (%d bytes) at offset %d\n", e.Name, e.Size, a.DataOffset+e.Block*a.BlockSize)
+	}
+	return nil
+}
+
+func repack(resDir, outBin, origBin string) error {
+	if _, err := os.Stat(resDir); os.IsNotExist(err) {
+		return fmt.Errorf("resource directory '%s' not found", resDir)
+	}
+
+	if outBin == "" {
+		outBin = resDir + ".GRP.bin.new"
+	}
+
+	if origBin == "" {
+		if strings.HasSuffix(resDir, "_extracted") {
+			origBin = strings.TrimSuffix(resDir, "_extracted")
+		} else if strings.HasSuffix(resDir, "_unpacked") {
+			origBin = strings.TrimSuffix(resDir, "_unpacked") + ".GRP.bin"
+		} else {
+			origBin = resDir + ".GRP.bin"
+		}
+	}
+
+	orig, err := os.ReadFile(origBin)
+	if err != nil {
+		return fmt.Errorf("original GRP.bin template '%s' not found. Please explicitly specify using -t", origBin)
+	}
+	a, err := grp.Parse(orig)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("[*] Repacking (%s) '%s' into '%s'...\n", a.Platform, resDir, outBin)
+	fmt.Printf("  - Using original header template from: %s\n", origBin)
+
+	files := make([][]byte, len(a.Entries))
+	for i, e := range a.Entries {
+		filePath := filepath.Join(resDir, filepath.FromSlash(e.Name))
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("file missing or unreadable in resource directory: %s", filePath)
+		}
+		files[i] = data
+		if uint32(len(data)) != e.Size {
+			fmt.Printf("  -> Packed: %s (%d -> %d bytes)\n", e.Name, e.Size, len(data))
+		} else {
+			fmt.Printf("  -> Packed: %s (%d bytes)\n", e.Name, len(data))
+		}
+	}
+
+	oldOffset := a.DataOffset
+	out, err := a.Build(files)
+	if err != nil {
+		return err
+	}
+	if a.DataOffset != oldOffset {
+		fmt.Printf("  - Data offset: %d -> %d\n", oldOffset, a.DataOffset)
+	}
+
+	if err := os.WriteFile(outBin, out, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("[*] Repack complete! Saved to %s\n", outBin)
+	return nil
+}
+
+func main() {
+	unpackPtr := flag.String("u", "", "Unpack a GRP.bin file, PS2 or XBOX (BIN_PATH)")
+	repackPtr := flag.String("r", "", "Repack a resource directory into a GRP.bin (RES_DIR)")
+	outPtr := flag.String("o", "", "Optional output path")
+	tplPtr := flag.String("t", "", "Original GRP.bin to use as template for repacking")
+
+	flag.Parse()
+
+	if *unpackPtr != "" {
+		if err := unpack(*unpackPtr, *outPtr); err != nil {
+			fmt.Printf("[-] Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if *repackPtr != "" {
+		if err := repack(*repackPtr, *outPtr, *tplPtr); err != nil {
+			fmt.Printf("[-] Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		flag.Usage()
+	}
+}
@@ -8,6 +8,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/binary"
 	"flag"
 	"fmt"
@@ -22,6 +23,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"palquant"
 )
 
 //  Constants 
@@ -205,7 +208,10 @@ func handleTiToPng(tiPath, outputPath string) {
 	fmt.Printf("Successfully converted '%s' to '%s'\n", filepath.Base(tiPath), filepath.Base(outputPath))
 }
 
-func handlePngToTi(tiPath, pngPath, outputPath string) {
+// handlePngToTi writes the PNG into a copy of the TI. With keepPalette the
+// TI's CLUT is kept and the pixels are mapped onto it; pixels that miss it
+// are counted and marked in <output>_offpal.png.
+func handlePngToTi(tiPath, pngPath, outputPath string, keepPalette bool) {
 	tiFile, err := os.Open(tiPath)
 	if err != nil { log.Fatalf("Error opening original TI file '%s': %v", tiPath, err) }
 	tiInfo, err := parseHdr(tiFile)
@@ -219,17 +225,33 @@ func handlePngToTi(tiPath, pngPath, outputPath string) {
 	defer pngFile.Close()
 	pngImg, _, err := image.Decode(pngFile)
 	if err != nil { log.Fatalf("Error decoding PNG file: %v", err) }
-	palettedImg, err := validatePNG(pngImg, tiInfo)
-	if err != nil { log.Fatalf("PNG validation failed: %v", err) }
 	clutSize, pixSize := calcSizes(tiInfo)
-	newRawCLUT := reverseCLUT(palettedImg.Palette, tiInfo.BPP)
+	if len(originalTiData) < offCLUT+clutSize+pixSize { log.Fatalf("Error: TI file is too short for its header") }
+	var palettedImg *image.Paletted
+	var report palquant.OffPalette
+	if keepPalette {
+		bounds := pngImg.Bounds()
+		if bounds.Dx() != tiInfo.Width || bounds.Dy() != tiInfo.Height {
+			log.Fatalf("PNG validation failed: PNG dimensions (%dx%d) mismatch TI (%dx%d)", bounds.Dx(), bounds.Dy(), tiInfo.Width, tiInfo.Height)
+		}
+		palette, err := processCLUT(bytes.NewReader(originalTiData[offCLUT:]), tiInfo.BPP)
+		if err != nil { log.Fatalf("Error processing CLUT: %v", err) }
+		palettedImg, report = palquant.KeepPalette(pngImg, palette)
+	} else {
+		palettedImg, err = validatePNG(pngImg, tiInfo)
+		if err != nil { log.Fatalf("PNG validation failed: %v", err) }
+	}
 	newRawPix := reversePix(palettedImg.Pix, tiInfo)
-	if len(newRawCLUT) != clutSize || len(newRawPix) != pixSize {
+	if len(newRawPix) != pixSize {
 		log.Fatalf("Internal error: generated data size mismatch.")
 	}
 	modifiedTiData := make([]byte, len(originalTiData))
 	copy(modifiedTiData, originalTiData)
-	copy(modifiedTiData[offCLUT:offCLUT+clutSize], newRawCLUT)
+	if !keepPalette {
+		newRawCLUT := reverseCLUT(palettedImg.Palette, tiInfo.BPP)
+		if len(newRawCLUT) != clutSize { log.Fatalf("Internal error: generated data size mismatch.") }
+		copy(modifiedTiData[offCLUT:offCLUT+clutSize], newRawCLUT)
+	}
 	copy(modifiedTiData[offCLUT+clutSize:offCLUT+clutSize+pixSize], newRawPix)
 	if outputPath == "" {
 		tiBase := strings.TrimSuffix(filepath.Base(tiPath), filepath.Ext(tiPath))
@@ -239,15 +261,22 @@ func handlePngToTi(tiPath, pngPath, outputPath string) {
 	err = os.WriteFile(outputPath, modifiedTiData, 0644)
 	if err != nil { log.Fatalf("Error writing output TI file: %v", err) }
 	fmt.Printf("Successfully created new TI file: %s\n", filepath.Base(outputPath))
+	if keepPalette {
+		fmt.Printf("Keep palette: %v\n", report)
+		heatPath := palquant.HeatmapPath(outputPath)
+		if err := report.WriteHeatmap(heatPath); err != nil { log.Fatalf("Error writing heatmap: %v", err) }
+		if report.Pixels > 0 { fmt.Printf("Heatmap saved: %s\n", filepath.Base(heatPath)) }
+	}
 }
 
 func main() {
 	log.SetFlags(0)
 	output := flag.String("o", "", "Optional output file path.")
+	keepPalette := flag.Bool("keep-palette", false, "PNG to TI: keep the TI's CLUT, map pixels onto it and write <output>_offpal.png.")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
 		fmt.Fprintln(os.Stderr, "  ti-converter <input.ti> [-o <output.png>]      (Converts TI to PNG)")
-		fmt.Fprintln(os.Stderr, "  ti-converter <original.ti> <new.png> [-o <output.ti>] (Converts PNG to TI)")
+		fmt.Fprintln(os.Stderr, "  ti-converter [-keep-palette] <original.ti> <new.png> [-o <output.ti>] (Converts PNG to TI)")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
@@ -263,7 +292,7 @@ func main() {
 		path1, path2 := args[0], args[1]
 		ext1, ext2 := strings.ToLower(filepath.Ext(path1)), strings.ToLower(filepath.Ext(path2))
 		if ext1 == ".ti" && (ext2 == ".png" || ext2 == ".gif" || ext2 == ".jpg" || ext2 == ".jpeg") {
-			handlePngToTi(path1, path2, *output)
+			handlePngToTi(path1, path2, *output, *keepPalette)
 		} else {
 			log.Fatal("Error: For two arguments, inputs must be <original.ti> and a valid image file.")
 		}
@@ -0,0 +1,3 @@
+module ps2gs
+
+go 1.22.2
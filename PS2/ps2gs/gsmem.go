@@ -0,0 +1,280 @@
+package ps2gs
+
+import "fmt"
+
+// PSM is a GS pixel storage mode, with the values of the TEX0/BITBLTBUF PSM
+// fields (and of the pixel format byte in TIM2 and most game headers).
+type PSM int
+
+const (
+	PSMCT32  PSM = 0x00
+	PSMCT16  PSM = 0x02
+	PSMCT16S PSM = 0x0A
+	PSMT8    PSM = 0x13
+	PSMT4    PSM = 0x14
+	PSMT8H   PSM = 0x1B
+	PSMT4HL  PSM = 0x24
+	PSMT4HH  PSM = 0x2C
+)
+
+func (p PSM) String() string {
+	switch p {
+	case PSMCT32:
+		return "PSMCT32"
+	case PSMCT16:
+		return "PSMCT16"
+	case PSMCT16S:
+		return "PSMCT16S"
+	case PSMT8:
+		return "PSMT8"
+	case PSMT4:
+		return "PSMT4"
+	case PSMT8H:
+		return "PSMT8H"
+	case PSMT4HL:
+		return "PSMT4HL"
+	case PSMT4HH:
+		return "PSMT4HH"
+	}
+	return fmt.Sprintf("PSM(0x%02X)", int(p))
+}
+
+// Bits returns the bits per texel of the linear (unswizzled) data.
+func (p PSM) Bits() int {
+	switch p {
+	case PSMCT32:
+		return 32
+	case PSMCT16, PSMCT16S:
+		return 16
+	case PSMT8, PSMT8H:
+		return 8
+	case PSMT4, PSMT4HL, PSMT4HH:
+		return 4
+	}
+	return 0
+}
+
+// DataSize returns the size of the swizzled data of a w x h texture. The H
+// formats live in the upper bits of a PSMCT32 buffer, so they take 4 bytes
+// per texel; all others are as big as their linear data.
+func DataSize(w, h int, psm PSM) int {
+	switch psm {
+	case PSMT8H, PSMT4HL, PSMT4HH:
+		return w * h * 4
+	}
+	return (w*h*psm.Bits() + 7) / 8
+}
+
+// Swizzled data is GS memory read back as a linear PSMCT32 image, which is how
+// the games upload it. Linear data is row-major: PSMT4 texels are packed two
+// per byte, low nibble first, PSMCT16 texels are little-endian halfwords.
+//
+// Textures smaller than a page keep the layouts the tools have always used:
+// PSMT8 the compact swizzle8 formula, PSMT4 the reversebox page conversion.
+// Below one block of those (PSMT8 under 16x4, PSMT4 narrower than 32 or
+// lower than 16) and below one page of PSMCT16/16S the data is left linear.
+// Those conversions only hold for whole blocks, and PSMT4 beyond one page for
+// whole pages, so other sizes are refused by checkSize rather than scrambled.
+
+// checkSize reports PSMT8 and PSMT4 sizes that neither stay linear nor fill
+// whole blocks (PSMT8 16x4, PSMT4 32x16) up to one 128x128 PSMT4 page and
+// whole pages past it.
+func checkSize(w, h int, psm PSM) error {
+	switch psm {
+	case PSMT8:
+		if w < 16 || h < 4 || w%16 == 0 && h%4 == 0 {
+			return nil
+		}
+	case PSMT4:
+		if w < 32 || h < 16 || fits4(w, 32) && fits4(h, 16) {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s %dx%d is not a whole number of blocks or pages", psm, w, h)
+}
+
+// fits4 reports whether a PSMT4 dimension is whole blocks of the given size
+// within one page, or whole pages.
+func fits4(n, block int) bool {
+	if n <= 128 {
+		return n%block == 0
+	}
+	return n%128 == 0
+}
+
+// Unswizzle converts swizzled data of the given format to linear texels.
+func Unswizzle(data []byte, w, h int, psm PSM) ([]byte, error) {
+	if len(data) < DataSize(w, h, psm) {
+		return nil, fmt.Errorf("%s %dx%d needs %d bytes, got %d", psm, w, h, DataSize(w, h, psm), len(data))
+	}
+	if err := checkSize(w, h, psm); err != nil {
+		return nil, err
+	}
+	switch psm {
+	case PSMCT32:
+		return append([]byte(nil), data[:w*h*4]...), nil
+	case PSMCT16, PSMCT16S:
+		return unswizzle16(data, w, h, psm), nil
+	case PSMT8:
+		if w < 16 || h < 4 {
+			return append([]byte(nil), data[:w*h]...), nil
+		}
+		return unswizzle8(data[:w*h], w, h), nil
+	case PSMT4:
+		if w < 32 || h < 16 {
+			return append([]byte(nil), data[:(w*h+1)/2]...), nil
+		}
+		return unswizzle4(data[:w*h/2], w, h), nil
+	case PSMT8H:
+		out := make([]byte, w*h)
+		for i := range out {
+			out[i] = data[i*4+3]
+		}
+		return out, nil
+	case PSMT4HL, PSMT4HH:
+		shift := highNibbleShift(psm)
+		out := make([]byte, (w*h+1)/2)
+		for i := 0; i < w*h; i++ {
+			out[i/2] |= (data[i*4+3] >> shift & 0xF) << (4 * (i & 1))
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported %s", psm)
+}
+
+// Swizzle is the inverse of Unswizzle. For the H formats the other 24 bits of
+// every word are zero; use SwizzleInto to keep what shares the buffer.
+func Swizzle(linear []byte, w, h int, psm PSM) ([]byte, error) {
+	out := make([]byte, DataSize(w, h, psm))
+	if err := SwizzleInto(out, linear, w, h, psm); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SwizzleInto swizzles linear texels into dst, which must hold DataSize bytes.
+// The H formats only overwrite their own bits.
+func SwizzleInto(dst, linear []byte, w, h int, psm PSM) error {
+	if len(dst) < DataSize(w, h, psm) {
+		return fmt.Errorf("%s %dx%d needs %d bytes, got %d", psm, w, h, DataSize(w, h, psm), len(dst))
+	}
+	if psm.Bits() == 0 {
+		return fmt.Errorf("unsupported %s", psm)
+	}
+	if need := (w*h*psm.Bits() + 7) / 8; len(linear) < need {
+		return fmt.Errorf("%s %dx%d linear data needs %d bytes, got %d", psm, w, h, need, len(linear))
+	}
+	if err := checkSize(w, h, psm); err != nil {
+		return err
+	}
+	switch psm {
+	case PSMCT32:
+		copy(dst, linear[:w*h*4])
+	case PSMCT16, PSMCT16S:
+		swizzle16(dst, linear, w, h, psm)
+	case PSMT8:
+		if w < 16 || h < 4 {
+			copy(dst, linear[:w*h])
+			break
+		}
+		copy(dst, swizzle8(linear[:w*h], w, h))
+	case PSMT4:
+		if w < 32 || h < 16 {
+			copy(dst, linear[:(w*h+1)/2])
+			break
+		}
+		copy(dst, swizzle4(linear[:w*h/2], w, h))
+	case PSMT8H:
+		for i := 0; i < w*h; i++ {
+			dst[i*4+3] = linear[i]
+		}
+	case PSMT4HL, PSMT4HH:
+		shift := highNibbleShift(psm)
+		for i := 0; i < w*h; i++ {
+			v := linear[i/2] >> (4 * (i & 1)) & 0xF
+			dst[i*4+3] = dst[i*4+3]&^(0xF<<shift) | v<<shift
+		}
+	}
+	return nil
+}
+
+func highNibbleShift(psm PSM) uint {
+	if psm == PSMT4HH {
+		return 4
+	}
+	return 0
+}
+
+// PSMCT16S orders the blocks of a page differently from PSMCT16 (whose table
+// is the same as blockTable4); columns and texels within a block are the same.
+var blockTable16S = [32]int{
+	0, 2, 16, 18, 1, 3, 17, 19, 8, 10, 24, 26, 9, 11, 25, 27,
+	4, 6, 20, 22, 5, 7, 21, 23, 12, 14, 28, 30, 13, 15, 29, 31,
+}
+
+// block32Pos[n] is the (x, y) of block n in a PSMCT32 page, in blocks.
+var block32Pos = func() (pos [32][2]int) {
+	for i, n := range blockTable32 {
+		pos[n] = [2]int{i % 8, i / 8}
+	}
+	return
+}()
+
+// offset16 returns the byte offset of PSMCT16/16S texel (x, y) in the PSMCT32
+// view. A 64x64 page of 16x8 blocks becomes a 64x32 page of 8x8 blocks, so the
+// view is w words wide; each word holds texels x and x+8 of a block row.
+func offset16(x, y, w int, psm PSM) int {
+	table := &blockTable4
+	if psm == PSMCT16S {
+		table = &blockTable16S
+	}
+	b := block32Pos[table[(y%64)/8*4+(x%64)/16]]
+	wx := x/64*64 + b[0]*8 + x%8
+	wy := y/64*32 + b[1]*8 + y%8
+	return (wy*w+wx)*4 + (x>>3&1)*2
+}
+
+func paged16(w, h int) bool { return w%64 == 0 && h%64 == 0 }
+
+func unswizzle16(data []byte, w, h int, psm PSM) []byte {
+	out := make([]byte, w*h*2)
+	if !paged16(w, h) {
+		copy(out, data)
+		return out
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			src := offset16(x, y, w, psm)
+			dst := (y*w + x) * 2
+			out[dst], out[dst+1] = data[src], data[src+1]
+		}
+	}
+	return out
+}
+
+func swizzle16(dst, linear []byte, w, h int, psm PSM) {
+	if !paged16(w, h) {
+		copy(dst, linear[:w*h*2])
+		return
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			d := offset16(x, y, w, psm)
+			src := (y*w + x) * 2
+			dst[d], dst[d+1] = linear[src], linear[src+1]
+		}
+	}
+}
+
+// Unswizzle16 and Swizzle16 convert PSMCT16 data.
+func Unswizzle16(data []byte, width, height int) []byte {
+	return unswizzle16(data, width, height, PSMCT16)
+}
+
+func Swizzle16(linearData []byte, width, height int) []byte {
+	out := make([]byte, width*height*2)
+	swizzle16(out, linearData, width, height, PSMCT16)
+	return out
+}
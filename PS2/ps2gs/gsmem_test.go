@@ -0,0 +1,109 @@
+package ps2gs
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+var allPSMs = []PSM{PSMCT32, PSMCT16, PSMCT16S, PSMT8, PSMT4, PSMT8H, PSMT4HL, PSMT4HH}
+
+var sizes = []int{1, 2, 3, 4, 8, 12, 15, 16, 24, 32, 48, 64, 96, 128, 160, 192, 224, 240, 256, 320, 384, 448, 512, 640}
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, psm := range allPSMs {
+		for _, w := range sizes {
+			for _, h := range sizes {
+				linear := make([]byte, (w*h*psm.Bits()+7)/8)
+				rng.Read(linear)
+				if psm.Bits() == 4 && w*h%2 == 1 {
+					linear[len(linear)-1] &= 0xF
+				}
+				sw, err := Swizzle(linear, w, h, psm)
+				if checkSize(w, h, psm) != nil {
+					if err == nil {
+						t.Errorf("%s %dx%d: Swizzle succeeded on an unsupported size", psm, w, h)
+					}
+					if _, err := Unswizzle(make([]byte, DataSize(w, h, psm)), w, h, psm); err == nil {
+						t.Errorf("%s %dx%d: Unswizzle succeeded on an unsupported size", psm, w, h)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("%s %dx%d: Swizzle: %v", psm, w, h, err)
+					continue
+				}
+				back, err := Unswizzle(sw, w, h, psm)
+				if err != nil {
+					t.Errorf("%s %dx%d: Unswizzle: %v", psm, w, h, err)
+					continue
+				}
+				if !bytes.Equal(back, linear) {
+					t.Errorf("%s %dx%d: round trip differs", psm, w, h)
+				}
+			}
+		}
+	}
+}
+
+// Unswizzle4By8 and Swizzle4By8 go through the PSMT8 size checks.
+func TestRoundTrip4By8(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, w := range sizes {
+		for _, h := range sizes {
+			linear := make([]byte, (w*h+1)/2)
+			rng.Read(linear)
+			if w*h%2 == 1 {
+				linear[len(linear)-1] &= 0xF
+			}
+			sw, err := Swizzle4By8(linear, w, h)
+			if checkSize(w, h, PSMT8) != nil {
+				if err == nil {
+					t.Errorf("%dx%d: Swizzle4By8 succeeded on an unsupported size", w, h)
+				}
+				if _, err := Unswizzle4By8(make([]byte, len(linear)), w, h); err == nil {
+					t.Errorf("%dx%d: Unswizzle4By8 succeeded on an unsupported size", w, h)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%dx%d: Swizzle4By8: %v", w, h, err)
+				continue
+			}
+			back, err := Unswizzle4By8(sw, w, h)
+			if err != nil {
+				t.Errorf("%dx%d: Unswizzle4By8: %v", w, h, err)
+				continue
+			}
+			if !bytes.Equal(back, linear) {
+				t.Errorf("%dx%d: round trip differs", w, h)
+			}
+		}
+	}
+}
+
+func TestUnsupportedSizes(t *testing.T) {
+	for _, c := range []struct {
+		psm  PSM
+		w, h int
+	}{
+		{PSMT4, 640, 448}, {PSMT4, 320, 224}, {PSMT4, 320, 240}, {PSMT4, 160, 128}, {PSMT4, 48, 24},
+		{PSMT8, 24, 16}, {PSMT8, 24, 640},
+	} {
+		if _, err := Swizzle(make([]byte, DataSize(c.w, c.h, c.psm)), c.w, c.h, c.psm); err == nil {
+			t.Errorf("%s %dx%d: Swizzle succeeded", c.psm, c.w, c.h)
+		}
+	}
+	for _, c := range []struct {
+		psm  PSM
+		w, h int
+	}{
+		{PSMT4, 32, 16}, {PSMT4, 96, 80}, {PSMT4, 640, 512}, {PSMT4, 16, 640},
+		{PSMT8, 16, 4}, {PSMT8, 640, 448}, {PSMT8, 24, 3},
+	} {
+		if err := checkSize(c.w, c.h, c.psm); err != nil {
+			t.Errorf("%s %dx%d: %v", c.psm, c.w, c.h, err)
+		}
+	}
+}
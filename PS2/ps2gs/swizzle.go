@@ -1,12 +1,12 @@
 
 /*
-Package swizzle implements PlayStation 2 texture swizzling and unswizzling algorithms.
+Package ps2gs implements PlayStation 2 texture swizzling and unswizzling algorithms.
 
 Author: aikika/ailyth99
 Date: 2025.11
 License: GPL-3.0
 ------------------------------------------------------------------------------
-Portions of the pixel swizzling algorithms (specifically Unswizzle4/Native and LUTs) 
+Portions of the pixel swizzling algorithms (specifically unswizzle4/Native and LUTs) 
 are derived from the Python library "reversebox".
 Original Author: Copyright © 2024-2025 Bartłomiej Duda
 License: GPL-3.0
@@ -18,7 +18,7 @@ the Free Software Foundation, either version 3 of the License, or
 (at your option) any later version.
 */
 
-package main
+package ps2gs
 
 // ---------------------------------------------------------------------------
 // Part 1: 调色板重排 (Palette / CLUT Swizzling)
@@ -69,10 +69,10 @@ func UnswizzleCSM1_32(entries []uint32) []uint32 {
 }
 
 // ---------------------------------------------------------------------------
-// Part 2: 像素重排 - 基础 & 8/16/32bpp
+// Part 2: 像素重排 - 8bpp (16/32bpp见gsmem.go)
 // ---------------------------------------------------------------------------
 
-func Unswizzle8(data []byte, width, height int) []byte {
+func unswizzle8(data []byte, width, height int) []byte {
 	out := make([]byte, len(data))
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
@@ -97,101 +97,40 @@ func Unswizzle8(data []byte, width, height int) []byte {
 	return out
 }
 
-func Unswizzle16(data []byte, width, height int) []byte {
-	out := make([]byte, len(data))
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			swizzledOffset := pixel16Offset(x, y, width)
-			srcIdx := swizzledOffset * 2
-			dstIdx := (y*width + x) * 2
-			if srcIdx+1 < len(data) && dstIdx+1 < len(out) {
-				out[dstIdx] = data[srcIdx]
-				out[dstIdx+1] = data[srcIdx+1]
-			}
-		}
+// ---------------------------------------------------------------------------
+// Part 3: 像素重排 - 4bpp
+// ---------------------------------------------------------------------------
+
+// Unswizzle4By8 is for games that store 4bpp texels in the PSMT8 layout: the
+// nibbles are unpacked to bytes, unswizzled as PSMT8 and packed again.
+func Unswizzle4By8(data []byte, width, height int) ([]byte, error) {
+	linear, err := Unswizzle(unpack4(data, width*height), width, height, PSMT8)
+	if err != nil {
+		return nil, err
 	}
-	return out
+	return pack4(linear), nil
 }
 
-func Unswizzle32(data []byte, width, height int) []byte {
-	out := make([]byte, len(data))
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			// 32bpp通常可以看作是4倍宽度的 8bpp 或者是2倍宽度的16bpp
-			// 但这里使用类似8bpp的Zorder逻辑映射4字节块
-			blockLoc := (y & (^0xF)) * width + (x & (^0xF)) * 2
-			swapSel := (((y + 2) >> 2) & 0x1) * 4
-			posY := (((y & (^3)) >> 1) + (y & 1)) & 0x7
-			colLoc := posY * width * 2 + ((x + swapSel) & 0x7) * 4
-			byteNum := ((y >> 1) & 1) + ((x >> 2) & 2)
-			
-			swizzleIdx := blockLoc + colLoc + byteNum
-
-			srcIdx := swizzleIdx * 4
-			dstIdx := (y*width + x) * 4
-			
-			if srcIdx+3 < len(data) && dstIdx+3 < len(out) {
-				copy(out[dstIdx:dstIdx+4], data[srcIdx:srcIdx+4])
-			}
+// unpack4 splits packed 4bpp texels, low nibble first, into n bytes.
+func unpack4(data []byte, n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		if i/2 < len(data) {
+			out[i] = data[i/2] >> (4 * (i & 1)) & 0x0F
 		}
 	}
 	return out
 }
 
-func pixel16Offset(x, y, width int) int {
-	bit := 0
-	if width >= 16 {
-		pageX := x >> 6
-		pageY := y >> 6
-		newX := (y & 0x38) + (x & 0x07)
-		newY := ((x & 0x30) >> 1) + (y & 0x07)
-		bit = (x & 0x08) << 1
-		x = (pageX << 6) + newX
-		y = (pageY << 5) + newY
-	}
-	return 32*(y*width+x) + bit
-}
-
-// ---------------------------------------------------------------------------
-// Part 3: 像素重排 - 4bpp
-// ---------------------------------------------------------------------------
-
-func Unswizzle4By8(data []byte, width, height int) []byte {
-	// 1. Unpack 4bpp -> 8bpp
-	// Low nibble (0-3 bits) -> Even index
-	// High nibble (4-7 bits) -> Odd index
-	temp8 := make([]byte, width*height)
-	for i := 0; i < len(data); i++ {
-		b := data[i]
-		if i*2 < len(temp8) {
-			temp8[i*2] = b & 0x0F
-		}
-		if i*2+1 < len(temp8) {
-			temp8[i*2+1] = (b >> 4) & 0x0F
-		}
-	}
-
-	// 2. 8bpp Unswizzle
-	unswizzled8 := Unswizzle8(temp8, width, height)
-
-	// 3. Repack 8bpp -> 4bpp
-	out := make([]byte, len(data))
-	for i := 0; i < len(out); i++ {
-		p1 := uint8(0)
-		p2 := uint8(0)
-		
-		if i*2 < len(unswizzled8) {
-			p1 = unswizzled8[i*2] & 0x0F
-		}
-		if i*2+1 < len(unswizzled8) {
-			p2 = unswizzled8[i*2+1] & 0x0F
-		}
-		out[i] = p1 | (p2 << 4)
+func pack4(texels []byte) []byte {
+	out := make([]byte, (len(texels)+1)/2)
+	for i, t := range texels {
+		out[i/2] |= (t & 0x0F) << (4 * (i & 1))
 	}
 	return out
 }
 
-func Unswizzle4(data []byte, width, height int) []byte {
+func unswizzle4(data []byte, width, height int) []byte {
 	const (
 		psmt4PageW  = 128
 		psmt4PageH  = 128
@@ -288,7 +227,7 @@ func SwapNibbles(data []byte) []byte {
 }
 
 // ---------------------------------------------------------------------------
-// Internal LUTs for Unswizzle4
+// Internal LUTs for unswizzle4
 // ---------------------------------------------------------------------------
 
 var unswizzleLutTable = [256]uint8{
@@ -388,7 +327,7 @@ func unswizzle4ConvertPage(width, height int, inputPageData []byte, index32H, in
 // Part 5: 反向操作 - 像素重排 (Swizzling: Linear -> PS2 Raw)
 // ===========================================================================
 
-func Swizzle8(linearData []byte, width, height int) []byte {
+func swizzle8(linearData []byte, width, height int) []byte {
 	out := make([]byte, len(linearData))
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
@@ -409,71 +348,13 @@ func Swizzle8(linearData []byte, width, height int) []byte {
 	return out
 }
 
-func Swizzle4By8(linearData []byte, width, height int) []byte {
-	// 1. Unpack 4bpp Linear -> 8bpp Linear
-	temp8 := make([]byte, width*height)
-	for i := 0; i < len(linearData); i++ {
-		temp8[i*2] = linearData[i] & 0x0F
-		if i*2+1 < len(temp8) {
-			temp8[i*2+1] = (linearData[i] >> 4) & 0x0F
-		}
-	}
-
-	swizzled8 := Swizzle8(temp8, width, height)
-
-	out := make([]byte, len(linearData))
-	for i := 0; i < len(out); i++ {
-		p1 := uint8(0)
-		p2 := uint8(0)
-		if i*2 < len(swizzled8) {
-			p1 = swizzled8[i*2] & 0x0F
-		}
-		if i*2+1 < len(swizzled8) {
-			p2 = swizzled8[i*2+1] & 0x0F
-		}
-		out[i] = p1 | (p2 << 4)
+// Swizzle4By8 is the inverse of Unswizzle4By8.
+func Swizzle4By8(linearData []byte, width, height int) ([]byte, error) {
+	swizzled, err := Swizzle(unpack4(linearData, width*height), width, height, PSMT8)
+	if err != nil {
+		return nil, err
 	}
-	return out
-}
-
-func Swizzle16(linearData []byte, width, height int) []byte {
-	out := make([]byte, len(linearData))
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			swizzledOffset := pixel16Offset(x, y, width)
-			dstIdx := swizzledOffset * 2
-			srcIdx := (y*width + x) * 2
-			
-			if dstIdx+1 < len(out) && srcIdx+1 < len(linearData) {
-				out[dstIdx] = linearData[srcIdx]
-				out[dstIdx+1] = linearData[srcIdx+1]
-			}
-		}
-	}
-	return out
-}
-
-func Swizzle32(linearData []byte, width, height int) []byte {
-	out := make([]byte, len(linearData))
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			blockLoc := (y & (^0xF)) * width + (x & (^0xF)) * 2
-			swapSel := (((y + 2) >> 2) & 0x1) * 4
-			posY := (((y & (^3)) >> 1) + (y & 1)) & 0x7
-			colLoc := posY * width * 2 + ((x + swapSel) & 0x7) * 4
-			byteNum := ((y >> 1) & 1) + ((x >> 2) & 2)
-			
-			swizzleIdx := blockLoc + colLoc + byteNum
-
-			dstIdx := swizzleIdx * 4
-			srcIdx := (y*width + x) * 4
-			
-			if dstIdx+3 < len(out) && srcIdx+3 < len(linearData) {
-				copy(out[dstIdx:dstIdx+4], linearData[srcIdx:srcIdx+4])
-			}
-		}
-	}
-	return out
+	return pack4(swizzled), nil
 }
 
 // ===========================================================================
@@ -527,7 +408,7 @@ func SwizzleCSM1_16(entries []uint16) []uint16 {
 // Part 5.5: 补充 - 4bpp Native Swizzle 
 // ===========================================================================
 
-func Swizzle4(linearData []byte, width, height int) []byte {
+func swizzle4(linearData []byte, width, height int) []byte {
 	const (
 		psmt4PageW   = 128
 		psmt4PageH   = 128
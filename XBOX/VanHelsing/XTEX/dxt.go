@@ -0,0 +1,498 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// BC1/BC2/BC3 (DXT1/DXT3/DXT5) block codec. Blocks are 4x4 pixels stored
+// row-major; pixel i of a block is (i%4, i/4).
+
+func dxtBlockSize(format string) int {
+	if format == "DXT1" {
+		return 8
+	}
+	return 16
+}
+
+func dxtDataSize(w, h int, format string) int {
+	return ((w + 3) / 4) * ((h + 3) / 4) * dxtBlockSize(format)
+}
+
+func expand565(c uint16) [3]int {
+	r := int(c>>11) & 0x1f
+	g := int(c>>5) & 0x3f
+	b := int(c) & 0x1f
+	return [3]int{r<<3 | r>>2, g<<2 | g>>4, b<<3 | b>>2}
+}
+
+func pack565(r, g, b int) uint16 {
+	return uint16((r*31+127)/255)<<11 | uint16((g*63+127)/255)<<5 | uint16((b*31+127)/255)
+}
+
+// colorPalette returns the four colors of a color block. In three-color mode
+// (c0 <= c1, DXT1 only) entry 3 is transparent black.
+func colorPalette(c0, c1 uint16, fourColor bool) [4][4]int {
+	a, b := expand565(c0), expand565(c1)
+	var p [4][4]int
+	for i := 0; i < 3; i++ {
+		p[0][i] = a[i]
+		p[1][i] = b[i]
+		if fourColor {
+			p[2][i] = (2*a[i] + b[i]) / 3
+			p[3][i] = (a[i] + 2*b[i]) / 3
+		} else {
+			p[2][i] = (a[i] + b[i]) / 2
+		}
+	}
+	p[0][3], p[1][3], p[2][3] = 255, 255, 255
+	if fourColor {
+		p[3][3] = 255
+	}
+	return p
+}
+
+func alphaPalette(a0, a1 int) [8]int {
+	p := [8]int{a0, a1}
+	if a0 > a1 {
+		for i := 1; i < 7; i++ {
+			p[i+1] = ((7-i)*a0 + i*a1) / 7
+		}
+	} else {
+		for i := 1; i < 5; i++ {
+			p[i+1] = ((5-i)*a0 + i*a1) / 5
+		}
+		p[6], p[7] = 0, 255
+	}
+	return p
+}
+
+// decodeDXT decodes a block-compressed surface into an NRGBA image.
+func decodeDXT(data []byte, w, h int, format string) (*image.NRGBA, error) {
+	if len(data) < dxtDataSize(w, h, format) {
+		return nil, fmt.Errorf("%s data too short: %d < %d", format, len(data), dxtDataSize(w, h, format))
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	bs := dxtBlockSize(format)
+	pos := 0
+	for by := 0; by < h; by += 4 {
+		for bx := 0; bx < w; bx += 4 {
+			blk := data[pos : pos+bs]
+			pos += bs
+
+			var alpha [16]int
+			hasAlpha := false
+			switch format {
+			case "DXT3":
+				bits := binary.LittleEndian.Uint64(blk[0:8])
+				for i := 0; i < 16; i++ {
+					alpha[i] = int(bits>>(4*i)&0xf) * 17
+				}
+				hasAlpha = true
+			case "DXT5":
+				ap := alphaPalette(int(blk[0]), int(blk[1]))
+				bits := uint64(blk[2]) | uint64(blk[3])<<8 | uint64(blk[4])<<16 |
+					uint64(blk[5])<<24 | uint64(blk[6])<<32 | uint64(blk[7])<<40
+				for i := 0; i < 16; i++ {
+					alpha[i] = ap[bits>>(3*i)&7]
+				}
+				hasAlpha = true
+			}
+
+			cb := blk[bs-8:]
+			c0 := binary.LittleEndian.Uint16(cb[0:2])
+			c1 := binary.LittleEndian.Uint16(cb[2:4])
+			idx := binary.LittleEndian.Uint32(cb[4:8])
+			// DXT3/DXT5 color blocks are always four-color
+			pal := colorPalette(c0, c1, format != "DXT1" || c0 > c1)
+
+			for i := 0; i < 16; i++ {
+				x, y := bx+i%4, by+i/4
+				if x >= w || y >= h {
+					continue
+				}
+				c := pal[idx>>(2*i)&3]
+				a := c[3]
+				if hasAlpha {
+					a = alpha[i]
+				}
+				img.SetNRGBA(x, y, color.NRGBA{uint8(c[0]), uint8(c[1]), uint8(c[2]), uint8(a)})
+			}
+		}
+	}
+	return img, nil
+}
+
+// encodeDXT compresses an image. Width and height need not be multiples of 4;
+// edge blocks repeat the last row/column.
+func encodeDXT(img *image.NRGBA, format string) []byte {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	bs := dxtBlockSize(format)
+	out := make([]byte, 0, dxtDataSize(w, h, format))
+
+	for by := 0; by < h; by += 4 {
+		for bx := 0; bx < w; bx += 4 {
+			var px [16][4]int
+			for i := 0; i < 16; i++ {
+				x, y := bx+i%4, by+i/4
+				if x >= w {
+					x = w - 1
+				}
+				if y >= h {
+					y = h - 1
+				}
+				c := img.NRGBAAt(b.Min.X+x, b.Min.Y+y)
+				px[i] = [4]int{int(c.R), int(c.G), int(c.B), int(c.A)}
+			}
+
+			blk := make([]byte, bs)
+			switch format {
+			case "DXT1":
+				encodeColorBlock(blk, &px, true)
+			case "DXT3":
+				encodeAlphaDXT3(blk[0:8], &px)
+				encodeColorBlock(blk[8:16], &px, false)
+			case "DXT5":
+				encodeAlphaDXT5(blk[0:8], &px)
+				encodeColorBlock(blk[8:16], &px, false)
+			}
+			out = append(out, blk...)
+		}
+	}
+	return out
+}
+
+// colorFit holds a candidate color block and its squared error.
+type colorFit struct {
+	c0, c1 uint16
+	idx    uint32
+	err    int
+}
+
+// evalColors assigns each pixel to the closest palette entry. Pixels with
+// skip set are ignored for the error and get index 3 (transparent in
+// three-color mode).
+func evalColors(px *[16][4]int, skip *[16]bool, c0, c1 uint16, fourColor bool) colorFit {
+	pal := colorPalette(c0, c1, fourColor)
+	n := 4
+	if !fourColor {
+		n = 3
+	} else if c0 == c1 {
+		n = 1 // equal endpoints decode as three-color in DXT1
+	}
+	fit := colorFit{c0: c0, c1: c1}
+	for i := 0; i < 16; i++ {
+		if skip[i] {
+			fit.idx |= 3 << (2 * i)
+			continue
+		}
+		best, bestErr := 0, 1<<30
+		for j := 0; j < n; j++ {
+			dr := px[i][0] - pal[j][0]
+			dg := px[i][1] - pal[j][1]
+			db := px[i][2] - pal[j][2]
+			if e := dr*dr + dg*dg + db*db; e < bestErr {
+				best, bestErr = j, e
+			}
+		}
+		fit.idx |= uint32(best) << (2 * i)
+		fit.err += bestErr
+	}
+	return fit
+}
+
+// fitColors searches endpoints for one palette mode: principal-axis start,
+// least-squares refinement on the current assignment, then a greedy search
+// over neighbouring 565 endpoints.
+func fitColors(px *[16][4]int, skip *[16]bool, fourColor bool) colorFit {
+	var pts [][3]float64
+	for i := 0; i < 16; i++ {
+		if !skip[i] {
+			pts = append(pts, [3]float64{float64(px[i][0]), float64(px[i][1]), float64(px[i][2])})
+		}
+	}
+
+	var mean [3]float64
+	for _, p := range pts {
+		for k := 0; k < 3; k++ {
+			mean[k] += p[k]
+		}
+	}
+	for k := 0; k < 3; k++ {
+		mean[k] /= float64(len(pts))
+	}
+	var cov [3][3]float64
+	for _, p := range pts {
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				cov[i][j] += (p[i] - mean[i]) * (p[j] - mean[j])
+			}
+		}
+	}
+	axis := [3]float64{1, 1, 1}
+	for it := 0; it < 8; it++ {
+		var n [3]float64
+		for i := 0; i < 3; i++ {
+			n[i] = cov[i][0]*axis[0] + cov[i][1]*axis[1] + cov[i][2]*axis[2]
+		}
+		m := maxAbs(n)
+		if m == 0 {
+			break
+		}
+		for i := 0; i < 3; i++ {
+			axis[i] = n[i] / m
+		}
+	}
+	lo, hi := pts[0], pts[0]
+	loT, hiT := dot3(pts[0], axis), dot3(pts[0], axis)
+	for _, p := range pts[1:] {
+		t := dot3(p, axis)
+		if t < loT {
+			lo, loT = p, t
+		}
+		if t > hiT {
+			hi, hiT = p, t
+		}
+	}
+
+	order := func(a, b uint16) (uint16, uint16) {
+		if (fourColor && a < b) || (!fourColor && a > b) {
+			return b, a
+		}
+		return a, b
+	}
+	c0, c1 := order(pack565f(hi), pack565f(lo))
+	best := evalColors(px, skip, c0, c1, fourColor)
+
+	// least squares on the palette weights of the current assignment
+	for it := 0; it < 4; it++ {
+		a, b, ok := leastSquares(px, skip, best, fourColor)
+		if !ok {
+			break
+		}
+		c0, c1 := order(pack565f(a), pack565f(b))
+		fit := evalColors(px, skip, c0, c1, fourColor)
+		if fit.err >= best.err {
+			break
+		}
+		best = fit
+	}
+
+	// greedy endpoint search, one 565 step per channel at a time
+	shifts := []int{11, 5, 0}
+	for improved := true; improved && best.err > 0; {
+		improved = false
+		for e := 0; e < 2; e++ {
+			for _, s := range shifts {
+				for _, d := range []int{-1, 1} {
+					ends := [2]uint16{best.c0, best.c1}
+					v, ok := step565(ends[e], s, d)
+					if !ok {
+						continue
+					}
+					ends[e] = v
+					c0, c1 := order(ends[0], ends[1])
+					if fit := evalColors(px, skip, c0, c1, fourColor); fit.err < best.err {
+						best, improved = fit, true
+					}
+				}
+			}
+		}
+	}
+	return best
+}
+
+func step565(c uint16, shift, d int) (uint16, bool) {
+	mask := 0x1f
+	if shift == 5 {
+		mask = 0x3f
+	}
+	v := int(c)>>shift&mask + d
+	if v < 0 || v > mask {
+		return c, false
+	}
+	return c&^uint16(mask<<shift) | uint16(v<<shift), true
+}
+
+// leastSquares solves for the two endpoints that minimise the error for the
+// palette indices of fit.
+func leastSquares(px *[16][4]int, skip *[16]bool, fit colorFit, fourColor bool) ([3]float64, [3]float64, bool) {
+	weights := []float64{1, 0, 2.0 / 3, 1.0 / 3}
+	if !fourColor {
+		weights = []float64{1, 0, 0.5, 0}
+	}
+	var aa, bb, ab float64
+	var ax, bx [3]float64
+	for i := 0; i < 16; i++ {
+		j := fit.idx >> (2 * i) & 3
+		if skip[i] || (!fourColor && j == 3) {
+			continue
+		}
+		alpha := weights[j]
+		beta := 1 - alpha
+		aa += alpha * alpha
+		bb += beta * beta
+		ab += alpha * beta
+		for k := 0; k < 3; k++ {
+			ax[k] += alpha * float64(px[i][k])
+			bx[k] += beta * float64(px[i][k])
+		}
+	}
+	det := aa*bb - ab*ab
+	if det == 0 {
+		return ax, bx, false
+	}
+	var a, b [3]float64
+	for k := 0; k < 3; k++ {
+		a[k] = (ax[k]*bb - bx[k]*ab) / det
+		b[k] = (bx[k]*aa - ax[k]*ab) / det
+	}
+	return a, b, true
+}
+
+func encodeColorBlock(blk []byte, px *[16][4]int, dxt1 bool) {
+	var skip [16]bool
+	transparent := 0
+	if dxt1 {
+		for i := 0; i < 16; i++ {
+			if px[i][3] < 128 {
+				skip[i] = true
+				transparent++
+			}
+		}
+	}
+
+	var best colorFit
+	switch {
+	case transparent == 16:
+		best = colorFit{c0: 0, c1: 0xffff, idx: 0xffffffff}
+	case transparent > 0:
+		best = fitColors(px, &skip, false)
+	default:
+		best = fitColors(px, &skip, true)
+		if dxt1 {
+			// opaque DXT1 blocks may still be better in three-color mode
+			if alt := fitColors(px, &skip, false); alt.err < best.err {
+				best = alt
+			}
+		}
+	}
+
+	binary.LittleEndian.PutUint16(blk[0:2], best.c0)
+	binary.LittleEndian.PutUint16(blk[2:4], best.c1)
+	binary.LittleEndian.PutUint32(blk[4:8], best.idx)
+}
+
+func encodeAlphaDXT3(blk []byte, px *[16][4]int) {
+	var bits uint64
+	for i := 0; i < 16; i++ {
+		bits |= uint64((px[i][3]*15+127)/255) << (4 * i)
+	}
+	binary.LittleEndian.PutUint64(blk, bits)
+}
+
+func evalAlpha(px *[16][4]int, a0, a1 int) (uint64, int) {
+	pal := alphaPalette(a0, a1)
+	var bits uint64
+	total := 0
+	for i := 0; i < 16; i++ {
+		best, bestErr := 0, 1<<30
+		for j := 0; j < 8; j++ {
+			d := px[i][3] - pal[j]
+			if d*d < bestErr {
+				best, bestErr = j, d*d
+			}
+		}
+		bits |= uint64(best) << (3 * i)
+		total += bestErr
+	}
+	return bits, total
+}
+
+// encodeAlphaDXT5 tries the eight-value mode around the block's alpha range
+// and the six-value mode (with explicit 0 and 255) around the range of the
+// remaining values, and keeps the better one.
+func encodeAlphaDXT5(blk []byte, px *[16][4]int) {
+	lo, hi := 255, 0
+	lo6, hi6 := 255, 0
+	for i := 0; i < 16; i++ {
+		a := px[i][3]
+		if a < lo {
+			lo = a
+		}
+		if a > hi {
+			hi = a
+		}
+		if a != 0 && a != 255 {
+			if a < lo6 {
+				lo6 = a
+			}
+			if a > hi6 {
+				hi6 = a
+			}
+		}
+	}
+
+	bestA0, bestA1 := hi, lo
+	bestBits, bestErr := evalAlpha(px, hi, lo)
+	try := func(a0, a1 int) {
+		if a0 < 0 || a1 < 0 || a0 > 255 || a1 > 255 {
+			return
+		}
+		if bits, e := evalAlpha(px, a0, a1); e < bestErr {
+			bestA0, bestA1, bestBits, bestErr = a0, a1, bits, e
+		}
+	}
+	if hi > lo {
+		for d0 := -2; d0 <= 2; d0++ {
+			for d1 := -2; d1 <= 2; d1++ {
+				if hi+d0 > lo+d1 {
+					try(hi+d0, lo+d1)
+				}
+			}
+		}
+	}
+	if lo6 > hi6 {
+		lo6, hi6 = 0, 0
+	}
+	try(lo6, hi6)
+
+	blk[0], blk[1] = uint8(bestA0), uint8(bestA1)
+	for i := 0; i < 6; i++ {
+		blk[2+i] = uint8(bestBits >> (8 * i))
+	}
+}
+
+func pack565f(c [3]float64) uint16 {
+	return pack565(clamp255(c[0]), clamp255(c[1]), clamp255(c[2]))
+}
+
+func clamp255(v float64) int {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return int(v + 0.5)
+}
+
+func dot3(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func maxAbs(v [3]float64) float64 {
+	m := 0.0
+	for _, x := range v {
+		if x < 0 {
+			x = -x
+		}
+		if x > m {
+			m = x
+		}
+	}
+	return m
+}
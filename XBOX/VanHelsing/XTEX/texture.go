@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// texFormat describes an Xbox D3DFORMAT (byte 17 of the XTEX header).
+// Uncompressed formats are stored swizzled, block formats linearly.
+type texFormat struct {
+	Name string
+	Code uint8
+	Bpp  int // bits per pixel of uncompressed formats, 0 for DXT
+}
+
+var xboxFormats = []texFormat{
+	{"R5G6B5", 0x05, 16},
+	{"A8R8G8B8", 0x06, 32},
+	{"P8", 0x0B, 8},
+	{"DXT1", 0x0C, 0},
+	{"DXT3", 0x0E, 0},
+	{"DXT5", 0x0F, 0},
+}
+
+func formatByCode(code uint8) (texFormat, bool) {
+	for _, f := range xboxFormats {
+		if f.Code == code {
+			return f, true
+		}
+	}
+	return texFormat{}, false
+}
+
+func formatByName(name string) (texFormat, bool) {
+	for _, f := range xboxFormats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return texFormat{}, false
+}
+
+func (f texFormat) isDXT() bool { return f.Bpp == 0 }
+
+// levelSize returns the byte size of one mip level.
+func (f texFormat) levelSize(w, h int) int {
+	if f.isDXT() {
+		return dxtDataSize(w, h, f.Name)
+	}
+	return w * h * f.Bpp / 8
+}
+
+// mipDims returns the size of mip level i; levels stop shrinking at 1.
+func mipDims(w, h, i int) (int, int) {
+	w >>= i
+	h >>= i
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// swizzleOffset returns the index of texel (x, y) in an Xbox swizzled
+// surface: the bits of x and y are interleaved (x in the lower bit) for as
+// long as both dimensions have bits left, the rest of the larger one follows.
+func swizzleOffset(x, y, w, h int) int {
+	off, bit := 0, 0
+	for mask := 1; mask < w || mask < h; mask <<= 1 {
+		if mask < w {
+			if x&mask != 0 {
+				off |= 1 << bit
+			}
+			bit++
+		}
+		if mask < h {
+			if y&mask != 0 {
+				off |= 1 << bit
+			}
+			bit++
+		}
+	}
+	return off
+}
+
+// decodeLevel decodes one mip level. pal is the A8R8G8B8 palette of P8
+// textures.
+func decodeLevel(data []byte, w, h int, f texFormat, pal []color.NRGBA) (*image.NRGBA, error) {
+	if f.isDXT() {
+		return decodeDXT(data, w, h, f.Name)
+	}
+	if len(data) < f.levelSize(w, h) {
+		return nil, fmt.Errorf("%s data too short: %d < %d", f.Name, len(data), f.levelSize(w, h))
+	}
+	if f.Name == "P8" && len(pal) < 256 {
+		return nil, fmt.Errorf("P8 texture without palette")
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := swizzleOffset(x, y, w, h)
+			var c color.NRGBA
+			switch f.Name {
+			case "A8R8G8B8":
+				p := data[i*4 : i*4+4]
+				c = color.NRGBA{p[2], p[1], p[0], p[3]}
+			case "R5G6B5":
+				rgb := expand565(binary.LittleEndian.Uint16(data[i*2:]))
+				c = color.NRGBA{uint8(rgb[0]), uint8(rgb[1]), uint8(rgb[2]), 255}
+			case "P8":
+				c = pal[data[i]]
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img, nil
+}
+
+// encodeLevel is the inverse of decodeLevel. P8 pixels are mapped to the
+// nearest palette entry.
+func encodeLevel(img *image.NRGBA, f texFormat, pal []color.NRGBA) []byte {
+	if f.isDXT() {
+		return encodeDXT(img, f.Name)
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	out := make([]byte, f.levelSize(w, h))
+	cache := make(map[color.NRGBA]uint8)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := swizzleOffset(x, y, w, h)
+			c := img.NRGBAAt(x, y)
+			switch f.Name {
+			case "A8R8G8B8":
+				out[i*4], out[i*4+1], out[i*4+2], out[i*4+3] = c.B, c.G, c.R, c.A
+			case "R5G6B5":
+				binary.LittleEndian.PutUint16(out[i*2:], pack565(int(c.R), int(c.G), int(c.B)))
+			case "P8":
+				idx, ok := cache[c]
+				if !ok {
+					idx = nearestColor(pal, c)
+					cache[c] = idx
+				}
+				out[i] = idx
+			}
+		}
+	}
+	return out
+}
+
+func nearestColor(pal []color.NRGBA, c color.NRGBA) uint8 {
+	best, bestErr := 0, 1<<30
+	for i, p := range pal {
+		dr := int(c.R) - int(p.R)
+		dg := int(c.G) - int(p.G)
+		db := int(c.B) - int(p.B)
+		da := int(c.A) - int(p.A)
+		if e := dr*dr + dg*dg + db*db + da*da; e < bestErr {
+			best, bestErr = i, e
+		}
+	}
+	return uint8(best)
+}
+
+// readPalette reads 256 A8R8G8B8 entries (stored B, G, R, A).
+func readPalette(data []byte) []color.NRGBA {
+	pal := make([]color.NRGBA, 256)
+	for i := range pal {
+		p := data[i*4 : i*4+4]
+		pal[i] = color.NRGBA{p[2], p[1], p[0], p[3]}
+	}
+	return pal
+}
+
+func writePalette(pal []color.NRGBA) []byte {
+	out := make([]byte, 256*4)
+	for i, c := range pal {
+		out[i*4], out[i*4+1], out[i*4+2], out[i*4+3] = c.B, c.G, c.R, c.A
+	}
+	return out
+}
+
+// downsample halves an image with a 2x2 box filter. Color is averaged with
+// alpha weighting so transparent texels do not bleed into the edges.
+func downsample(src *image.NRGBA) *image.NRGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	w, h := sw/2, sh/2
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, b, a, n int
+			for dy := 0; dy < 2; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					sx, sy := x*2+dx, y*2+dy
+					if sx >= sw || sy >= sh {
+						continue
+					}
+					c := src.NRGBAAt(sx, sy)
+					r += int(c.R) * int(c.A)
+					g += int(c.G) * int(c.A)
+					b += int(c.B) * int(c.A)
+					a += int(c.A)
+					n++
+				}
+			}
+			var c color.NRGBA
+			if a > 0 {
+				c = color.NRGBA{uint8((r + a/2) / a), uint8((g + a/2) / a), uint8((b + a/2) / a), uint8((a + n/2) / n)}
+			}
+			dst.SetNRGBA(x, y, c)
+		}
+	}
+	return dst
+}
@@ -4,10 +4,12 @@ import (
 	"encoding/binary"
 	"flag"
 	"fmt"
-	"io"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
 	"math"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
@@ -27,160 +29,248 @@ func log2(n uint32) uint8 {
 	return uint8(math.Log2(float64(n)))
 }
 
-func createDdsHeader(w, h uint32, format string) []byte {
-	hdr := make([]byte, 128)
-	copy(hdr[0:4], "DDS ")
-	binary.LittleEndian.PutUint32(hdr[4:8], 124) // Size
-	binary.LittleEndian.PutUint32(hdr[8:12], 0x00021007) // Flags
-	binary.LittleEndian.PutUint32(hdr[12:16], h)
-	binary.LittleEndian.PutUint32(hdr[16:20], w)
-	
-	linearSize := w * h
-	if format == "DXT1" {
-		linearSize = (w * h) / 2
-	}
-	binary.LittleEndian.PutUint32(hdr[20:24], linearSize)
-	binary.LittleEndian.PutUint32(hdr[28:32], 1) // MipMapCount
-
-	// Pixel Format
-	pf := hdr[76 : 76+32]
-	binary.LittleEndian.PutUint32(pf[0:4], 32)
-	binary.LittleEndian.PutUint32(pf[4:8], 0x04) // DDPF_FOURCC
-	copy(pf[8:12], format)
-
-	binary.LittleEndian.PutUint32(hdr[108:112], 0x1000) // Caps
-	return hdr
+// xtexInfo is what the tool needs from the 128-byte header. Bytes 16-19 are
+// the Xbox D3D format dword: byte 17 is the D3DFORMAT, the low nibble of
+// byte 18 the mip count and the high nibble log2(width), byte 19 log2(height).
+type xtexInfo struct {
+	Format  texFormat
+	W, H    int
+	Mips    int
+	DataOff int
 }
 
-func xtexToPng(xtexPath, outPng string, texconvPath string) error {
-	f, err := os.Open(xtexPath)
-	if err != nil {
-		return err
+func parseXtex(data []byte) (xtexInfo, error) {
+	var info xtexInfo
+	if len(data) < 128 || string(data[0:4]) != "XTEX" {
+		return info, fmt.Errorf("not an XTEX file")
 	}
-	defer f.Close()
-
-	var xhdr [32]byte
-	if _, err := io.ReadFull(f, xhdr[:]); err != nil {
-		return err
+	f, ok := formatByCode(data[17])
+	if !ok {
+		return info, fmt.Errorf("unsupported texture format 0x%02X", data[17])
 	}
-
-	if string(xhdr[0:4]) != "XTEX" {
-		return fmt.Errorf("not an XTEX file")
+	info.Format = f
+	info.W = 1 << (data[18] >> 4)
+	info.H = 1 << (data[19] & 0x0F)
+	info.Mips = int(data[18] & 0x0F)
+	if info.Mips == 0 {
+		info.Mips = 1
 	}
+	info.DataOff = int(binary.LittleEndian.Uint32(data[8:12]))
+	if info.DataOff == 0 || info.DataOff > len(data) {
+		info.DataOff = 128
+	}
+	return info, nil
+}
 
-	formatCode := binary.LittleEndian.Uint16(xhdr[16:18])
-	w := uint32(1) << (xhdr[18] >> 4)
-	h := uint32(1) << (xhdr[19])
-
-	formatStr := "DXT3"
-	if formatCode == 0x290C {
-		formatStr = "DXT1"
+// chainSize is the byte size of all mip levels.
+func (x xtexInfo) chainSize() int {
+	n := 0
+	for i := 0; i < x.Mips; i++ {
+		w, h := mipDims(x.W, x.H, i)
+		n += x.Format.levelSize(w, h)
 	}
+	return n
+}
 
-	fmt.Printf("[*] Converting XTEX %dx%d %s to PNG...\n", w, h, formatStr)
+// xtexPalette returns the palette of a P8 texture: the 1024 bytes after the
+// mip chain, or palPath if given.
+func xtexPalette(data []byte, info xtexInfo, palPath string) ([]color.NRGBA, error) {
+	if info.Format.Name != "P8" {
+		return nil, nil
+	}
+	if palPath != "" {
+		raw, err := os.ReadFile(palPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) < 1024 {
+			return nil, fmt.Errorf("palette file too short: %d bytes", len(raw))
+		}
+		return readPalette(raw), nil
+	}
+	end := info.DataOff + info.chainSize()
+	if len(data) < end+1024 {
+		return nil, fmt.Errorf("P8 texture has no palette after the mip chain, use -pal")
+	}
+	return readPalette(data[end:]), nil
+}
 
-	f.Seek(128, io.SeekStart)
-	data, err := io.ReadAll(f)
+func xtexToPng(xtexPath, outPng, palPath string, allMips bool) error {
+	data, err := os.ReadFile(xtexPath)
+	if err != nil {
+		return err
+	}
+	info, err := parseXtex(data)
+	if err != nil {
+		return err
+	}
+	pal, err := xtexPalette(data, info, palPath)
 	if err != nil {
 		return err
 	}
 
-	ddsHdr := createDdsHeader(w, h, formatStr)
-	tmpDds := xtexPath + ".tmp.dds"
-	outF, _ := os.Create(tmpDds)
-	outF.Write(ddsHdr)
-	outF.Write(data)
-	outF.Close()
-	defer os.Remove(tmpDds)
+	fmt.Printf("[*] Converting XTEX %dx%d %s (%d mips) to PNG...\n", info.W, info.H, info.Format.Name, info.Mips)
 
-	cmd := exec.Command(texconvPath, "-ft", "png", "-y", "-o", filepath.Dir(outPng), tmpDds)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("texconv error: %v\n%s", err, string(out))
+	levels := 1
+	if allMips {
+		levels = info.Mips
 	}
+	off := info.DataOff
+	for i := 0; i < levels; i++ {
+		w, h := mipDims(info.W, info.H, i)
+		img, err := decodeLevel(data[off:], w, h, info.Format, pal)
+		if err != nil {
+			return fmt.Errorf("mip %d: %w", i, err)
+		}
+		off += info.Format.levelSize(w, h)
 
- 
-	generatedPng := strings.TrimSuffix(filepath.Base(tmpDds), filepath.Ext(tmpDds)) + ".png"
-	generatedPng = filepath.Join(filepath.Dir(outPng), generatedPng)
-	
-	if generatedPng != outPng {
-		os.Rename(generatedPng, outPng)
+		out := outPng
+		if i > 0 {
+			out = fmt.Sprintf("%s_mip%d.png", strings.TrimSuffix(outPng, filepath.Ext(outPng)), i)
+		}
+		if err := savePng(out, img); err != nil {
+			return err
+		}
 	}
-
 	return nil
 }
 
-func pngToXtex(pngPath, outXtex string, texconvPath string, forceFormat string) error {
-	fmt.Printf("[*] Converting PNG to XTEX...\n")
-
-	format := "DXT3" //默认，字库就是这个
-	if forceFormat != "" {
-		format = strings.ToUpper(forceFormat)
+func savePng(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
 	}
-
-	tmpDir := filepath.Join(os.TempDir(), "xtex_conv")
-	os.MkdirAll(tmpDir, 0755)
-	defer os.RemoveAll(tmpDir)
-
-	cmd := exec.Command(texconvPath, "-f", format, "-y", "-o", tmpDir, pngPath)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("texconv error: %v\n%s", err, string(out))
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		return err
 	}
+	return f.Close()
+}
 
-	ddsName := strings.TrimSuffix(filepath.Base(pngPath), filepath.Ext(pngPath)) + ".dds"
-	ddsPath := filepath.Join(tmpDir, ddsName)
+// pngToXtex encodes a PNG and regenerates its mip chain. With refPath the
+// header, format, mip count and palette come from an original XTEX; format
+// and mips override them when set (mips 0 = full chain, -1 = keep).
+func pngToXtex(pngPath, outXtex string, forceFormat, refPath, palPath string, mips int) error {
+	fmt.Printf("[*] Converting PNG to XTEX...\n")
 
-	fDds, err := os.Open(ddsPath)
+	fPng, err := os.Open(pngPath)
 	if err != nil {
 		return err
 	}
-	defer fDds.Close()
+	src, err := png.Decode(fPng)
+	fPng.Close()
+	if err != nil {
+		return err
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
 
-	var ddsHdr [128]byte
-	io.ReadFull(fDds, ddsHdr[:])
-	
-	w := binary.LittleEndian.Uint32(ddsHdr[16:20])
-	h := binary.LittleEndian.Uint32(ddsHdr[12:16])
-	
- 
-	pfFourCC := string(ddsHdr[84:88])
-	fmt.Printf("  - Detected DDS: %dx%d %s\n", w, h, pfFourCC)
+	w := uint32(img.Bounds().Dx())
+	h := uint32(img.Bounds().Dy())
+	if w&(w-1) != 0 || h&(h-1) != 0 {
+		return fmt.Errorf("size %dx%d is not a power of two", w, h)
+	}
 
+	format, _ := formatByName("DXT3") //默认，字库就是这个
 	xhdr := make([]byte, 128)
 	copy(xhdr[0:4], "XTEX")
-	binary.LittleEndian.PutUint32(xhdr[4:8], 0x00040001)  
- 
 	xhdr[4] = 0x01; xhdr[6] = 0x04
-	
-	binary.LittleEndian.PutUint32(xhdr[8:12], 128)  
-	
-	if pfFourCC == "DXT1" {
-		xhdr[16] = 0x29; xhdr[17] = 0x0C
-	} else {
-		xhdr[16] = 0x29; xhdr[17] = 0x0E
-	}
-	
-	xhdr[18] = (log2(w) << 4) | 1
-	xhdr[19] = log2(h)
-	
+
+	binary.LittleEndian.PutUint32(xhdr[8:12], 128)
+
+	xhdr[16] = 0x29
+
 	for i := 24; i < 128; i++ {
 		xhdr[i] = 0xFF
 	}
-	 
 
-	fOut, _ := os.Create(outXtex)
+	levels := 1
+	var pal []color.NRGBA
+	if refPath != "" {
+		ref, err := os.ReadFile(refPath)
+		if err != nil {
+			return err
+		}
+		info, err := parseXtex(ref)
+		if err != nil {
+			return fmt.Errorf("reference: %w", err)
+		}
+		format, levels = info.Format, info.Mips
+		xhdr = append([]byte(nil), ref[:info.DataOff]...)
+		if pal, err = xtexPalette(ref, info, palPath); err != nil {
+			return fmt.Errorf("reference: %w", err)
+		}
+	}
+	if forceFormat != "" {
+		f, ok := formatByName(strings.ToUpper(forceFormat))
+		if !ok {
+			return fmt.Errorf("unsupported format %s", forceFormat)
+		}
+		format = f
+	}
+	if format.Name == "P8" && pal == nil {
+		if palPath == "" {
+			return fmt.Errorf("P8 needs a palette: use -ref or -pal")
+		}
+		if pal, err = xtexPalette(nil, xtexInfo{Format: format}, palPath); err != nil {
+			return err
+		}
+	}
+
+	full := int(log2(max32(w, h))) + 1
+	switch {
+	case mips == 0:
+		levels = full
+	case mips > 0:
+		levels = mips
+	}
+	if levels > full {
+		levels = full
+	}
+	fmt.Printf("  - %dx%d %s, %d mips\n", w, h, format.Name, levels)
+
+	xhdr[17] = format.Code
+	xhdr[18] = (log2(w) << 4) | uint8(levels)
+	xhdr[19] = xhdr[19]&0xF0 | log2(h)
+
+	fOut, err := os.Create(outXtex)
+	if err != nil {
+		return err
+	}
+	defer fOut.Close()
 	fOut.Write(xhdr)
-	io.Copy(fOut, fDds)
-	fOut.Close()
 
-	return nil
+	level := img
+	for i := 0; i < levels; i++ {
+		if i > 0 {
+			level = downsample(level)
+		}
+		if _, err := fOut.Write(encodeLevel(level, format, pal)); err != nil {
+			return err
+		}
+	}
+	if pal != nil {
+		fOut.Write(writePalette(pal))
+	}
+	return fOut.Close()
+}
+
+func max32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
 }
 
 func main() {
 	uPtr := flag.String("u", "", "Unpack XTEX to PNG (XTEX_PATH)")
 	pPtr := flag.String("p", "", "Pack PNG to XTEX (PNG_PATH)")
 	oPtr := flag.String("o", "", "Output path")
-	fPtr := flag.String("f", "", "Force format (DXT1 or DXT3)")
-	tcPtr := flag.String("tc", `C:\TRANSLATE\PS2\VANHE\XBOX\XTEX\texconv.exe`, "Path to texconv.exe")
+	fPtr := flag.String("f", "", "Force format (DXT1, DXT3, DXT5, A8R8G8B8, R5G6B5 or P8)")
+	rPtr := flag.String("ref", "", "Pack: original XTEX to copy header, format, mip count and palette from")
+	mPtr := flag.Int("mips", -1, "Pack: mip levels to generate (0 = full chain, default: from -ref or 1)")
+	palPtr := flag.String("pal", "", "P8: raw 256-entry A8R8G8B8 palette file")
+	allPtr := flag.Bool("all", false, "Unpack: also write every mip level as NAME_mipN.png")
 
 	flag.Parse()
 
@@ -189,7 +279,7 @@ func main() {
 		if out == "" {
 			out = strings.TrimSuffix(*uPtr, filepath.Ext(*uPtr)) + ".png"
 		}
-		if err := xtexToPng(*uPtr, out, *tcPtr); err != nil {
+		if err := xtexToPng(*uPtr, out, *palPtr, *allPtr); err != nil {
 			fmt.Printf("[-] Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -199,7 +289,7 @@ func main() {
 		if out == "" {
 			out = strings.TrimSuffix(*pPtr, filepath.Ext(*pPtr)) + ".DDS"
 		}
-		if err := pngToXtex(*pPtr, out, *tcPtr, *fPtr); err != nil {
+		if err := pngToXtex(*pPtr, out, *fPtr, *rPtr, *palPtr, *mPtr); err != nil {
 			fmt.Printf("[-] Error: %v\n", err)
 			os.Exit(1)
 		}
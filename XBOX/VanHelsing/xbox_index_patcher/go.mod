@@ -1,3 +1,7 @@
 module xbox_index_patcher
 
 go 1.22.2
+
+require XBOX_ISO_TOOL v0.0.0
+
+replace XBOX_ISO_TOOL => ../../XBOX_ISO_TOOL
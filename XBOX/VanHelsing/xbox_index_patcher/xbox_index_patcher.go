@@ -1,6 +1,7 @@
 package main
 
 import (
+	"XBOX_ISO_TOOL/xiso"
 	"bytes"
 	"encoding/binary"
 	"encoding/csv"
@@ -163,18 +164,57 @@ func xboxParseCsv(csvPath string) (map[string]xboxRec, error) {
 	return res, nil
 }
 
-func xboxPatchIndex(origBin, csvPath, outBin string) error {
-	newMap, err := xboxParseCsv(csvPath)
+// xboxIsoRecs reads LBA and size of every file in a rebuilt ISO, keyed by
+// upper-case basename like xboxParseCsv and by full path (DATA\X.BIN).
+// Basenames that occur in more than one directory are left out of byBase
+// and listed in ambiguous.
+func xboxIsoRecs(r xiso.ReaderAt) (byBase, byPath map[string]xboxRec, ambiguous map[string]bool, err error) {
+	r, vol, err := xiso.OpenVolume(r)
 	if err != nil {
-		return err
+		return nil, nil, nil, fmt.Errorf("parse volume: %w", err)
 	}
-
-	data, err := os.ReadFile(origBin)
+	tree, err := xiso.FileTree(r, vol.Root)
 	if err != nil {
-		return err
+		return nil, nil, nil, fmt.Errorf("walk file tree: %w", err)
+	}
+
+	byBase = make(map[string]xboxRec)
+	byPath = make(map[string]xboxRec)
+	ambiguous = make(map[string]bool)
+	for _, fe := range tree {
+		if fe.Entry.IsDir() {
+			continue
+		}
+		size := fe.Entry.Size()
+		rec := xboxRec{
+			Name:    fe.Path(),
+			LBA:     fe.Entry.Node.Data.Sector,
+			Size:    size,
+			Sectors: xiso.SectorsNeeded(uint64(size)),
+		}
+		base := strings.ToUpper(fe.Entry.Name)
+		if _, dup := byBase[base]; dup || ambiguous[base] {
+			ambiguous[base] = true
+			delete(byBase, base)
+		} else {
+			byBase[base] = rec
+		}
+		byPath[xboxPathKey(fe.Path())] = rec
 	}
+	return byBase, byPath, ambiguous, nil
+}
+
+func xboxPathKey(p string) string {
+	p = strings.ReplaceAll(p, "/", "\\")
+	return strings.ToUpper(strings.TrimLeft(p, "\\"))
+}
+
+// xboxPatchData rewrites the size/LBA/sector fields of every record whose
+// basename is found in newMap, or whose full path is found in byPath, and
+// returns the number of patched records.
+func xboxPatchData(data []byte, newMap, byPath map[string]xboxRec, ambiguous map[string]bool) (int, error) {
 	if len(data) < 4 {
-		return fmt.Errorf("file too small")
+		return 0, fmt.Errorf("file too small")
 	}
 
 	count := binary.LittleEndian.Uint32(data[0:4])
@@ -199,7 +239,14 @@ func xboxPatchIndex(origBin, csvPath, outBin string) error {
 		rawName := xboxGetStr(data, fid)
 		base := strings.ToUpper(filepath.Base(rawName))
 
-		if info, ok := newMap[base]; ok {
+		info, ok := byPath[xboxPathKey(rawName)]
+		if !ok {
+			info, ok = newMap[base]
+		}
+		if !ok && ambiguous[base] {
+			fmt.Printf("  [!] %s exists in several directories, not patched\n", rawName)
+		}
+		if ok {
 			if i == 0 {
 				binary.LittleEndian.PutUint32(data[0x18:0x1C], info.Size)
 				binary.LittleEndian.PutUint32(data[0x20:0x24], info.LBA)
@@ -213,11 +260,87 @@ func xboxPatchIndex(origBin, csvPath, outBin string) error {
 			patched++
 		}
 	}
+	return patched, nil
+}
+
+func xboxPatchIndex(origBin, csvPath, outBin string) error {
+	newMap, err := xboxParseCsv(csvPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(origBin)
+	if err != nil {
+		return err
+	}
+	patched, err := xboxPatchData(data, newMap, nil, nil)
+	if err != nil {
+		return err
+	}
 
 	if err := os.WriteFile(outBin, data, 0644); err != nil {
 		return err
 	}
-	fmt.Printf("[+] Patched %d/%d entries -> %s\n", patched, count, outBin)
+	fmt.Printf("[+] Patched %d/%d entries -> %s\n", patched, binary.LittleEndian.Uint32(data[0:4]), outBin)
+	return nil
+}
+
+// xboxPatchFromIso patches INDEX.BIN with the layout of a rebuilt ISO. The
+// original index comes from origBin, or from indexPath inside the ISO when
+// origBin is empty. The result goes to outBin and/or, with inject, back into
+// the ISO in place (the size of INDEX.BIN does not change).
+func xboxPatchFromIso(isoPath, origBin, indexPath, outBin string, inject bool) error {
+	f, err := os.Open(isoPath)
+	if err != nil {
+		return err
+	}
+	byBase, byPath, ambiguous, err := xboxIsoRecs(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	idx, ok := byPath[xboxPathKey(indexPath)]
+	if !ok && !strings.ContainsAny(indexPath, "\\/") {
+		idx, ok = byBase[strings.ToUpper(indexPath)]
+	}
+	if !ok && (inject || origBin == "") {
+		f.Close()
+		return fmt.Errorf("%s not found in ISO", indexPath)
+	}
+
+	var data []byte
+	if origBin != "" {
+		data, err = os.ReadFile(origBin)
+	} else {
+		data, err = xiso.ReadFileData(f, idx.Name)
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	patched, err := xboxPatchData(data, byBase, byPath, ambiguous)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[+] Patched %d/%d entries from %s\n", patched, binary.LittleEndian.Uint32(data[0:4]), isoPath)
+
+	if outBin != "" {
+		if err := os.WriteFile(outBin, data, 0644); err != nil {
+			return err
+		}
+		fmt.Printf("[+] Saved %s\n", outBin)
+	}
+	if inject {
+		if uint32(len(data)) != idx.Size {
+			return fmt.Errorf("patched index is %d bytes, %s in ISO is %d", len(data), idx.Name, idx.Size)
+		}
+		if err := xiso.ReplaceFileData(isoPath, idx.Name, data, false); err != nil {
+			return fmt.Errorf("inject: %w", err)
+		}
+		fmt.Printf("[+] Injected %s into %s\n", idx.Name, isoPath)
+	}
 	return nil
 }
 
@@ -227,6 +350,9 @@ func main() {
 	iPtr := flag.String("i", "", "Input: CSV (patch) or BIN (extract)")
 	bPtr := flag.String("b", "", "Original index.bin to patch")
 	oPtr := flag.String("o", "", "Output: CSV or BIN path")
+	isoPtr := flag.String("iso", "", "Patch: take LBA/size from this rebuilt XISO instead of a CSV")
+	idxPtr := flag.String("index", "INDEX.BIN", "Patch: path of index.bin inside the ISO (used when -b is omitted or with -w)")
+	wPtr := flag.Bool("w", false, "Patch: write the patched index.bin back into the ISO")
 	flag.Parse()
 
 	if *ePtr && *iPtr != "" {
@@ -238,6 +364,18 @@ func main() {
 			fmt.Fprintf(os.Stderr, "[-] Extract error: %v\n", err)
 			os.Exit(1)
 		}
+	} else if *pPtr && *isoPtr != "" {
+		out := *oPtr
+		if out == "" && !*wPtr {
+			out = filepath.Base(*idxPtr) + ".patched"
+			if *bPtr != "" {
+				out = *bPtr + ".patched"
+			}
+		}
+		if err := xboxPatchFromIso(*isoPtr, *bPtr, *idxPtr, out, *wPtr); err != nil {
+			fmt.Fprintf(os.Stderr, "[-] Patch error: %v\n", err)
+			os.Exit(1)
+		}
 	} else if *pPtr && *iPtr != "" && *bPtr != "" {
 		out := *oPtr
 		if out == "" {
@@ -259,6 +397,11 @@ func main() {
 		fmt.Println("  Patch index.bin from CSV:")
 		fmt.Println("    xbox_index_patcher -p -b INDEX.BIN -i table.csv")
 		fmt.Println("    xbox_index_patcher -p -b INDEX.BIN -i table.csv -o INDEX_PATCHED.BIN")
+		fmt.Println()
+		fmt.Println("  Patch index.bin from a rebuilt ISO (no CSV needed):")
+		fmt.Println("    xbox_index_patcher -p -iso TESTXISO.iso -b INDEX.BIN -o INDEX_PATCHED.BIN")
+		fmt.Println("    xbox_index_patcher -p -iso TESTXISO.iso -w")
+		fmt.Println("    xbox_index_patcher -p -iso TESTXISO.iso -index DATA\\INDEX.BIN -w")
 		os.Exit(1)
 	}
 }
@@ -1,28 +1,51 @@
 package main
 
 import (
+	"XBOX_ISO_TOOL/xbe"
 	"XBOX_ISO_TOOL/xiso"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func main() {
 	extract := flag.String("e", "", "Extract ISO to folder")
+	workers := flag.Int("j", 4, "Extract: number of parallel workers")
+	manifest := flag.String("manifest", "", "Extract: CRC32/SHA-1 manifest (default: <output_dir>.manifest.csv)")
+	fast := flag.Bool("fast", false, "Extract: trust unchanged LBA/size when skipping instead of re-hashing image data")
 	repack := flag.String("r", "", "Repack folder to ISO")
 	output := flag.String("o", "", "Output path")
+	layout := flag.String("layout", "", "Repack: reference ISO or -tbl CSV whose file LBAs are kept")
 	tbl := flag.String("tbl", "", "Export LBA table as CSV")
+	tblImport := flag.String("tblimport", "", "Import edited LBA table CSV into -iso (moves file data)")
 	injectPath := flag.String("inject", "", "Inject: internal path (e.g. \\DATA\\INDEX.BIN)")
 	injectFile := flag.String("file", "", "Inject: local file to inject")
 	isoPath := flag.String("iso", "", "Inject: target ISO path")
+	grow := flag.Bool("grow", false, "Inject: relocate the file when it is larger than the original")
 	renamePath := flag.String("rename", "", "Rename: internal path (e.g. CHARS\\FONT.BIN)")
 	renameNew := flag.String("newname", "", "Rename: new filename")
-	appendFile := flag.String("append", "", "Append: local file to append to ISO")
+	appendFile := flag.String("append", "", "Append: local file or directory to append to ISO")
 	appendDir := flag.String("dir", "", "Append: target directory in ISO (e.g. DATA)")
-	appendName := flag.String("name", "", "Append: filename in ISO (default: same as local file)")
+	appendName := flag.String("name", "", "Append: file or directory name in ISO (default: same as local name)")
 	getPath := flag.String("get", "", "Extract single file: internal path (e.g. DATA\\INDEX.BIN)")
+	deletePath := flag.String("delete", "", "Delete: internal path of file or directory (e.g. MEDIA\\DEMO.XMV)")
+	zero := flag.Bool("zero", false, "Delete: overwrite freed sectors with zeros")
+	patchFile := flag.String("patch", "", "Patch: JSON manifest of operations to apply to -iso")
+	journal := flag.String("journal", "", "Patch: undo journal path (default: <iso>.undo)")
+	rollback := flag.Bool("rollback", false, "Restore -iso from its undo journal")
+	diffA := flag.String("diff", "", "Diff: first ISO (second ISO follows as argument)")
+	jsonOut := flag.Bool("json", false, "Diff: write JSON instead of text")
+	compact := flag.String("compact", "", "Compact: rewrite ISO without dead sectors")
+	pinList := flag.String("pin", "", "Compact: list of ISO paths (or -tbl CSV) that keep their LBA")
+	xbePath := flag.String("xbe", "", "XBE: show header; internal path with -iso (e.g. default.xbe), else local file")
+	xbeTitle := flag.String("title", "", "XBE: new certificate title")
+	xbeRegion := flag.String("region", "", "XBE: new game region flags (hex, e.g. 0x7)")
+	xbeMedia := flag.String("media", "", "XBE: new allowed media flags (hex)")
+	xbeVA := flag.String("va", "", "XBE: virtual address to map to a file offset (hex)")
 	flag.Parse()
 
 	// -tbl mode
@@ -36,13 +59,67 @@ func main() {
 		return
 	}
 
+	// -xbe mode
+	if *xbePath != "" {
+		doXbe(*isoPath, *xbePath, *output, *xbeTitle, *xbeRegion, *xbeMedia, *xbeVA)
+		return
+	}
+
+	// -compact mode
+	if *compact != "" {
+		outPath := *output
+		if outPath == "" {
+			outPath = strings.TrimSuffix(*compact, filepath.Ext(*compact)) + "_compact.iso"
+		}
+		doCompact(*compact, outPath, *pinList)
+		return
+	}
+
+	// -diff mode
+	if *diffA != "" {
+		if flag.NArg() < 1 {
+			fmt.Fprintln(os.Stderr, "Diff requires two ISOs: -diff a.iso b.iso")
+			os.Exit(1)
+		}
+		doDiff(*diffA, flag.Arg(0), *output, *jsonOut)
+		return
+	}
+
+	// -patch mode
+	if *patchFile != "" || *rollback {
+		if *isoPath == "" {
+			fmt.Fprintln(os.Stderr, "Patch and rollback require -iso")
+			os.Exit(1)
+		}
+		journalPath := *journal
+		if journalPath == "" {
+			journalPath = *isoPath + ".undo"
+		}
+		if *rollback {
+			doRollback(*isoPath, journalPath)
+		} else {
+			doPatch(*isoPath, *patchFile, journalPath)
+		}
+		return
+	}
+
+	// -tblimport mode
+	if *tblImport != "" {
+		if *isoPath == "" {
+			fmt.Fprintln(os.Stderr, "Table import requires -iso")
+			os.Exit(1)
+		}
+		doTblImport(*isoPath, *tblImport)
+		return
+	}
+
 	// -inject mode
 	if *injectPath != "" {
 		if *injectFile == "" || *isoPath == "" {
 			fmt.Fprintln(os.Stderr, "Inject requires -file and -iso")
 			os.Exit(1)
 		}
-		doInject(*isoPath, *injectPath, *injectFile)
+		doInject(*isoPath, *injectPath, *injectFile, *grow)
 		return
 	}
 
@@ -70,6 +147,16 @@ func main() {
 		return
 	}
 
+	// -delete mode
+	if *deletePath != "" {
+		if *isoPath == "" {
+			fmt.Fprintln(os.Stderr, "Delete requires -iso")
+			os.Exit(1)
+		}
+		doDelete(*isoPath, *deletePath, *zero)
+		return
+	}
+
 	// -get mode
 	if *getPath != "" {
 		if *isoPath == "" {
@@ -82,13 +169,13 @@ func main() {
 
 	// -e mode
 	if *extract != "" {
-		doExtract(*extract, *output)
+		doExtract(*extract, *output, *manifest, *workers, *fast)
 		return
 	}
 
 	// -r mode
 	if *repack != "" {
-		doRepack(*repack, *output)
+		doRepack(*repack, *output, *layout)
 		return
 	}
 
@@ -99,15 +186,24 @@ func main() {
 	fmt.Println("  Extract ISO to folder:")
 	fmt.Println("    XBOX_ISO_TOOL -e game.iso")
 	fmt.Println("    XBOX_ISO_TOOL -e game.iso -o output_dir")
+	fmt.Println("    XBOX_ISO_TOOL -e game.iso -o output_dir -j 8 -manifest files.csv")
+	fmt.Println("    (re-run skips unchanged files and re-extracts corrupted ones; -fast trusts unchanged LBA/size instead of re-hashing the ISO)")
 	fmt.Println()
 	fmt.Println("  Repack folder to ISO:")
 	fmt.Println("    XBOX_ISO_TOOL -r game_dir")
 	fmt.Println("    XBOX_ISO_TOOL -r game_dir -o output.iso")
 	fmt.Println()
+	fmt.Println("  Repack keeping the original LBAs (only grown or new files move):")
+	fmt.Println("    XBOX_ISO_TOOL -r game_dir -o output.iso -layout original.iso")
+	fmt.Println("    XBOX_ISO_TOOL -r game_dir -o output.iso -layout table.csv")
+	fmt.Println()
 	fmt.Println("  Export LBA table as CSV:")
 	fmt.Println("    XBOX_ISO_TOOL -tbl game.iso")
 	fmt.Println("    XBOX_ISO_TOOL -tbl game.iso -o table.csv")
 	fmt.Println()
+	fmt.Println("  Move files to the LBAs of an edited table (refuses overlapping layouts):")
+	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -tblimport table.csv")
+	fmt.Println()
 	fmt.Println("  Extract single file from ISO:")
 	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -get DATA\\INDEX.BIN")
 	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -get DATA\\INDEX.BIN -o output.bin")
@@ -115,6 +211,9 @@ func main() {
 	fmt.Println("  Inject (replace) file in-place (new file <= original size):")
 	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -inject \\DATA\\INDEX.BIN -file new_index.bin")
 	fmt.Println()
+	fmt.Println("  Inject larger file (moved to a free gap or the end of the ISO):")
+	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -inject \\DATA\\FONT.BIN -file new_font.bin -grow")
+	fmt.Println()
 	fmt.Println("  Rename file in ISO directory table:")
 	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -rename \\DATA\\FONT.BIN -newname 000")
 	fmt.Println()
@@ -122,10 +221,38 @@ func main() {
 	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -append new_font.bin -dir DATA -name FONT.BIN")
 	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -append new_font.bin -dir /           (root dir)")
 	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -append new_font.bin                   (root dir)")
+	fmt.Println()
+	fmt.Println("  Append directory tree to ISO (creates the directory and all sub-entries):")
+	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -append cn_folder -dir DATA -name CN")
+	fmt.Println()
+	fmt.Println("  Delete file or directory from ISO (optionally zero freed sectors):")
+	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -delete \\MEDIA\\DEMO.XMV")
+	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -delete \\DATA\\FR -zero")
+	fmt.Println()
+	fmt.Println("  Apply a batch manifest (all operations validated first, undo journal kept while writing):")
+	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -patch manifest.json")
+	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -patch manifest.json -journal game.undo")
+	fmt.Println()
+	fmt.Println("  Roll back an interrupted patch run:")
+	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -rollback")
+	fmt.Println()
+	fmt.Println("  Show / patch XBE header (inside ISO or local file):")
+	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -xbe default.xbe")
+	fmt.Println("    XBOX_ISO_TOOL -iso game.iso -xbe default.xbe -title \"Van Helsing CN\" -region 0x7")
+	fmt.Println("    XBOX_ISO_TOOL -xbe default.xbe -media 0x400002FF -o patched.xbe")
+	fmt.Println("    XBOX_ISO_TOOL -xbe default.xbe -va 0x0012F3A0")
+	fmt.Println()
+	fmt.Println("  Rewrite ISO without dead sectors (optionally keep listed files at their LBA):")
+	fmt.Println("    XBOX_ISO_TOOL -compact game.iso -o compact.iso")
+	fmt.Println("    XBOX_ISO_TOOL -compact game.iso -o compact.iso -pin pinned.txt")
+	fmt.Println()
+	fmt.Println("  Compare two ISOs file by file (added/removed/resized/moved/content):")
+	fmt.Println("    XBOX_ISO_TOOL -diff good.iso broken.iso")
+	fmt.Println("    XBOX_ISO_TOOL -json -o diff.json -diff good.iso broken.iso")
 	os.Exit(1)
 }
 
-func doExtract(isoPath, outPath string) {
+func doExtract(isoPath, outPath, manifestPath string, workers int, fast bool) {
 	absISO, err := filepath.Abs(isoPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -142,15 +269,26 @@ func doExtract(isoPath, outPath string) {
 		os.Exit(1)
 	}
 	defer f.Close()
-	stat, _ := f.Stat()
-	if err := xiso.Extract(f, stat.Size(), outPath); err != nil {
+	if manifestPath == "" {
+		manifestPath = filepath.Clean(outPath) + ".manifest.csv"
+	}
+	stats, err := xiso.ExtractWith(f, outPath, xiso.ExtractOptions{
+		Workers:  workers,
+		Manifest: manifestPath,
+		Fast:     fast,
+		Progress: 2 * time.Second,
+	})
+	fmt.Printf("[+] %d extracted (%d MB), %d unchanged, %d corrupt, %d updated, %d failed\n",
+		stats.Extracted, stats.Bytes>>20, stats.Skipped, stats.Corrupt, stats.Updated, stats.Failed)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Extract error: %v\n", err)
 		os.Exit(1)
 	}
+	fmt.Printf("[+] Manifest: %s\n", manifestPath)
 	fmt.Println("Done.")
 }
 
-func doRepack(dirPath, outPath string) {
+func doRepack(dirPath, outPath, layoutPath string) {
 	absDir, err := filepath.Abs(dirPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -165,10 +303,33 @@ func doRepack(dirPath, outPath string) {
 		fmt.Fprintf(os.Stderr, "Error: source and destination are the same\n")
 		os.Exit(1)
 	}
-	if err := xiso.Repack(absDir, absOut); err != nil {
+	if layoutPath == "" {
+		if err := xiso.Repack(absDir, absOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Repack error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Done.")
+		return
+	}
+
+	layout, err := xiso.LoadLayout(layoutPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Layout error: %v\n", err)
+		os.Exit(1)
+	}
+	moves, err := xiso.RepackWithLayout(absDir, absOut, layout)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Repack error: %v\n", err)
 		os.Exit(1)
 	}
+	for _, m := range moves {
+		if m.Reason == "new" {
+			fmt.Printf("  [NEW]   %s -> LBA %d\n", m.Path, m.NewLBA)
+		} else {
+			fmt.Printf("  [MOVED] %s LBA %d -> %d (%s)\n", m.Path, m.OldLBA, m.NewLBA, m.Reason)
+		}
+	}
+	fmt.Printf("[+] %d files moved or added\n", len(moves))
 	fmt.Println("Done.")
 }
 
@@ -187,8 +348,20 @@ func doTbl(isoFile, csvOut string) {
 	fmt.Println("Done.")
 }
 
-func doInject(isoFile, internalPath, localFile string) {
-	if err := xiso.InjectFile(isoFile, internalPath, localFile); err != nil {
+func doTblImport(isoFile, csvPath string) {
+	if err := xiso.ImportTable(isoFile, csvPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Table import error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Done.")
+}
+
+func doInject(isoFile, internalPath, localFile string, grow bool) {
+	inject := xiso.InjectFile
+	if grow {
+		inject = xiso.InjectFileRelocate
+	}
+	if err := inject(isoFile, internalPath, localFile); err != nil {
 		fmt.Fprintf(os.Stderr, "Inject error: %v\n", err)
 		os.Exit(1)
 	}
@@ -207,13 +380,228 @@ func doAppend(isoFile, localFile, dir, name string) {
 	if name == "" {
 		name = filepath.Base(localFile)
 	}
-	if err := xiso.AppendFile(isoFile, localFile, dir, name); err != nil {
+	info, err := os.Stat(localFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	appendFn := xiso.AppendFile
+	if info.IsDir() {
+		appendFn = xiso.AppendDir
+	}
+	if err := appendFn(isoFile, localFile, dir, name); err != nil {
 		fmt.Fprintf(os.Stderr, "Append error: %v\n", err)
 		os.Exit(1)
 	}
 	fmt.Println("Done.")
 }
 
+func doDelete(isoFile, internalPath string, zero bool) {
+	if err := xiso.Remove(isoFile, internalPath, zero); err != nil {
+		fmt.Fprintf(os.Stderr, "Delete error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Done.")
+}
+
+func doPatch(isoFile, manifestPath, journalPath string) {
+	m, err := xiso.LoadManifest(manifestPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := xiso.ApplyPatch(isoFile, m, journalPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Patch error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Done.")
+}
+
+func doRollback(isoFile, journalPath string) {
+	if err := xiso.Rollback(isoFile, journalPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Rollback error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Done.")
+}
+
+func doXbe(isoFile, xbeFile, outPath, title, region, media, va string) {
+	if va != "" && (title != "" || region != "" || media != "") {
+		fmt.Fprintln(os.Stderr, "Error: -va only translates an address; run -title/-region/-media separately")
+		os.Exit(1)
+	}
+
+	var data []byte
+	var err error
+	if isoFile != "" {
+		f, ferr := os.Open(isoFile)
+		if ferr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", ferr)
+			os.Exit(1)
+		}
+		data, err = xiso.ReadFileData(f, xbeFile)
+		f.Close()
+	} else {
+		data, err = os.ReadFile(xbeFile)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	x, err := xbe.Parse(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "XBE error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if va != "" {
+		addr, err := strconv.ParseUint(va, 0, 32)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: bad address %q\n", va)
+			os.Exit(1)
+		}
+		off, err := x.VAToOffset(uint32(addr))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "XBE error: %v\n", err)
+			os.Exit(1)
+		}
+		name := "(headers)"
+		if s := x.SectionOf(off); s != nil {
+			name = s.Name
+		}
+		fmt.Printf("VA 0x%08X -> file offset 0x%X (%s)\n", addr, off, name)
+		return
+	}
+
+	modified := false
+	if title != "" {
+		if err := x.SetTitle(title); err != nil {
+			fmt.Fprintf(os.Stderr, "XBE error: %v\n", err)
+			os.Exit(1)
+		}
+		modified = true
+	}
+	for _, p := range []struct {
+		val string
+		set func(uint32) error
+	}{{region, x.SetRegion}, {media, x.SetMediaTypes}} {
+		if p.val == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(p.val, 0, 32)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: bad flag value %q\n", p.val)
+			os.Exit(1)
+		}
+		if err := p.set(uint32(v)); err != nil {
+			fmt.Fprintf(os.Stderr, "XBE error: %v\n", err)
+			os.Exit(1)
+		}
+		modified = true
+	}
+
+	fmt.Printf("XBE: %s\n", xbeFile)
+	fmt.Printf("  Title:    %s\n", x.Title())
+	fmt.Printf("  Title ID: 0x%08X\n", x.Cert.TitleID)
+	fmt.Printf("  Version:  0x%08X  Disk: %d\n", x.Cert.Version, x.Cert.DiskNumber)
+	fmt.Printf("  Media:    0x%08X\n", x.Cert.MediaTypes)
+	fmt.Printf("  Region:   0x%08X\n", x.Cert.Region)
+	fmt.Printf("  Base:     0x%08X  Headers: 0x%X  Image: 0x%X\n", x.Header.BaseAddr, x.Header.HeadersSize, x.Header.ImageSize)
+	fmt.Println("  Sections:")
+	fmt.Println("    Name       VirtAddr   VirtSize   RawAddr    RawSize")
+	for _, s := range x.Sections {
+		fmt.Printf("    %-10s 0x%08X 0x%08X 0x%08X 0x%08X\n", s.Name, s.VirtualAddr, s.VirtualSize, s.RawAddr, s.RawSize)
+	}
+
+	if !modified {
+		return
+	}
+	if isoFile != "" && outPath == "" {
+		err = xiso.ReplaceFileData(isoFile, xbeFile, x.Data, false)
+	} else {
+		if outPath == "" {
+			outPath = xbeFile
+		}
+		err = x.Save(outPath)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Write error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Done.")
+}
+
+func doCompact(isoFile, outPath, pinPath string) {
+	absIn, _ := filepath.Abs(isoFile)
+	absOut, _ := filepath.Abs(outPath)
+	if absIn == absOut {
+		fmt.Fprintf(os.Stderr, "Error: source and destination are the same\n")
+		os.Exit(1)
+	}
+
+	pinned := map[string]bool{}
+	if pinPath != "" {
+		var err error
+		if pinned, err = xiso.LoadPinList(pinPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	f, err := os.Open(isoFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	if err := xiso.Compact(f, outPath, pinned); err != nil {
+		fmt.Fprintf(os.Stderr, "Compact error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Done.")
+}
+
+func doDiff(isoA, isoB, outPath string, asJSON bool) {
+	fa, err := os.Open(isoA)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer fa.Close()
+	fb, err := os.Open(isoB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer fb.Close()
+
+	diff, err := xiso.DiffImages(fa, fb)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Diff error: %v\n", err)
+		os.Exit(1)
+	}
+
+	out := os.Stdout
+	if outPath != "" {
+		out, err = os.Create(outPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	if asJSON {
+		if err := xiso.WriteDiffJSON(out, diff); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		xiso.WriteDiffText(out, diff)
+	}
+}
+
 func doGet(isoFile, internalPath, outPath string) {
 	f, err := os.Open(isoFile)
 	if err != nil {
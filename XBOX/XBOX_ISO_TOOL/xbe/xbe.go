@@ -0,0 +1,280 @@
+package xbe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"unicode/utf16"
+)
+
+// magic: XBEH
+var Magic = [4]byte{'X', 'B', 'E', 'H'}
+
+const (
+	TitleLen          = 40
+	SectionHeaderSize = 0x38
+)
+
+// allowed media types (Certificate.MediaTypes)
+const (
+	MediaHardDisk      uint32 = 0x00000001
+	MediaDVDX2         uint32 = 0x00000002
+	MediaDVDCD         uint32 = 0x00000004
+	MediaCD            uint32 = 0x00000008
+	MediaDVD5RO        uint32 = 0x00000010
+	MediaDVD9RO        uint32 = 0x00000020
+	MediaDVD5RW        uint32 = 0x00000040
+	MediaDVD9RW        uint32 = 0x00000080
+	MediaDongle        uint32 = 0x00000100
+	MediaMediaBoard    uint32 = 0x00000200
+	MediaNonSecureHDD  uint32 = 0x40000000
+	MediaNonSecureMode uint32 = 0x80000000
+	MediaMask          uint32 = 0x00FFFFFF
+)
+
+// game regions (Certificate.Region)
+const (
+	RegionNorthAmerica uint32 = 0x00000001
+	RegionJapan        uint32 = 0x00000002
+	RegionRestOfWorld  uint32 = 0x00000004
+	RegionManufacturer uint32 = 0x80000000
+)
+
+// ImageHeader is the fixed part of the XBE header at file offset 0.
+// Addresses are virtual; the headers are loaded at BaseAddr.
+type ImageHeader struct {
+	Magic              [4]byte
+	Signature          [256]byte
+	BaseAddr           uint32
+	HeadersSize        uint32
+	ImageSize          uint32
+	ImageHeaderSize    uint32
+	TimeDate           uint32
+	CertAddr           uint32
+	NumSections        uint32
+	SectionsAddr       uint32
+	InitFlags          uint32
+	EntryPoint         uint32 // XOR encoded
+	TLSAddr            uint32
+	PEStackCommit      uint32
+	PEHeapReserve      uint32
+	PEHeapCommit       uint32
+	PEBaseAddr         uint32
+	PEImageSize        uint32
+	PEChecksum         uint32
+	PETimeDate         uint32
+	DebugPathAddr      uint32
+	DebugFileAddr      uint32
+	DebugUniFileAddr   uint32
+	KernelThunkAddr    uint32 // XOR encoded
+	NonKernelImportDir uint32
+	NumLibVersions     uint32
+	LibVersionsAddr    uint32
+	KernelLibAddr      uint32
+	XAPILibAddr        uint32
+	LogoAddr           uint32
+	LogoSize           uint32
+}
+
+type Certificate struct {
+	Size          uint32
+	TimeDate      uint32
+	TitleID       uint32
+	TitleName     [TitleLen]uint16
+	AltTitleIDs   [16]uint32
+	MediaTypes    uint32
+	Region        uint32
+	Ratings       uint32
+	DiskNumber    uint32
+	Version       uint32
+	LANKey        [16]byte
+	SignatureKey  [16]byte
+	AltSignatures [16][16]byte
+}
+
+type SectionHeader struct {
+	Flags         uint32
+	VirtualAddr   uint32
+	VirtualSize   uint32
+	RawAddr       uint32
+	RawSize       uint32
+	NameAddr      uint32
+	RefCount      uint32
+	HeadSharedRef uint32
+	TailSharedRef uint32
+	Digest        [20]byte
+}
+
+type Section struct {
+	SectionHeader
+	Name string
+}
+
+// File is a parsed XBE. Setters update both the parsed fields and Data.
+type File struct {
+	Data     []byte
+	Header   ImageHeader
+	Cert     Certificate
+	Sections []Section
+}
+
+func Open(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) (*File, error) {
+	f := &File{Data: data}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &f.Header); err != nil {
+		return nil, fmt.Errorf("read image header: %w", err)
+	}
+	if f.Header.Magic != Magic {
+		return nil, fmt.Errorf("invalid XBE magic")
+	}
+
+	certOff, err := f.headerOffset(f.Header.CertAddr, uint32(binary.Size(f.Cert)))
+	if err != nil {
+		return nil, fmt.Errorf("certificate: %w", err)
+	}
+	if err := binary.Read(bytes.NewReader(data[certOff:]), binary.LittleEndian, &f.Cert); err != nil {
+		return nil, fmt.Errorf("read certificate: %w", err)
+	}
+
+	secOff, err := f.headerOffset(f.Header.SectionsAddr, f.Header.NumSections*SectionHeaderSize)
+	if err != nil {
+		return nil, fmt.Errorf("section table: %w", err)
+	}
+	r := bytes.NewReader(data[secOff:])
+	for i := uint32(0); i < f.Header.NumSections; i++ {
+		var s Section
+		if err := binary.Read(r, binary.LittleEndian, &s.SectionHeader); err != nil {
+			return nil, fmt.Errorf("read section %d: %w", i, err)
+		}
+		s.Name = f.cString(s.NameAddr)
+		f.Sections = append(f.Sections, s)
+	}
+	return f, nil
+}
+
+// headerOffset maps a virtual address inside the loaded headers to a file
+// offset and checks that size bytes are available there.
+func (f *File) headerOffset(va, size uint32) (uint32, error) {
+	if va < f.Header.BaseAddr {
+		return 0, fmt.Errorf("address 0x%08X below base 0x%08X", va, f.Header.BaseAddr)
+	}
+	off := va - f.Header.BaseAddr
+	if uint64(off)+uint64(size) > uint64(len(f.Data)) {
+		return 0, fmt.Errorf("address 0x%08X outside file", va)
+	}
+	return off, nil
+}
+
+func (f *File) cString(va uint32) string {
+	off, err := f.VAToOffset(va)
+	if err != nil {
+		return ""
+	}
+	end := off
+	for end < uint32(len(f.Data)) && f.Data[end] != 0 {
+		end++
+	}
+	return string(f.Data[off:end])
+}
+
+// VAToOffset maps a virtual address to its file offset, either inside the
+// headers or inside the raw data of a section.
+func (f *File) VAToOffset(va uint32) (uint32, error) {
+	if va >= f.Header.BaseAddr && va < f.Header.BaseAddr+f.Header.HeadersSize {
+		return va - f.Header.BaseAddr, nil
+	}
+	for _, s := range f.Sections {
+		if va >= s.VirtualAddr && va < s.VirtualAddr+s.RawSize {
+			return s.RawAddr + (va - s.VirtualAddr), nil
+		}
+	}
+	return 0, fmt.Errorf("address 0x%08X not backed by file data", va)
+}
+
+// OffsetToVA is the inverse of VAToOffset.
+func (f *File) OffsetToVA(off uint32) (uint32, error) {
+	for _, s := range f.Sections {
+		if off >= s.RawAddr && off < s.RawAddr+s.RawSize {
+			return s.VirtualAddr + (off - s.RawAddr), nil
+		}
+	}
+	if off < f.Header.HeadersSize {
+		return f.Header.BaseAddr + off, nil
+	}
+	return 0, fmt.Errorf("offset 0x%X not inside headers or a section", off)
+}
+
+// Section returns the section with the given name, e.g. ".rdata".
+func (f *File) Section(name string) *Section {
+	for i := range f.Sections {
+		if f.Sections[i].Name == name {
+			return &f.Sections[i]
+		}
+	}
+	return nil
+}
+
+// SectionOf returns the section whose raw data contains a file offset.
+func (f *File) SectionOf(off uint32) *Section {
+	for i := range f.Sections {
+		s := &f.Sections[i]
+		if off >= s.RawAddr && off < s.RawAddr+s.RawSize {
+			return s
+		}
+	}
+	return nil
+}
+
+func (f *File) Title() string {
+	n := 0
+	for n < TitleLen && f.Cert.TitleName[n] != 0 {
+		n++
+	}
+	return string(utf16.Decode(f.Cert.TitleName[:n]))
+}
+
+// SetTitle rewrites the certificate title (at most 40 UTF-16 units).
+func (f *File) SetTitle(title string) error {
+	u := utf16.Encode([]rune(title))
+	if len(u) > TitleLen {
+		return fmt.Errorf("title too long: %d > %d UTF-16 units", len(u), TitleLen)
+	}
+	f.Cert.TitleName = [TitleLen]uint16{}
+	copy(f.Cert.TitleName[:], u)
+	return f.writeCert()
+}
+
+func (f *File) SetMediaTypes(media uint32) error {
+	f.Cert.MediaTypes = media
+	return f.writeCert()
+}
+
+func (f *File) SetRegion(region uint32) error {
+	f.Cert.Region = region
+	return f.writeCert()
+}
+
+// writeCert stores the certificate fields back into Data. Newer XBEs have a
+// longer certificate; the extra bytes after the known fields are untouched.
+func (f *File) writeCert() error {
+	off, err := f.headerOffset(f.Header.CertAddr, uint32(binary.Size(f.Cert)))
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &f.Cert)
+	copy(f.Data[off:], buf.Bytes())
+	return nil
+}
+
+func (f *File) Save(path string) error {
+	return os.WriteFile(path, f.Data, 0644)
+}
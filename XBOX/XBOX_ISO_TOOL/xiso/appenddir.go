@@ -0,0 +1,138 @@
+package xiso
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// AppendDir copies a local directory tree into an existing ISO directory as a
+// new subdirectory. Tables and file data of the new tree are written past the
+// end of the image, then the parent table is rebuilt with the new entry.
+func AppendDir(isoPath, localDir, internalDir, dirName string) error {
+	return withImage(isoPath, func(img Image) error {
+		return appendDir(img, localDir, internalDir, dirName)
+	})
+}
+
+func appendDir(f Image, localDir, internalDir, dirName string) error {
+	dirName = strings.ToUpper(dirName)
+	if len(dirName) > MaxNameLen {
+		return fmt.Errorf("name too long: %d > %d", len(dirName), MaxNameLen)
+	}
+
+	dirs, err := scanDir(localDir)
+	if err != nil {
+		return fmt.Errorf("scan local directory: %w", err)
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("empty source directory")
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dirs[i].TreeSize = computeTreeSize(dirs[i].Entries, dirs)
+	}
+
+	isoSize, err := f.Size()
+	if err != nil {
+		return err
+	}
+
+	vol, err := ParseVolume(readSector(f, VolSector))
+	if err != nil {
+		return fmt.Errorf("parse volume: %w", err)
+	}
+
+	internalDir = cleanDirPath(internalDir)
+	parentTable, err := resolveDir(f, vol.Root, internalDir)
+	if err != nil {
+		return err
+	}
+
+	entries, err := readParentEntries(f, parentTable)
+	if err != nil {
+		return fmt.Errorf("read directory: %w", err)
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Name, dirName) {
+			return fmt.Errorf("entry already exists: %s", dirName)
+		}
+	}
+
+	used, err := usedExtents(f, vol.Root)
+	if err != nil {
+		return err
+	}
+	alloc := Allocator{Next: endSector(used, isoSize)}
+
+	dirSectors := make([]uint32, len(dirs))
+	for i, d := range dirs {
+		dirSectors[i] = alloc.Alloc(uint64(d.TreeSize))
+	}
+
+	entries = append(entries, dirModEntry{
+		Name:   dirName,
+		Size:   SectorsNeeded(uint64(dirs[0].TreeSize)) * Sector,
+		Attr:   AttrDirectory,
+		Sector: dirSectors[0],
+	})
+	parentBuf, err := buildDirTable(parentTable, entries)
+	if err != nil {
+		return err
+	}
+
+	fileSectors := make([][]fileAlloc, len(dirs))
+	files := 0
+	for i, d := range dirs {
+		fileSectors[i] = make([]fileAlloc, len(d.Entries))
+		for j, e := range d.Entries {
+			if e.IsDir {
+				continue
+			}
+			fileSectors[i][j].size = e.Size
+			if e.Size > 0 {
+				fileSectors[i][j].sector = alloc.Alloc(uint64(e.Size))
+			}
+			files++
+		}
+	}
+
+	for i, d := range dirs {
+		tableBytes, err := serializeDirTable(d, dirs, dirSectors, fileSectors[i])
+		if err != nil {
+			return fmt.Errorf("serialize dir %q: %w", d.Path, err)
+		}
+		if _, err := f.WriteAt(tableBytes, int64(dirSectors[i])*int64(Sector)); err != nil {
+			return fmt.Errorf("write dir table: %w", err)
+		}
+	}
+
+	for i, d := range dirs {
+		for j, e := range d.Entries {
+			if e.IsDir || e.Size == 0 {
+				continue
+			}
+			off := int64(fileSectors[i][j].sector) * int64(Sector)
+			if err := copyFileAt(f, filepath.Join(d.Path, e.Name), off, e.Size); err != nil {
+				return fmt.Errorf("write file %q: %w", e.Name, err)
+			}
+		}
+	}
+
+	end := int64(alloc.Next) * int64(Sector)
+	if end > isoSize {
+		if err := f.Truncate(end); err != nil {
+			return fmt.Errorf("extend image: %w", err)
+		}
+	}
+
+	if _, err := f.WriteAt(parentBuf, int64(parentTable.Region.Sector)*int64(Sector)); err != nil {
+		return fmt.Errorf("write dir table: %w", err)
+	}
+	if err := setTableSize(f, vol.Root, internalDir, uint32(len(parentBuf))); err != nil {
+		return err
+	}
+
+	logf("[+] Appended %s -> %s\\%s (%d dirs, %d files, LBA=%d)\n",
+		localDir, internalDir, dirName, len(dirs), files, dirSectors[0])
+	return nil
+}
@@ -0,0 +1,196 @@
+package xiso
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type compactDir struct {
+	table   DirTable
+	path    string
+	entries []dirModEntry
+	old     []uint32     // source LBA of each entry
+	child   map[int]int  // entry index -> index into dirs
+	pinned  map[int]bool // entries that keep their LBA
+	sector  uint32
+	size    uint32
+}
+
+// Compact rewrites an image into outPath without dead sectors. Directory
+// structure and entry attributes are copied unchanged; files in pinned keep
+// their current LBA, everything else is packed from the start of the disc.
+// Full disc dumps are written out as a plain XISO.
+func Compact(r ReaderAt, outPath string, pinned map[string]bool) error {
+	r, vol, err := OpenVolume(r)
+	if err != nil {
+		return fmt.Errorf("parse volume: %w", err)
+	}
+
+	dirs := []compactDir{{table: vol.Root}}
+	for i := 0; i < len(dirs); i++ {
+		entries, err := readParentEntries(r, dirs[i].table)
+		if err != nil {
+			return fmt.Errorf("read directory %s: %w", dirs[i].path, err)
+		}
+		dirs[i].entries = entries
+		dirs[i].child = make(map[int]int)
+		dirs[i].pinned = make(map[int]bool)
+		for _, e := range entries {
+			dirs[i].old = append(dirs[i].old, e.Sector)
+		}
+		for j, e := range entries {
+			if e.Attr&AttrDirectory == 0 {
+				continue
+			}
+			dirs[i].child[j] = len(dirs)
+			dirs = append(dirs, compactDir{
+				table: DirTable{Region: Region{Sector: e.Sector, Size: e.Size}},
+				path:  dirs[i].path + "\\" + e.Name,
+			})
+		}
+	}
+
+	ga := newGapAllocator()
+	found := make(map[string]bool)
+	var placed []pinnedExtent
+	for i := range dirs {
+		for j, e := range dirs[i].entries {
+			key := layoutKey(dirs[i].path + "\\" + e.Name)
+			if e.Attr&AttrDirectory != 0 || !pinned[key] {
+				continue
+			}
+			found[key] = true
+			if e.Size == 0 {
+				continue
+			}
+			ext := extent{Start: e.Sector, Count: SectorsNeeded(uint64(e.Size))}
+			if !ga.reserve(ext) {
+				return fmt.Errorf("pinned file %s (sectors %d-%d) overlaps %s", key, ext.Start, ext.End()-1, pinCollision(ext, placed))
+			}
+			placed = append(placed, pinnedExtent{key, ext})
+			dirs[i].pinned[j] = true
+		}
+	}
+	for key := range pinned {
+		if !found[key] {
+			return fmt.Errorf("pinned file not found: %s", key)
+		}
+	}
+
+	for i := range dirs {
+		_, tableSize := rebuildDirTable(dirs[i].entries)
+		dirs[i].size = SectorsNeeded(uint64(tableSize)) * Sector
+		dirs[i].sector = ga.Alloc(uint64(dirs[i].size))
+	}
+	for i := range dirs {
+		for j, e := range dirs[i].entries {
+			if c, ok := dirs[i].child[j]; ok {
+				dirs[i].entries[j].Sector = dirs[c].sector
+				dirs[i].entries[j].Size = dirs[c].size
+				continue
+			}
+			if e.Size == 0 || dirs[i].pinned[j] {
+				continue
+			}
+			dirs[i].entries[j].Sector = ga.Alloc(uint64(e.Size))
+		}
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// reserved area in front of the volume descriptor
+	head := make([]byte, VolSector*Sector)
+	if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+		return fmt.Errorf("read header: %w", err)
+	}
+	if _, err := out.WriteAt(head, 0); err != nil {
+		return err
+	}
+
+	newVol := *vol
+	newVol.Root = DirTable{Region: Region{Sector: dirs[0].sector, Size: dirs[0].size}}
+	if _, err := out.WriteAt(newVol.Bytes(), int64(VolSector)*int64(Sector)); err != nil {
+		return err
+	}
+
+	var files int
+	for _, d := range dirs {
+		buf, _ := rebuildDirTable(d.entries)
+		if _, err := out.WriteAt(buf, int64(d.sector)*int64(Sector)); err != nil {
+			return fmt.Errorf("write dir table %s: %w", d.path, err)
+		}
+		for j, e := range d.entries {
+			if _, ok := d.child[j]; ok || e.Size == 0 {
+				continue
+			}
+			src := io.NewSectionReader(r, int64(d.old[j])*int64(Sector), int64(e.Size))
+			dst := io.NewOffsetWriter(out, int64(e.Sector)*int64(Sector))
+			if _, err := io.Copy(dst, src); err != nil {
+				return fmt.Errorf("copy %s\\%s: %w", d.path, e.Name, err)
+			}
+			files++
+		}
+	}
+
+	end := int64(ga.used[len(ga.used)-1].End()) * int64(Sector)
+	aligned := ((end + int64(32*Sector) - 1) / int64(32*Sector)) * int64(32*Sector)
+	if err := out.Truncate(aligned); err != nil {
+		return err
+	}
+
+	fmt.Printf("[+] Compacted %d dirs, %d files (%d pinned) -> %s (%d sectors)\n",
+		len(dirs), files, len(found), outPath, aligned/int64(Sector))
+	return nil
+}
+
+// LoadPinList reads ISO paths to keep in place, one per line. A CSV written by
+// -tbl works too: only the first column is used and the header is skipped.
+func LoadPinList(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	isCSV := strings.EqualFold(filepath.Ext(path), ".csv")
+	pinned := make(map[string]bool)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if isCSV {
+			line, _, _ = strings.Cut(line, ",")
+		}
+		if line == "" || strings.HasPrefix(line, "#") || (isCSV && strings.EqualFold(line, "Path")) {
+			continue
+		}
+		pinned[layoutKey(line)] = true
+	}
+	return pinned, sc.Err()
+}
+
+type pinnedExtent struct {
+	key string
+	ext extent
+}
+
+// pinCollision names what a pinned file that could not be reserved runs
+// into: the reserved header sectors or an earlier pinned file.
+func pinCollision(e extent, placed []pinnedExtent) string {
+	if e.Start <= VolSector {
+		return fmt.Sprintf("the reserved header sectors 0-%d", VolSector)
+	}
+	for _, p := range placed {
+		if e.Start < p.ext.End() && p.ext.Start < e.End() {
+			return "pinned file " + p.key
+		}
+	}
+	return "sectors already in use"
+}
@@ -0,0 +1,156 @@
+package xiso
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RemoveFile deletes a file entry from its parent directory table. When zero
+// is set the sectors that are no longer referenced are overwritten with zeros.
+func RemoveFile(isoPath, internalPath string, zero bool) error {
+	return withImage(isoPath, func(img Image) error {
+		return removeEntry(img, internalPath, removeFile, zero)
+	})
+}
+
+// RemoveDir deletes a directory and everything below it.
+func RemoveDir(isoPath, internalPath string, zero bool) error {
+	return withImage(isoPath, func(img Image) error {
+		return removeEntry(img, internalPath, removeDir, zero)
+	})
+}
+
+// Remove deletes a file or a whole directory tree, whichever the path names.
+func Remove(isoPath, internalPath string, zero bool) error {
+	return withImage(isoPath, func(img Image) error {
+		return removeEntry(img, internalPath, removeAny, zero)
+	})
+}
+
+const (
+	removeAny = iota
+	removeFile
+	removeDir
+)
+
+func removeEntry(f Image, internalPath string, kind int, zero bool) error {
+	internalPath = strings.ReplaceAll(internalPath, "/", "\\")
+	internalPath = strings.Trim(internalPath, "\\")
+	if internalPath == "" {
+		return fmt.Errorf("cannot remove root directory")
+	}
+
+	vol, err := ParseVolume(readSector(f, VolSector))
+	if err != nil {
+		return fmt.Errorf("parse volume: %w", err)
+	}
+
+	parent, target, err := findParentDir(f, vol.Root, internalPath)
+	if err != nil {
+		return err
+	}
+	if kind == removeFile && target.IsDir() {
+		return fmt.Errorf("is a directory: %s", internalPath)
+	}
+	if kind == removeDir && !target.IsDir() {
+		return fmt.Errorf("not a directory: %s", internalPath)
+	}
+
+	freed := []extent{}
+	if target.Size() > 0 {
+		freed = append(freed, extent{Start: target.Node.Data.Sector, Count: SectorsNeeded(uint64(target.Size()))})
+	}
+	files := 1
+	if target.IsDir() {
+		sub, err := FileTree(f, DirTable{Region: target.Node.Data})
+		if err != nil {
+			return fmt.Errorf("walk directory: %w", err)
+		}
+		for _, fe := range sub {
+			if fe.Entry.Size() > 0 {
+				freed = append(freed, extent{Start: fe.Entry.Node.Data.Sector, Count: SectorsNeeded(uint64(fe.Entry.Size()))})
+			}
+		}
+		files += len(sub)
+	}
+
+	entries, err := readParentEntries(f, parent)
+	if err != nil {
+		return fmt.Errorf("read parent entries: %w", err)
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if !strings.EqualFold(e.Name, target.Name) {
+			kept = append(kept, e)
+		}
+	}
+
+	if err := writeDirTable(f, parent, kept); err != nil {
+		return err
+	}
+
+	var zeroed uint32
+	if zero {
+		used, err := usedExtents(f, vol.Root)
+		if err != nil {
+			return err
+		}
+		for _, e := range subtractExtents(mergeExtents(freed), used) {
+			if err := zeroSectors(f, e); err != nil {
+				return err
+			}
+			zeroed += e.Count
+		}
+	}
+
+	if zero {
+		logf("[+] Removed %s (%d entries, %d sectors zeroed)\n", internalPath, files, zeroed)
+	} else {
+		logf("[+] Removed %s (%d entries)\n", internalPath, files)
+	}
+	return nil
+}
+
+// subtractExtents returns the parts of from that do not overlap used.
+// Both slices must be sorted and merged.
+func subtractExtents(from, used []extent) []extent {
+	var result []extent
+	for _, e := range from {
+		start, end := e.Start, e.End()
+		for _, u := range used {
+			if u.End() <= start || u.Start >= end {
+				continue
+			}
+			if u.Start > start {
+				result = append(result, extent{Start: start, Count: u.Start - start})
+			}
+			start = u.End()
+			if start >= end {
+				break
+			}
+		}
+		if start < end {
+			result = append(result, extent{Start: start, Count: end - start})
+		}
+	}
+	return result
+}
+
+func zeroSectors(f io.WriterAt, e extent) error {
+	buf := make([]byte, 128*Sector)
+	off := int64(e.Start) * int64(Sector)
+	remain := int64(e.Count) * int64(Sector)
+	for remain > 0 {
+		n := int64(len(buf))
+		if n > remain {
+			n = remain
+		}
+		if _, err := f.WriteAt(buf[:n], off); err != nil {
+			return fmt.Errorf("zero sectors at LBA %d: %w", e.Start, err)
+		}
+		off += n
+		remain -= n
+	}
+	return nil
+}
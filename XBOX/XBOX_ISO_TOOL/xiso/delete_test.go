@@ -0,0 +1,69 @@
+package xiso
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func buildTestISO(t *testing.T) string {
+	t.Helper()
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "DEFAULT.XBE"), []byte("xbe"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(src, "MEDIA"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "MEDIA", "TITLE.BIN"), []byte("title"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	iso := filepath.Join(t.TempDir(), "test.iso")
+	if err := Repack(src, iso); err != nil {
+		t.Fatal(err)
+	}
+	return iso
+}
+
+func TestRemoveMissingParent(t *testing.T) {
+	iso := buildTestISO(t)
+	before, err := os.ReadFile(iso)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{`NOPE\DEFAULT.XBE`, `NOPE\MEDIA\TITLE.BIN`, `MEDIA\NOPE\TITLE.BIN`, `DEFAULT.XBE\TITLE.BIN`} {
+		if err := Remove(iso, p, true); err == nil {
+			t.Errorf("Remove(%q) succeeded, want path not found", p)
+		}
+	}
+
+	after, err := os.ReadFile(iso)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Fatal("image changed by a failed remove")
+	}
+	if _, err := ReadFileData(bytes.NewReader(after), "DEFAULT.XBE"); err != nil {
+		t.Fatalf("DEFAULT.XBE: %v", err)
+	}
+}
+
+func TestRemoveExisting(t *testing.T) {
+	iso := buildTestISO(t)
+	if err := Remove(iso, `MEDIA\TITLE.BIN`, true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(iso)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFileData(bytes.NewReader(data), `MEDIA\TITLE.BIN`); err == nil {
+		t.Fatal("MEDIA\\TITLE.BIN still present")
+	}
+	if _, err := ReadFileData(bytes.NewReader(data), "DEFAULT.XBE"); err != nil {
+		t.Fatalf("DEFAULT.XBE: %v", err)
+	}
+}
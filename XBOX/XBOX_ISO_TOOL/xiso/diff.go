@@ -0,0 +1,204 @@
+package xiso
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DiffEntry is one path that differs between two images. Changes holds any
+// of "added", "removed", "resized", "moved" and "content", or "type" alone
+// for a path that is a file in one image and a directory in the other (Dir
+// is then true when it is a directory in B).
+type DiffEntry struct {
+	Path    string   `json:"path"`
+	Dir     bool     `json:"dir,omitempty"`
+	Changes []string `json:"changes"`
+	OldLBA  uint32   `json:"old_lba,omitempty"`
+	NewLBA  uint32   `json:"new_lba,omitempty"`
+	OldSize uint32   `json:"old_size,omitempty"`
+	NewSize uint32   `json:"new_size,omitempty"`
+	OldSHA1 string   `json:"old_sha1,omitempty"`
+	NewSHA1 string   `json:"new_sha1,omitempty"`
+}
+
+// DiffImages compares the file trees of two images. Files of equal size are
+// compared by SHA-1, so in-place injects are found even when LBA and size
+// did not change.
+func DiffImages(a, b ReaderAt) ([]DiffEntry, error) {
+	ta, ra, err := diffTree(a)
+	if err != nil {
+		return nil, fmt.Errorf("image A: %w", err)
+	}
+	tb, rb, err := diffTree(b)
+	if err != nil {
+		return nil, fmt.Errorf("image B: %w", err)
+	}
+
+	var result []DiffEntry
+	for key, fa := range ta {
+		fb, ok := tb[key]
+		if !ok {
+			result = append(result, DiffEntry{
+				Path:    fa.Path(),
+				Dir:     fa.Entry.IsDir(),
+				Changes: []string{"removed"},
+				OldLBA:  fa.Entry.Node.Data.Sector,
+				OldSize: fileSize(fa.Entry),
+			})
+			continue
+		}
+		if fa.Entry.IsDir() != fb.Entry.IsDir() {
+			result = append(result, DiffEntry{
+				Path:    fa.Path(),
+				Dir:     fb.Entry.IsDir(),
+				Changes: []string{"type"},
+				OldLBA:  fa.Entry.Node.Data.Sector,
+				NewLBA:  fb.Entry.Node.Data.Sector,
+				OldSize: fileSize(fa.Entry),
+				NewSize: fileSize(fb.Entry),
+			})
+			continue
+		}
+		if fa.Entry.IsDir() {
+			continue
+		}
+
+		d := DiffEntry{
+			Path:    fa.Path(),
+			OldLBA:  fa.Entry.Node.Data.Sector,
+			NewLBA:  fb.Entry.Node.Data.Sector,
+			OldSize: fa.Entry.Size(),
+			NewSize: fb.Entry.Size(),
+		}
+		if d.OldSize != d.NewSize {
+			d.Changes = append(d.Changes, "resized")
+		}
+		if d.OldLBA != d.NewLBA && d.OldSize > 0 && d.NewSize > 0 {
+			d.Changes = append(d.Changes, "moved")
+		}
+		if d.OldSize == d.NewSize && d.OldSize > 0 {
+			if d.OldSHA1, err = hashEntry(ra, fa.Entry); err != nil {
+				return nil, err
+			}
+			if d.NewSHA1, err = hashEntry(rb, fb.Entry); err != nil {
+				return nil, err
+			}
+			if d.OldSHA1 != d.NewSHA1 {
+				d.Changes = append(d.Changes, "content")
+			} else {
+				d.OldSHA1, d.NewSHA1 = "", ""
+			}
+		}
+		if len(d.Changes) > 0 {
+			result = append(result, d)
+		}
+	}
+	for key, fb := range tb {
+		if _, ok := ta[key]; ok {
+			continue
+		}
+		result = append(result, DiffEntry{
+			Path:    fb.Path(),
+			Dir:     fb.Entry.IsDir(),
+			Changes: []string{"added"},
+			NewLBA:  fb.Entry.Node.Data.Sector,
+			NewSize: fileSize(fb.Entry),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return strings.ToUpper(result[i].Path) < strings.ToUpper(result[j].Path)
+	})
+	return result, nil
+}
+
+func diffTree(r ReaderAt) (map[string]FileEntry, ReaderAt, error) {
+	r, vol, err := OpenVolume(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse volume: %w", err)
+	}
+	tree, err := FileTree(r, vol.Root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("walk file tree: %w", err)
+	}
+	m := make(map[string]FileEntry, len(tree))
+	for _, fe := range tree {
+		m[layoutKey(fe.Path())] = fe
+	}
+	return m, r, nil
+}
+
+func fileSize(ent *Entry) uint32 {
+	if ent.IsDir() {
+		return 0
+	}
+	return ent.Size()
+}
+
+func hashEntry(r ReaderAt, ent *Entry) (string, error) {
+	h := sha1.New()
+	sr := io.NewSectionReader(r, int64(ent.Node.Data.Sector)*int64(Sector), int64(ent.Size()))
+	if _, err := io.Copy(h, sr); err != nil {
+		return "", fmt.Errorf("hash %s: %w", ent.Name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WriteDiffText prints a diff as one line per changed path plus a summary.
+func WriteDiffText(w io.Writer, diff []DiffEntry) {
+	counts := make(map[string]int)
+	for _, d := range diff {
+		for _, c := range d.Changes {
+			counts[c]++
+		}
+		switch d.Changes[0] {
+		case "added":
+			if d.Dir {
+				fmt.Fprintf(w, "  [ADDED]   %s\\\n", d.Path)
+			} else {
+				fmt.Fprintf(w, "  [ADDED]   %s (LBA %d, %d bytes)\n", d.Path, d.NewLBA, d.NewSize)
+			}
+		case "removed":
+			if d.Dir {
+				fmt.Fprintf(w, "  [REMOVED] %s\\\n", d.Path)
+			} else {
+				fmt.Fprintf(w, "  [REMOVED] %s (LBA %d, %d bytes)\n", d.Path, d.OldLBA, d.OldSize)
+			}
+		case "type":
+			if d.Dir {
+				fmt.Fprintf(w, "  [TYPE]    %s: file (LBA %d, %d bytes) -> directory\n", d.Path, d.OldLBA, d.OldSize)
+			} else {
+				fmt.Fprintf(w, "  [TYPE]    %s: directory -> file (LBA %d, %d bytes)\n", d.Path, d.NewLBA, d.NewSize)
+			}
+		default:
+			var parts []string
+			for _, c := range d.Changes {
+				switch c {
+				case "resized":
+					parts = append(parts, fmt.Sprintf("size %d -> %d", d.OldSize, d.NewSize))
+				case "moved":
+					parts = append(parts, fmt.Sprintf("LBA %d -> %d", d.OldLBA, d.NewLBA))
+				case "content":
+					parts = append(parts, "content "+d.OldSHA1[:8]+" -> "+d.NewSHA1[:8])
+				}
+			}
+			fmt.Fprintf(w, "  [CHANGED] %s: %s\n", d.Path, strings.Join(parts, ", "))
+		}
+	}
+	fmt.Fprintf(w, "[+] %d added, %d removed, %d resized, %d moved, %d content changed, %d type changed\n",
+		counts["added"], counts["removed"], counts["resized"], counts["moved"], counts["content"], counts["type"])
+}
+
+func WriteDiffJSON(w io.Writer, diff []DiffEntry) error {
+	if diff == nil {
+		diff = []DiffEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diff)
+}
@@ -0,0 +1,331 @@
+package xiso
+
+import (
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ExtractOptions controls ExtractWith.
+type ExtractOptions struct {
+	Workers  int           // parallel file copies, at least 1
+	Manifest string        // CSV with Path,LBA,Size,CRC32,SHA1; empty disables it
+	Fast     bool          // trust an unchanged LBA and size instead of hashing the image data
+	Progress time.Duration // interval of progress lines, 0 disables them
+}
+
+// ExtractStats counts what ExtractWith did with each file.
+type ExtractStats struct {
+	Extracted int
+	Skipped   int
+	Corrupt   int
+	Updated   int
+	Failed    int
+	Bytes     int64
+}
+
+// ManifestEntry is one row of an extraction manifest.
+type ManifestEntry struct {
+	Path  string
+	LBA   uint32
+	Size  uint32
+	CRC32 uint32
+	SHA1  string
+}
+
+type extractJob struct {
+	fe   FileEntry
+	dest string
+	prev *ManifestEntry
+}
+
+// ExtractWith extracts all files with opts.Workers goroutines. When a manifest
+// from an earlier run exists, files whose image data and local copy both still
+// hash to the recorded value are skipped; local copies that no longer match are
+// reported as corrupt and extracted again. An in-place inject keeps LBA and
+// size, so the image data is hashed unless opts.Fast is set. The first three
+// manifest columns are the same as -tbl, so it can be used with -tblimport.
+func ExtractWith(r ReaderAt, outDir string, opts ExtractOptions) (ExtractStats, error) {
+	var stats ExtractStats
+	r, vol, err := OpenVolume(r)
+	if err != nil {
+		return stats, fmt.Errorf("parse volume: %w", err)
+	}
+
+	tree, err := FileTree(r, vol.Root)
+	if err != nil {
+		return stats, fmt.Errorf("walk file tree: %w", err)
+	}
+
+	prev := make(map[string]*ManifestEntry)
+	if opts.Manifest != "" {
+		old, err := LoadManifestCSV(opts.Manifest)
+		if err != nil && !os.IsNotExist(err) {
+			return stats, err
+		}
+		for i := range old {
+			prev[layoutKey(old[i].Path)] = &old[i]
+		}
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return stats, err
+	}
+
+	var jobs []extractJob
+	var total int64
+	for _, fe := range tree {
+		dir := filepath.Join(outDir, filepath.FromSlash(fe.Dir))
+		full := filepath.Join(dir, fe.Entry.Name)
+		if fe.Entry.IsDir() {
+			fmt.Printf("  [DIR]  %s\n", filepath.Join(fe.Dir, fe.Entry.Name))
+			if err := os.MkdirAll(full, 0755); err != nil {
+				return stats, err
+			}
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return stats, err
+		}
+		jobs = append(jobs, extractJob{fe: fe, dest: full, prev: prev[layoutKey(fe.Path())]})
+		total += int64(fe.Entry.Size())
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu     sync.Mutex
+		done   atomic.Int64
+		nfiles atomic.Int64
+		wg     sync.WaitGroup
+	)
+	results := make([]*ManifestEntry, len(jobs))
+	queue := make(chan int)
+
+	stop := make(chan struct{})
+	if opts.Progress > 0 {
+		go func() {
+			t := time.NewTicker(opts.Progress)
+			defer t.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-t.C:
+					mu.Lock()
+					fmt.Printf("[*] %d/%d files, %d/%d MB\n", nfiles.Load(), len(jobs), done.Load()>>20, total>>20)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				job := jobs[i]
+				me, status, err := extractOne(r, job, opts.Fast)
+				done.Add(int64(job.fe.Entry.Size()))
+				nfiles.Add(1)
+
+				mu.Lock()
+				switch {
+				case err != nil:
+					fmt.Printf("  [ERROR]   %s: %v\n", job.fe.Path(), err)
+					stats.Failed++
+				case status == "skip":
+					stats.Skipped++
+				default:
+					switch status {
+					case "corrupt":
+						fmt.Printf("  [CORRUPT] %s (local copy did not match manifest, re-extracted)\n", job.fe.Path())
+						stats.Corrupt++
+					case "updated":
+						fmt.Printf("  [UPDATED] %s\n", job.fe.Path())
+						stats.Updated++
+					default:
+						fmt.Printf("  [FILE] %s\n", job.fe.Path())
+					}
+					stats.Extracted++
+					stats.Bytes += int64(me.Size)
+				}
+				mu.Unlock()
+				results[i] = me
+			}
+		}()
+	}
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	close(stop)
+
+	if opts.Manifest != "" {
+		var entries []ManifestEntry
+		for _, me := range results {
+			if me != nil {
+				entries = append(entries, *me)
+			}
+		}
+		if err := WriteManifestCSV(opts.Manifest, entries); err != nil {
+			return stats, fmt.Errorf("write manifest: %w", err)
+		}
+	}
+
+	if stats.Failed > 0 {
+		return stats, fmt.Errorf("%d files failed", stats.Failed)
+	}
+	return stats, nil
+}
+
+// extractOne extracts or skips a single file. status is "skip", "new",
+// "updated" or "corrupt".
+func extractOne(r ReaderAt, job extractJob, fast bool) (*ManifestEntry, string, error) {
+	ent := job.fe.Entry
+	me := &ManifestEntry{Path: job.fe.Path(), LBA: ent.Node.Data.Sector, Size: ent.Size()}
+	src := io.NewSectionReader(r, int64(me.LBA)*int64(Sector), int64(me.Size))
+
+	status := "new"
+	if p := job.prev; p != nil {
+		status = "updated"
+		if p.LBA == me.LBA && p.Size == me.Size {
+			same := true
+			if !fast {
+				crc, sum, err := hashReader(src)
+				if err != nil {
+					return nil, "", err
+				}
+				same = crc == p.CRC32 && sum == p.SHA1
+			}
+			if same {
+				status = "corrupt"
+				if crc, sum, err := hashLocal(job.dest, me.Size); err == nil && crc == p.CRC32 && sum == p.SHA1 {
+					me.CRC32, me.SHA1 = crc, sum
+					return me, "skip", nil
+				} else if os.IsNotExist(err) {
+					status = "new"
+				}
+			}
+		}
+	}
+
+	f, err := os.Create(job.dest)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	c := crc32.NewIEEE()
+	h := sha1.New()
+	if _, err := io.Copy(io.MultiWriter(f, c, h), io.NewSectionReader(r, int64(me.LBA)*int64(Sector), int64(me.Size))); err != nil {
+		return nil, "", err
+	}
+	if err := f.Close(); err != nil {
+		return nil, "", err
+	}
+	me.CRC32 = c.Sum32()
+	me.SHA1 = hex.EncodeToString(h.Sum(nil))
+	return me, status, nil
+}
+
+func hashReader(r io.Reader) (uint32, string, error) {
+	c := crc32.NewIEEE()
+	h := sha1.New()
+	if _, err := io.Copy(io.MultiWriter(c, h), r); err != nil {
+		return 0, "", err
+	}
+	return c.Sum32(), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashLocal hashes an already extracted file. A size mismatch is reported as
+// a hash that cannot match.
+func hashLocal(path string, size uint32) (uint32, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	if st, err := f.Stat(); err != nil || st.Size() != int64(size) {
+		return 0, "", err
+	}
+	return hashReader(f)
+}
+
+// LoadManifestCSV reads a manifest written by WriteManifestCSV.
+func LoadManifestCSV(path string) ([]ManifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+
+	var entries []ManifestEntry
+	for i, rec := range records {
+		if i == 0 && strings.EqualFold(rec[0], "Path") {
+			continue
+		}
+		if len(rec) < 5 {
+			return nil, fmt.Errorf("manifest line %d: expected Path,LBA,Size,CRC32,SHA1", i+1)
+		}
+		lba, err1 := strconv.ParseUint(rec[1], 10, 32)
+		size, err2 := strconv.ParseUint(rec[2], 10, 32)
+		crc, err3 := strconv.ParseUint(rec[3], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, fmt.Errorf("manifest line %d: bad number", i+1)
+		}
+		entries = append(entries, ManifestEntry{
+			Path:  rec[0],
+			LBA:   uint32(lba),
+			Size:  uint32(size),
+			CRC32: uint32(crc),
+			SHA1:  strings.ToLower(rec[4]),
+		})
+	}
+	return entries, nil
+}
+
+func WriteManifestCSV(path string, entries []ManifestEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"Path", "LBA", "Size", "CRC32", "SHA1"})
+	for _, e := range entries {
+		w.Write([]string{
+			e.Path,
+			strconv.FormatUint(uint64(e.LBA), 10),
+			strconv.FormatUint(uint64(e.Size), 10),
+			fmt.Sprintf("%08X", e.CRC32),
+			e.SHA1,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,220 @@
+package xiso
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS is a read-only io/fs view of an ISO. Names are matched
+// case-insensitively like findEntry; paths use forward slashes.
+type FS struct {
+	r    ReaderAt
+	root DirTable
+}
+
+var (
+	_ fs.FS         = (*FS)(nil)
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+)
+
+// NewFS returns a file system over the game partition of r.
+func NewFS(r ReaderAt) (*FS, error) {
+	r, vol, err := OpenVolume(r)
+	if err != nil {
+		return nil, err
+	}
+	return &FS{r: r, root: vol.Root}, nil
+}
+
+// OpenFS opens an ISO file as an FS. Close the returned file when done.
+func OpenFS(isoPath string) (*FS, *os.File, error) {
+	f, err := os.Open(isoPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	fsys, err := NewFS(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return fsys, f, nil
+}
+
+// lookup resolves name to its entry; the root directory returns nil.
+func (fsys *FS) lookup(op, name string) (*Entry, error) {
+	if !fs.ValidPath(name) || strings.Contains(name, "\\") {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return nil, nil
+	}
+	ent := findEntry(fsys.r, fsys.root, strings.ReplaceAll(name, "/", "\\"))
+	if ent == nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return ent, nil
+}
+
+func (fsys *FS) Open(name string) (fs.File, error) {
+	ent, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info := newFileInfo(name, ent)
+	if ent == nil || ent.IsDir() {
+		return &dirFile{fsys: fsys, info: info, table: fsys.tableOf(ent)}, nil
+	}
+	var sr *io.SectionReader
+	if ent.Size() > 0 {
+		sr = io.NewSectionReader(fsys.r, int64(ent.Node.Data.Sector)*int64(Sector), int64(ent.Size()))
+	} else {
+		sr = io.NewSectionReader(fsys.r, 0, 0)
+	}
+	return &file{SectionReader: sr, info: info}, nil
+}
+
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	ent, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return newFileInfo(name, ent), nil
+}
+
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	ent, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if ent != nil && !ent.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return fsys.readDir(fsys.tableOf(ent))
+}
+
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	ent, err := fsys.lookup("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if ent == nil || ent.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	data := make([]byte, ent.Size())
+	if len(data) == 0 {
+		return data, nil
+	}
+	if _, err := fsys.r.ReadAt(data, int64(ent.Node.Data.Sector)*int64(Sector)); err != nil && err != io.EOF {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+func (fsys *FS) tableOf(ent *Entry) DirTable {
+	if ent == nil {
+		return fsys.root
+	}
+	return DirTable{Region: ent.Node.Data}
+}
+
+// readDir lists a directory table sorted by name, as fs.ReadDirFS requires.
+func (fsys *FS) readDir(table DirTable) ([]fs.DirEntry, error) {
+	entries, err := WalkTree(fsys.r, table)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, ent := range entries {
+		result = append(result, fs.FileInfoToDirEntry(fileInfo{name: ent.Name, ent: ent}))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result, nil
+}
+
+// fileInfo describes an entry; a nil ent is the root directory.
+type fileInfo struct {
+	name string
+	ent  *Entry
+}
+
+func newFileInfo(name string, ent *Entry) fileInfo {
+	if ent != nil {
+		return fileInfo{name: ent.Name, ent: ent}
+	}
+	return fileInfo{name: path.Base(name)}
+}
+
+func (fi fileInfo) Name() string { return fi.name }
+
+func (fi fileInfo) Size() int64 {
+	if fi.ent == nil || fi.ent.IsDir() {
+		return 0
+	}
+	return int64(fi.ent.Size())
+}
+
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.ent == nil || fi.ent.IsDir() {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return fi.ent == nil || fi.ent.IsDir() }
+func (fi fileInfo) Sys() interface{}   { return fi.ent }
+
+type file struct {
+	*io.SectionReader
+	info fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+type dirFile struct {
+	fsys    *FS
+	info    fileInfo
+	table   DirTable
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dirFile) Close() error               { return nil }
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.readDir(d.table)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.read = true
+	}
+	if n <= 0 {
+		list := d.entries
+		d.entries = nil
+		return list, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	list := d.entries[:n]
+	d.entries = d.entries[n:]
+	return list, nil
+}
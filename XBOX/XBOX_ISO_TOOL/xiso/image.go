@@ -0,0 +1,58 @@
+package xiso
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Image is the writable view of an ISO that the modify operations work on.
+type Image interface {
+	ReaderAt
+	io.WriterAt
+	Size() (int64, error)
+	Truncate(size int64) error
+}
+
+type fileImage struct {
+	*os.File
+}
+
+func (f fileImage) Size() (int64, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+func openImage(isoPath string) (fileImage, error) {
+	f, err := os.OpenFile(isoPath, os.O_RDWR, 0)
+	if err != nil {
+		return fileImage{}, fmt.Errorf("open ISO: %w", err)
+	}
+	return fileImage{f}, nil
+}
+
+// withImage opens an ISO for writing and runs fn against its game partition.
+func withImage(isoPath string, fn func(img Image) error) error {
+	f, err := openImage(isoPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	img, err := partitionImage(f)
+	if err != nil {
+		return fmt.Errorf("parse volume: %w", err)
+	}
+	return fn(img)
+}
+
+// logOut receives the progress lines of the modify operations; batch
+// validation points it at io.Discard.
+var logOut io.Writer = os.Stdout
+
+func logf(format string, args ...interface{}) {
+	fmt.Fprintf(logOut, format, args...)
+}
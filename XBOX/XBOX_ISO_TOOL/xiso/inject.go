@@ -2,28 +2,47 @@ package xiso
 
 import (
 	"fmt"
-	"io"
 	"os"
 	"strings"
 )
 
-
+// InjectFile overwrites a file in its original sectors. Data that does not
+// fit is refused; InjectFileRelocate moves it instead.
 func InjectFile(isoPath, internalPath, localPath string) error {
-	internalPath = strings.ReplaceAll(internalPath, "/", "\\")
-	internalPath = strings.ToUpper(strings.TrimPrefix(internalPath, "\\"))
+	return withImage(isoPath, func(img Image) error {
+		return injectFile(img, internalPath, localPath, false)
+	})
+}
+
+// InjectFileRelocate replaces a file like InjectFile, but when the new data no
+// longer fits the original sectors it is moved to a free gap or the end of the
+// image and the directory entry is pointed at the new location.
+func InjectFileRelocate(isoPath, internalPath, localPath string) error {
+	return withImage(isoPath, func(img Image) error {
+		return injectFile(img, internalPath, localPath, true)
+	})
+}
+
+// ReplaceFileData is InjectFile for data held in memory.
+func ReplaceFileData(isoPath, internalPath string, data []byte, relocate bool) error {
+	return withImage(isoPath, func(img Image) error {
+		return injectData(img, internalPath, "(memory)", data, relocate)
+	})
+}
 
+func injectFile(f Image, internalPath, localPath string, relocate bool) error {
 	localData, err := os.ReadFile(localPath)
 	if err != nil {
 		return fmt.Errorf("read local file: %w", err)
 	}
+	return injectData(f, internalPath, localPath, localData, relocate)
+}
 
-	f, err := os.OpenFile(isoPath, os.O_RDWR, 0)
-	if err != nil {
-		return fmt.Errorf("open ISO: %w", err)
-	}
-	defer f.Close()
+func injectData(f Image, internalPath, localPath string, localData []byte, relocate bool) error {
+	internalPath = strings.ReplaceAll(internalPath, "/", "\\")
+	internalPath = strings.ToUpper(strings.TrimPrefix(internalPath, "\\"))
 
-	stat, err := f.Stat()
+	isoSize, err := f.Size()
 	if err != nil {
 		return err
 	}
@@ -40,9 +59,30 @@ func InjectFile(isoPath, internalPath, localPath string) error {
 
 	origSize := target.Size()
 	newSize := uint32(len(localData))
+	allocSize := uint64(origSize)
 
 	if newSize > origSize {
-		return fmt.Errorf("new file (%d bytes) is larger than original (%d bytes)", newSize, origSize)
+		if !relocate {
+			return fmt.Errorf("new file (%d bytes) is larger than original (%d bytes)", newSize, origSize)
+		}
+		var capacity uint32
+		if origSize > 0 {
+			capacity = SectorsNeeded(uint64(origSize)) * Sector
+		}
+		if newSize > capacity {
+			oldLBA := target.Node.Data.Sector
+			lba, err := writeRelocated(f, vol.Root, isoSize, localData)
+			if err != nil {
+				return err
+			}
+			if err := writeRegion(f, target, Region{Sector: lba, Size: newSize}); err != nil {
+				return err
+			}
+			logf("[+] Injected %s -> %s (%d -> %d bytes, relocated LBA %d -> %d)\n",
+				localPath, internalPath, origSize, newSize, oldLBA, lba)
+			return nil
+		}
+		allocSize = uint64(capacity)
 	}
 
 	dataOff, err := target.Node.Data.ByteOffset(0)
@@ -50,9 +90,8 @@ func InjectFile(isoPath, internalPath, localPath string) error {
 		return fmt.Errorf("get data offset: %w", err)
 	}
 
-	allocSize := uint64(origSize)
-	endOff := dataOff + allocSize
-	if endOff > uint64(stat.Size()) {
+	endOff := dataOff + uint64(origSize)
+	if endOff > uint64(isoSize) {
 		return fmt.Errorf("data region extends past end of ISO")
 	}
 
@@ -71,7 +110,40 @@ func InjectFile(isoPath, internalPath, localPath string) error {
 		return fmt.Errorf("update size field: %w", err)
 	}
 
-	fmt.Printf("[+] Injected %s -> %s (%d -> %d bytes)\n", localPath, internalPath, origSize, newSize)
+	logf("[+] Injected %s -> %s (%d -> %d bytes)\n", localPath, internalPath, origSize, newSize)
+	return nil
+}
+
+// writeRelocated stores data in the first free gap large enough to hold it,
+// or past the end of the image, and returns the chosen LBA.
+func writeRelocated(f Image, root DirTable, isoSize int64, data []byte) (uint32, error) {
+	used, err := usedExtents(f, root)
+	if err != nil {
+		return 0, err
+	}
+
+	need := SectorsNeeded(uint64(len(data)))
+	lba, ok := findGap(used, need, uint32(isoSize/int64(Sector)))
+	if !ok {
+		lba = endSector(used, isoSize)
+	}
+
+	buf := make([]byte, uint64(need)*SectorU64)
+	copy(buf, data)
+	if _, err := f.WriteAt(buf, int64(lba)*int64(Sector)); err != nil {
+		return 0, fmt.Errorf("write file data: %w", err)
+	}
+	return lba, nil
+}
+
+// writeRegion rewrites the data sector and size of a directory entry.
+func writeRegion(f Image, ent *Entry, region Region) error {
+	buf := make([]byte, 8)
+	le(buf, region)
+	if _, err := f.WriteAt(buf, int64(ent.Offset)+4); err != nil {
+		return fmt.Errorf("update directory entry: %w", err)
+	}
+	ent.Node.Data = region
 	return nil
 }
 
@@ -108,10 +180,3 @@ func findEntry(r ReaderAt, root DirTable, target string) *Entry {
 	}
 	return nil
 }
-
-
-func InjectFileWithPadding(isoPath, internalPath, localPath string) error {
-	return InjectFile(isoPath, internalPath, localPath)
-}
-
-var _ io.Reader
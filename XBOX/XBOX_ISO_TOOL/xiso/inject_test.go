@@ -0,0 +1,58 @@
+package xiso
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInjectRelocatesLargerFile(t *testing.T) {
+	iso := buildTestISO(t)
+	img, err := os.ReadFile(iso)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vol, err := ParseVolume(readSector(bytes.NewReader(img), VolSector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldLBA := findEntry(bytes.NewReader(img), vol.Root, "DEFAULT.XBE").Node.Data.Sector
+
+	data := bytes.Repeat([]byte("0123456789"), 500) // 5000 bytes, 3 sectors
+	local := filepath.Join(t.TempDir(), "DEFAULT.XBE")
+	if err := os.WriteFile(local, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InjectFile(iso, "DEFAULT.XBE", local); err == nil {
+		t.Fatal("InjectFile accepted a file larger than its sectors")
+	}
+	if err := InjectFileRelocate(iso, "DEFAULT.XBE", local); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err = os.ReadFile(iso)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ent := findEntry(bytes.NewReader(img), vol.Root, "DEFAULT.XBE")
+	if ent == nil {
+		t.Fatal("DEFAULT.XBE not found after inject")
+	}
+	if ent.Node.Data.Sector == oldLBA {
+		t.Errorf("DEFAULT.XBE still at LBA %d", oldLBA)
+	}
+	if ent.Size() != uint32(len(data)) {
+		t.Errorf("directory entry size %d, want %d", ent.Size(), len(data))
+	}
+	got, err := ReadFileData(bytes.NewReader(img), "DEFAULT.XBE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("DEFAULT.XBE data differs after relocation")
+	}
+	if got, err := ReadFileData(bytes.NewReader(img), `MEDIA\TITLE.BIN`); err != nil || string(got) != "title" {
+		t.Errorf("MEDIA\\TITLE.BIN = %q, %v", got, err)
+	}
+}
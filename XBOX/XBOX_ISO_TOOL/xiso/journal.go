@@ -0,0 +1,138 @@
+package xiso
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// undo journal layout:
+//
+//	magic[8] "XISOUNDO", origSize u64
+//	records: offset u64, length u32, original bytes[length]
+//
+// Only bytes inside the original image are recorded; anything written past
+// the old end is dropped by truncating back to origSize.
+var journalMagic = [8]byte{'X', 'I', 'S', 'O', 'U', 'N', 'D', 'O'}
+
+// journalImage saves the original content of every region it overwrites to
+// the journal, synced to disk before the write reaches the image.
+type journalImage struct {
+	fileImage
+	origSize int64
+	j        *os.File
+}
+
+func newJournalImage(img fileImage, journalPath string) (*journalImage, error) {
+	size, err := img.Size()
+	if err != nil {
+		return nil, err
+	}
+	j, err := os.OpenFile(journalPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("create journal: %w", err)
+	}
+	hdr := make([]byte, 16)
+	copy(hdr, journalMagic[:])
+	binary.LittleEndian.PutUint64(hdr[8:], uint64(size))
+	if _, err := j.Write(hdr); err != nil {
+		j.Close()
+		return nil, fmt.Errorf("write journal: %w", err)
+	}
+	if err := j.Sync(); err != nil {
+		j.Close()
+		return nil, fmt.Errorf("write journal: %w", err)
+	}
+	return &journalImage{fileImage: img, origSize: size, j: j}, nil
+}
+
+func (ji *journalImage) WriteAt(p []byte, off int64) (int, error) {
+	if off < ji.origSize && len(p) > 0 {
+		n := int64(len(p))
+		if rest := ji.origSize - off; n > rest {
+			n = rest
+		}
+		orig := make([]byte, n)
+		if _, err := ji.fileImage.ReadAt(orig, off); err != nil && err != io.EOF {
+			return 0, fmt.Errorf("journal read: %w", err)
+		}
+		rec := make([]byte, 12, 12+n)
+		binary.LittleEndian.PutUint64(rec[0:], uint64(off))
+		binary.LittleEndian.PutUint32(rec[8:], uint32(n))
+		rec = append(rec, orig...)
+		if _, err := ji.j.Write(rec); err != nil {
+			return 0, fmt.Errorf("write journal: %w", err)
+		}
+		if err := ji.j.Sync(); err != nil {
+			return 0, fmt.Errorf("write journal: %w", err)
+		}
+	}
+	return ji.fileImage.WriteAt(p, off)
+}
+
+func (ji *journalImage) closeJournal() error {
+	return ji.j.Close()
+}
+
+// Rollback restores an ISO from an undo journal written by ApplyPatch and
+// removes the journal afterwards.
+func Rollback(isoPath, journalPath string) error {
+	j, err := os.Open(journalPath)
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+
+	type record struct {
+		off  int64
+		data []byte
+	}
+
+	br := bufio.NewReader(j)
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		j.Close()
+		return fmt.Errorf("read journal header: %w", err)
+	}
+	if [8]byte(hdr[:8]) != journalMagic {
+		j.Close()
+		return fmt.Errorf("not an undo journal: %s", journalPath)
+	}
+	origSize := int64(binary.LittleEndian.Uint64(hdr[8:]))
+
+	var records []record
+	for {
+		rh := make([]byte, 12)
+		if _, err := io.ReadFull(br, rh); err != nil {
+			break // a torn record was never followed by its image write
+		}
+		data := make([]byte, binary.LittleEndian.Uint32(rh[8:]))
+		if _, err := io.ReadFull(br, data); err != nil {
+			break
+		}
+		records = append(records, record{off: int64(binary.LittleEndian.Uint64(rh[0:])), data: data})
+	}
+	j.Close()
+
+	f, err := os.OpenFile(isoPath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("open ISO: %w", err)
+	}
+	defer f.Close()
+
+	for i := len(records) - 1; i >= 0; i-- {
+		if _, err := f.WriteAt(records[i].data, records[i].off); err != nil {
+			return fmt.Errorf("restore at %d: %w", records[i].off, err)
+		}
+	}
+	if err := f.Truncate(origSize); err != nil {
+		return fmt.Errorf("truncate ISO: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	logf("[+] Rolled back %d writes, ISO size restored to %d bytes\n", len(records), origSize)
+	return os.Remove(journalPath)
+}
@@ -0,0 +1,126 @@
+package xiso
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Layout maps ISO file paths to the sector region they occupied in a
+// reference image. Keys are normalized with layoutKey.
+type Layout map[string]Region
+
+// Move describes a file whose LBA differs from the reference layout.
+type Move struct {
+	Path   string
+	OldLBA uint32
+	NewLBA uint32
+	Reason string // "grown", "new" or "overlap"
+}
+
+func layoutKey(p string) string {
+	p = strings.ToUpper(strings.ReplaceAll(p, "/", "\\"))
+	return "\\" + strings.TrimLeft(p, "\\")
+}
+
+// LoadLayout reads a layout from a reference ISO or from a CSV written by
+// ExportTable, depending on the file extension.
+func LoadLayout(path string) (Layout, error) {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return LoadLayoutCSV(path)
+	}
+	return LoadLayoutISO(path)
+}
+
+func LoadLayoutISO(isoPath string) (Layout, error) {
+	f, err := os.Open(isoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, vol, err := OpenVolume(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse volume: %w", err)
+	}
+	tree, err := FileTree(r, vol.Root)
+	if err != nil {
+		return nil, fmt.Errorf("walk file tree: %w", err)
+	}
+
+	layout := make(Layout)
+	for _, fe := range tree {
+		if fe.Entry.IsFile() {
+			layout[layoutKey(fe.Path())] = fe.Entry.Node.Data
+		}
+	}
+	return layout, nil
+}
+
+func LoadLayoutCSV(csvPath string) (Layout, error) {
+	f, err := os.Open(csvPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read CSV: %w", err)
+	}
+
+	layout := make(Layout)
+	for i, rec := range records {
+		if len(rec) < 3 {
+			return nil, fmt.Errorf("line %d: expected Path,LBA,Size", i+1)
+		}
+		if i == 0 && strings.EqualFold(rec[0], "Path") {
+			continue
+		}
+		lba, err := strconv.ParseUint(strings.TrimSpace(rec[1]), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad LBA %q", i+1, rec[1])
+		}
+		size, err := strconv.ParseUint(strings.TrimSpace(rec[2]), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad size %q", i+1, rec[2])
+		}
+		layout[layoutKey(rec[0])] = Region{Sector: uint32(lba), Size: uint32(size)}
+	}
+	return layout, nil
+}
+
+// gapAllocator hands out the first free run of sectors between the used
+// extents, falling back to the end of the image.
+type gapAllocator struct {
+	used []extent
+}
+
+func newGapAllocator() *gapAllocator {
+	return &gapAllocator{used: []extent{{Start: 0, Count: VolSector + 1}}}
+}
+
+func (a *gapAllocator) Alloc(bytes uint64) uint32 {
+	need := SectorsNeeded(bytes)
+	end := a.used[len(a.used)-1].End()
+	lba, ok := findGap(a.used, need, end)
+	if !ok {
+		lba = end
+	}
+	a.reserve(extent{Start: lba, Count: need})
+	return lba
+}
+
+// reserve marks e as used; it reports false if e overlaps an earlier range.
+func (a *gapAllocator) reserve(e extent) bool {
+	for _, u := range a.used {
+		if e.Start < u.End() && u.Start < e.End() {
+			return false
+		}
+	}
+	a.used = mergeExtents(append(a.used, e))
+	return true
+}
@@ -2,6 +2,7 @@ package xiso
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 )
@@ -111,35 +112,102 @@ func findParentDir(r ReaderAt, root DirTable, path string) (DirTable, *Entry, er
 			return DirTable{}, nil, err
 		}
 
+		var match *Entry
 		for _, ent := range entries {
 			if strings.EqualFold(ent.Name, part) {
-				if i == len(parts)-1 {
-					return current, ent, nil
-				}
-				if ent.IsDir() {
-					current = DirTable{Region: ent.Node.Data}
-					break
-				}
-				return DirTable{}, nil, fmt.Errorf("not a directory: %s", part)
+				match = ent
+				break
 			}
 		}
+		// a missing component ends the walk; never fall back to a later one
+		if match == nil {
+			return DirTable{}, nil, fmt.Errorf("path not found: %s", path)
+		}
+		if i == len(parts)-1 {
+			return current, match, nil
+		}
+		if !match.IsDir() {
+			return DirTable{}, nil, fmt.Errorf("not a directory: %s", part)
+		}
+		current = DirTable{Region: match.Node.Data}
 	}
 	return DirTable{}, nil, fmt.Errorf("path not found: %s", path)
 }
 
 
+// writeDirTable rebuilds a directory table in place. The new table must fit in
+// the sectors the table already occupies; unused space is filled with 0xff.
+func writeDirTable(f io.WriterAt, table DirTable, entries []dirModEntry) error {
+	buf, err := buildDirTable(table, entries)
+	if err != nil {
+		return err
+	}
+
+	tableOff := int64(table.Region.Sector) * int64(Sector)
+	if _, err := f.WriteAt(buf, tableOff); err != nil {
+		return fmt.Errorf("write dir table: %w", err)
+	}
+	return nil
+}
+
+// buildDirTable serializes entries padded to the size of an existing table.
+func buildDirTable(table DirTable, entries []dirModEntry) ([]byte, error) {
+	buf, tableSize := rebuildDirTable(entries)
+	allocSize := SectorsNeeded(uint64(table.Region.Size)) * Sector
+	if uint32(len(buf)) > allocSize {
+		return nil, fmt.Errorf("directory table full: need %d bytes, have %d", tableSize, allocSize)
+	}
+	if uint32(len(buf)) < allocSize {
+		pad := make([]byte, allocSize-uint32(len(buf)))
+		for i := range pad {
+			pad[i] = 0xff
+		}
+		buf = append(buf, pad...)
+	}
+	return buf, nil
+}
+
+// setTableSize raises the recorded size of the directory table at dir (in the
+// volume descriptor for the root, given as "", "." or "\\", else in the
+// directory's own entry) to the whole sectors a rebuilt table of size bytes
+// occupies. Readers stop at the recorded size, so a table that grew inside its
+// sectors must be re-recorded.
+func setTableSize(f Image, root DirTable, dir string, size uint32) error {
+	size = SectorsNeeded(uint64(size)) * Sector
+	dir = cleanDirPath(dir)
+	if dir == "" || dir == "." {
+		if root.Region.Size >= size {
+			return nil
+		}
+		buf := make([]byte, 8)
+		le(buf, Region{Sector: root.Region.Sector, Size: size})
+		if _, err := f.WriteAt(buf, int64(VolSector)*int64(Sector)+0x14); err != nil {
+			return fmt.Errorf("update volume descriptor: %w", err)
+		}
+		return nil
+	}
+	_, ent, err := findParentDir(f, root, dir)
+	if err != nil {
+		return err
+	}
+	if ent.Node.Data.Size >= size {
+		return nil
+	}
+	return writeRegion(f, ent, Region{Sector: ent.Node.Data.Sector, Size: size})
+}
+
 func RenameFile(isoPath, internalPath, newName string) error {
+	return withImage(isoPath, func(img Image) error {
+		return renameFile(img, internalPath, newName)
+	})
+}
+
+func renameFile(f Image, internalPath, newName string) error {
 	newName = strings.ToUpper(newName)
 	if len(newName) > MaxNameLen {
 		return fmt.Errorf("name too long: %d > %d", len(newName), MaxNameLen)
 	}
 
-	f, err := os.OpenFile(isoPath, os.O_RDWR, 0)
-	if err != nil {
-		return fmt.Errorf("open ISO: %w", err)
-	}
-	defer f.Close()
-
 	vol, err := ParseVolume(readSector(f, VolSector))
 	if err != nil {
 		return fmt.Errorf("parse volume: %w", err)
@@ -172,7 +240,7 @@ func RenameFile(isoPath, internalPath, newName string) error {
 		if _, err := f.WriteAt(nlenBuf, int64(target.Offset)+13); err != nil {
 			return fmt.Errorf("write nlen: %w", err)
 		}
-		fmt.Printf("[+] Renamed %s -> %s (in-place)\n", oldName, newName)
+		logf("[+] Renamed %s -> %s (in-place)\n", oldName, newName)
 		return nil
 	}
 
@@ -205,14 +273,28 @@ func RenameFile(isoPath, internalPath, newName string) error {
 	}
 
 	// update parent region size in grandparent (or volume root)
-	// skip for now — size increase is within allocated space
+	parentDir := cleanDirPath(internalPath)
+	if i := strings.LastIndex(parentDir, "\\"); i >= 0 {
+		parentDir = parentDir[:i]
+	} else {
+		parentDir = ""
+	}
+	if err := setTableSize(f, vol.Root, parentDir, tableSize); err != nil {
+		return err
+	}
 
-	fmt.Printf("[+] Renamed %s -> %s (table rebuilt, %d bytes)\n", oldName, newName, tableSize)
+	logf("[+] Renamed %s -> %s (table rebuilt, %d bytes)\n", oldName, newName, tableSize)
 	return nil
 }
 
 
 func AppendFile(isoPath, localPath, internalDir, fileName string) error {
+	return withImage(isoPath, func(img Image) error {
+		return appendFile(img, localPath, internalDir, fileName)
+	})
+}
+
+func appendFile(f Image, localPath, internalDir, fileName string) error {
 	fileName = strings.ToUpper(fileName)
 	if len(fileName) > MaxNameLen {
 		return fmt.Errorf("name too long: %d > %d", len(fileName), MaxNameLen)
@@ -226,13 +308,7 @@ func AppendFile(isoPath, localPath, internalDir, fileName string) error {
 		return fmt.Errorf("local file is empty")
 	}
 
-	f, err := os.OpenFile(isoPath, os.O_RDWR, 0)
-	if err != nil {
-		return fmt.Errorf("open ISO: %w", err)
-	}
-	defer f.Close()
-
-	stat, err := f.Stat()
+	isoSize, err := f.Size()
 	if err != nil {
 		return err
 	}
@@ -242,26 +318,13 @@ func AppendFile(isoPath, localPath, internalDir, fileName string) error {
 		return fmt.Errorf("parse volume: %w", err)
 	}
 
-	internalDir = strings.ReplaceAll(internalDir, "/", "\\")
-	internalDir = strings.TrimPrefix(internalDir, "\\")
-	internalDir = strings.TrimSuffix(internalDir, "\\")
-
-	var parentTable DirTable
-	if internalDir == "" || internalDir == "." {
-		parentTable = vol.Root
-	} else {
-		parent, dirEntry, err := findParentDir(f, vol.Root, internalDir)
-		if err != nil {
-			return fmt.Errorf("find directory: %w", err)
-		}
-		if !dirEntry.IsDir() {
-			return fmt.Errorf("not a directory: %s", internalDir)
-		}
-		_ = parent // we use dirEntry's data region
-		parentTable = DirTable{Region: dirEntry.Node.Data}
+	internalDir = cleanDirPath(internalDir)
+	parentTable, err := resolveDir(f, vol.Root, internalDir)
+	if err != nil {
+		return err
 	}
 
-	eof := stat.Size()
+	eof := isoSize
 	if eof%int64(Sector) != 0 {
 		eof += int64(Sector) - eof%int64(Sector)
 	}
@@ -312,7 +375,31 @@ func AppendFile(isoPath, localPath, internalDir, fileName string) error {
 	if _, err := f.WriteAt(buf, tableOff); err != nil {
 		return fmt.Errorf("write dir table: %w", err)
 	}
+	if err := setTableSize(f, vol.Root, internalDir, tableSize); err != nil {
+		return err
+	}
 
-	fmt.Printf("[+] Appended %s -> %s\\%s (LBA=%d, %d bytes)\n", localPath, internalDir, fileName, newLBA, fileSize)
+	logf("[+] Appended %s -> %s\\%s (LBA=%d, %d bytes)\n", localPath, internalDir, fileName, newLBA, fileSize)
 	return nil
 }
+
+func cleanDirPath(dir string) string {
+	dir = strings.ReplaceAll(dir, "/", "\\")
+	dir = strings.TrimPrefix(dir, "\\")
+	return strings.TrimSuffix(dir, "\\")
+}
+
+// resolveDir returns the table of a directory path; "" and "." are the root.
+func resolveDir(r ReaderAt, root DirTable, dir string) (DirTable, error) {
+	if dir == "" || dir == "." {
+		return root, nil
+	}
+	_, dirEntry, err := findParentDir(r, root, dir)
+	if err != nil {
+		return DirTable{}, fmt.Errorf("find directory: %w", err)
+	}
+	if !dirEntry.IsDir() {
+		return DirTable{}, fmt.Errorf("not a directory: %s", dir)
+	}
+	return DirTable{Region: dirEntry.Node.Data}, nil
+}
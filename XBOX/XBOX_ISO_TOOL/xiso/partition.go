@@ -0,0 +1,117 @@
+package xiso
+
+import (
+	"fmt"
+)
+
+// PartitionOffsets are the byte offsets at which the XDVDFS game partition is
+// searched for. Plain XISO images start at 0; full Redump-style dumps put a
+// video partition in front of the game data.
+var PartitionOffsets = []int64{
+	0,          // trimmed / rebuilt XISO
+	0x18300000, // XGD1
+	0x0FD90000, // XGD2
+	0x02080000, // XGD3
+}
+
+// partitionLengths is the size of the game partition of a full dump, by its
+// offset. Video data follows it, so the partition cannot grow.
+var partitionLengths = map[int64]int64{
+	0x18300000: 0x1A2DB0000, // XGD1
+	0x0FD90000: 0x1B3880000, // XGD2
+	0x02080000: 0x204510000, // XGD3
+}
+
+// FindPartition returns the offset of the first valid volume descriptor.
+func FindPartition(r ReaderAt) (int64, error) {
+	for _, off := range PartitionOffsets {
+		buf := make([]byte, Sector)
+		if _, err := r.ReadAt(buf, off+int64(VolSector)*int64(Sector)); err != nil {
+			continue
+		}
+		if _, err := ParseVolume(buf); err == nil {
+			return off, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid XDVDFS magic (no game partition found)")
+}
+
+// partReader shifts all reads by the game partition offset, so sector numbers
+// from the file system can be used unchanged.
+type partReader struct {
+	r   ReaderAt
+	off int64
+}
+
+func (p partReader) ReadAt(b []byte, off int64) (int, error) {
+	return p.r.ReadAt(b, off+p.off)
+}
+
+// OpenVolume locates the game partition and returns a reader relative to it
+// together with the parsed volume descriptor.
+func OpenVolume(r ReaderAt) (ReaderAt, *Volume, error) {
+	off, err := FindPartition(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if off != 0 {
+		r = partReader{r: r, off: off}
+	}
+	vol, err := ParseVolume(readSector(r, VolSector))
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, vol, nil
+}
+
+// partImage is partReader for writable images. Size reports the game
+// partition, and writes past it fail instead of overwriting the video data.
+type partImage struct {
+	Image
+	off, length int64
+}
+
+func (p partImage) errFull(end int64) error {
+	return fmt.Errorf("0x%X is past the end of the game partition (0x%X bytes); a full dump cannot grow, -compact it to an XISO first", end, p.length)
+}
+
+func (p partImage) ReadAt(b []byte, off int64) (int, error) {
+	return p.Image.ReadAt(b, off+p.off)
+}
+
+func (p partImage) WriteAt(b []byte, off int64) (int, error) {
+	if end := off + int64(len(b)); end > p.length {
+		return 0, p.errFull(end)
+	}
+	return p.Image.WriteAt(b, off+p.off)
+}
+
+func (p partImage) Size() (int64, error) {
+	size, err := p.Image.Size()
+	return min(size-p.off, p.length), err
+}
+
+// Truncate never shortens the file: it ends with the video data, which stays
+// where it is.
+func (p partImage) Truncate(size int64) error {
+	if size > p.length {
+		return p.errFull(size)
+	}
+	if cur, err := p.Image.Size(); err != nil || size+p.off <= cur {
+		return err
+	}
+	return p.Image.Truncate(size + p.off)
+}
+
+// partitionImage wraps img so that offset 0 is the start of the game partition.
+func partitionImage(img Image) (Image, error) {
+	off, err := FindPartition(img)
+	if err != nil {
+		return nil, err
+	}
+	if off == 0 {
+		return img, nil
+	}
+	logf("[*] Game partition at 0x%X\n", off)
+	return partImage{Image: img, off: off, length: partitionLengths[off]}, nil
+}
@@ -0,0 +1,96 @@
+package xiso
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildFullDump puts the test XISO at the XGD3 offset of a sparse file that
+// ends with video data after the game partition.
+func buildFullDump(t *testing.T) (string, int64) {
+	t.Helper()
+	xiso, err := os.ReadFile(buildTestISO(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const off = 0x02080000
+	videoAt := off + partitionLengths[off]
+	path := filepath.Join(t.TempDir(), "full.iso")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(xiso, off); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("VIDEO"), videoAt); err != nil {
+		t.Fatal(err)
+	}
+	return path, videoAt
+}
+
+func checkVideo(t *testing.T, path string, videoAt int64) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 6)
+	n, _ := f.ReadAt(buf, videoAt)
+	if n != 5 || string(buf[:5]) != "VIDEO" {
+		t.Fatalf("video data after the partition changed: %q", buf[:n])
+	}
+}
+
+func TestFullDumpRelocateStaysInPartition(t *testing.T) {
+	path, videoAt := buildFullDump(t)
+	data := bytes.Repeat([]byte("x"), 3*int(Sector))
+	if err := ReplaceFileData(path, "DEFAULT.XBE", data, true); err != nil {
+		t.Fatal(err)
+	}
+	checkVideo(t, path, videoAt)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := ReadFileData(f, "DEFAULT.XBE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("relocated data differs")
+	}
+}
+
+func TestFullDumpCannotGrow(t *testing.T) {
+	path, videoAt := buildFullDump(t)
+	f, err := openImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := partitionImage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := img.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != partitionLengths[0x02080000] {
+		t.Errorf("Size %#x, want the partition length %#x", size, partitionLengths[0x02080000])
+	}
+	if _, err := img.WriteAt([]byte("ab"), size-1); err == nil {
+		t.Error("write across the partition end succeeded")
+	}
+	if err := img.Truncate(size + int64(Sector)); err == nil {
+		t.Error("growing the partition succeeded")
+	}
+	checkVideo(t, path, videoAt)
+}
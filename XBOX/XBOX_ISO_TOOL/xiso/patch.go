@@ -0,0 +1,202 @@
+package xiso
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Manifest is a batch of operations applied to one ISO by ApplyPatch.
+//
+//	{"operations": [
+//	  {"op": "inject", "path": "DATA\\INDEX.BIN", "file": "index.bin", "grow": true},
+//	  {"op": "rename", "path": "DATA\\FONT.BIN", "name": "000"},
+//	  {"op": "append", "file": "cn", "dir": "DATA", "name": "CN"},
+//	  {"op": "delete", "path": "MEDIA\\DEMO.XMV", "zero": true}
+//	]}
+//
+// Relative local paths are resolved against the manifest's directory.
+type Manifest struct {
+	Operations []PatchOp `json:"operations"`
+}
+
+type PatchOp struct {
+	Op   string `json:"op"`
+	Path string `json:"path,omitempty"` // ISO path for inject, rename and delete
+	File string `json:"file,omitempty"` // local file or directory for inject and append
+	Dir  string `json:"dir,omitempty"`  // append: target directory in ISO
+	Name string `json:"name,omitempty"` // rename: new name; append: name in ISO
+	Grow bool   `json:"grow,omitempty"` // inject: relocate when larger than original
+	Zero bool   `json:"zero,omitempty"` // delete: zero freed sectors
+}
+
+func (op PatchOp) String() string {
+	switch op.Op {
+	case "append":
+		return fmt.Sprintf("append %s -> %s", op.File, op.Dir)
+	case "inject":
+		return fmt.Sprintf("inject %s -> %s", op.File, op.Path)
+	}
+	return op.Op + " " + op.Path
+}
+
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+
+	base := filepath.Dir(path)
+	for i := range m.Operations {
+		op := &m.Operations[i]
+		if op.File != "" && !filepath.IsAbs(op.File) {
+			op.File = filepath.Join(base, op.File)
+		}
+	}
+	return m, nil
+}
+
+// ApplyPatch runs every manifest operation against a copy-on-write view of
+// the ISO first and only writes to the real image when all of them succeed.
+// While applying, the original bytes are saved to journalPath; if an
+// operation still fails the image is rolled back, and after a crash Rollback
+// restores it. The journal is removed on success.
+func ApplyPatch(isoPath string, m *Manifest, journalPath string) error {
+	if len(m.Operations) == 0 {
+		return fmt.Errorf("manifest has no operations")
+	}
+	if _, err := os.Stat(journalPath); err == nil {
+		return fmt.Errorf("journal %s exists: roll back the previous run first", journalPath)
+	}
+
+	fmt.Printf("[*] Validating %d operations...\n", len(m.Operations))
+	if err := validatePatch(isoPath, m); err != nil {
+		return err
+	}
+
+	// img is closed on every path below rather than deferred: a failed
+	// operation has to close it before Rollback reopens the file
+	img, err := openImage(isoPath)
+	if err != nil {
+		return err
+	}
+
+	ji, err := newJournalImage(img, journalPath)
+	if err != nil {
+		img.Close()
+		return err
+	}
+
+	part, err := partitionImage(ji)
+	if err != nil {
+		ji.closeJournal()
+		img.Close()
+		os.Remove(journalPath)
+		return fmt.Errorf("parse volume: %w", err)
+	}
+
+	fmt.Printf("[*] Applying %d operations...\n", len(m.Operations))
+	for i, op := range m.Operations {
+		if err := runPatchOp(part, op); err != nil {
+			ji.closeJournal()
+			if cerr := img.Close(); cerr != nil {
+				err = fmt.Errorf("%w; close ISO: %v", err, cerr)
+			}
+			if rerr := Rollback(isoPath, journalPath); rerr != nil {
+				return fmt.Errorf("operation %d (%s): %v; rollback failed: %w", i+1, op, err, rerr)
+			}
+			return fmt.Errorf("operation %d (%s): %w (rolled back)", i+1, op, err)
+		}
+	}
+
+	if err := img.Sync(); err != nil {
+		ji.closeJournal()
+		img.Close()
+		return fmt.Errorf("sync ISO: %w", err)
+	}
+	ji.closeJournal()
+	if err := img.Close(); err != nil {
+		return fmt.Errorf("close ISO: %w", err)
+	}
+	return os.Remove(journalPath)
+}
+
+func validatePatch(isoPath string, m *Manifest) error {
+	f, err := os.Open(isoPath)
+	if err != nil {
+		return fmt.Errorf("open ISO: %w", err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	shadow, err := newShadowImage(f, stat.Size())
+	if err != nil {
+		return fmt.Errorf("create shadow image: %w", err)
+	}
+	defer shadow.Close()
+
+	out := logOut
+	logOut = io.Discard
+	defer func() { logOut = out }()
+
+	part, err := partitionImage(shadow)
+	if err != nil {
+		return fmt.Errorf("parse volume: %w", err)
+	}
+	for i, op := range m.Operations {
+		if err := runPatchOp(part, op); err != nil {
+			return fmt.Errorf("operation %d (%s): %w", i+1, op, err)
+		}
+	}
+	return nil
+}
+
+func runPatchOp(img Image, op PatchOp) error {
+	switch op.Op {
+	case "inject":
+		if op.Path == "" || op.File == "" {
+			return fmt.Errorf("inject requires path and file")
+		}
+		return injectFile(img, op.Path, op.File, op.Grow)
+
+	case "rename":
+		if op.Path == "" || op.Name == "" {
+			return fmt.Errorf("rename requires path and name")
+		}
+		return renameFile(img, op.Path, op.Name)
+
+	case "append":
+		if op.File == "" {
+			return fmt.Errorf("append requires file")
+		}
+		name := op.Name
+		if name == "" {
+			name = filepath.Base(op.File)
+		}
+		info, err := os.Stat(op.File)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return appendDir(img, op.File, op.Dir, name)
+		}
+		return appendFile(img, op.File, op.Dir, name)
+
+	case "delete":
+		if op.Path == "" {
+			return fmt.Errorf("delete requires path")
+		}
+		return removeEntry(img, op.Path, removeAny, op.Zero)
+	}
+	return fmt.Errorf("unknown operation %q", op.Op)
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"strings"
 )
 
@@ -12,43 +11,11 @@ type ReaderAt interface {
 	ReadAt(p []byte, off int64) (n int, err error)
 }
 
+// Extract copies every file to outDir one at a time. See ExtractWith for
+// parallel extraction with a manifest.
 func Extract(r ReaderAt, size int64, outDir string) error {
-	vol, err := ParseVolume(readSector(r, VolSector))
-	if err != nil {
-		return fmt.Errorf("parse volume: %w", err)
-	}
-
-	tree, err := FileTree(r, vol.Root)
-	if err != nil {
-		return fmt.Errorf("walk file tree: %w", err)
-	}
-
-	if err := os.MkdirAll(outDir, 0755); err != nil {
-		return err
-	}
-
-	for _, fe := range tree {
-		dir := filepath.Join(outDir, filepath.FromSlash(fe.Dir))
-		name := fe.Entry.Name
-		full := filepath.Join(dir, name)
-
-		if fe.Entry.IsDir() {
-			fmt.Printf("  [DIR]  %s\n", filepath.Join(fe.Dir, name))
-			if err := os.MkdirAll(full, 0755); err != nil {
-				return err
-			}
-			continue
-		}
-
-		fmt.Printf("  [FILE] %s\n", filepath.Join(fe.Dir, name))
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return err
-		}
-		if err := extractFile(r, fe.Entry, full); err != nil {
-			return err
-		}
-	}
-	return nil
+	_, err := ExtractWith(r, outDir, ExtractOptions{Workers: 1})
+	return err
 }
 
 func extractFile(r ReaderAt, ent *Entry, dest string) error {
@@ -97,7 +64,7 @@ func GetFile(r ReaderAt, isoSize int64, internalPath, dest string) error {
 	internalPath = strings.ReplaceAll(internalPath, "/", "\\")
 	internalPath = strings.TrimPrefix(internalPath, "\\")
 
-	vol, err := ParseVolume(readSector(r, VolSector))
+	r, vol, err := OpenVolume(r)
 	if err != nil {
 		return fmt.Errorf("parse volume: %w", err)
 	}
@@ -118,6 +85,32 @@ func GetFile(r ReaderAt, isoSize int64, internalPath, dest string) error {
 	return nil
 }
 
+// ReadFileData returns the contents of a file inside the image.
+func ReadFileData(r ReaderAt, internalPath string) ([]byte, error) {
+	internalPath = strings.ReplaceAll(internalPath, "/", "\\")
+	internalPath = strings.TrimPrefix(internalPath, "\\")
+
+	r, vol, err := OpenVolume(r)
+	if err != nil {
+		return nil, fmt.Errorf("parse volume: %w", err)
+	}
+	ent := findEntry(r, vol.Root, internalPath)
+	if ent == nil {
+		return nil, fmt.Errorf("file not found: %s", internalPath)
+	}
+	if ent.IsDir() {
+		return nil, fmt.Errorf("is a directory: %s", internalPath)
+	}
+
+	data := make([]byte, ent.Size())
+	if len(data) > 0 {
+		if _, err := r.ReadAt(data, int64(ent.Node.Data.Sector)*int64(Sector)); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
 func readSector(r ReaderAt, sector uint32) []byte {
 	buf := make([]byte, Sector)
 	r.ReadAt(buf, int64(uint64(sector)*SectorU64))
@@ -0,0 +1,145 @@
+package xiso
+
+import (
+	"io"
+	"os"
+)
+
+// shadowImage is a copy-on-write view over a read-only ISO. Written sectors
+// go to a sparse temporary file, so a dry run never touches the base image.
+type shadowImage struct {
+	base     ReaderAt
+	baseSize int64
+	size     int64
+	tmp      *os.File
+	dirty    map[int64]bool
+}
+
+func newShadowImage(base ReaderAt, size int64) (*shadowImage, error) {
+	tmp, err := os.CreateTemp("", "xiso-shadow-*")
+	if err != nil {
+		return nil, err
+	}
+	return &shadowImage{
+		base:     base,
+		baseSize: size,
+		size:     size,
+		tmp:      tmp,
+		dirty:    make(map[int64]bool),
+	}, nil
+}
+
+func (s *shadowImage) Close() error {
+	name := s.tmp.Name()
+	err := s.tmp.Close()
+	os.Remove(name)
+	return err
+}
+
+func (s *shadowImage) Size() (int64, error) { return s.size, nil }
+
+// Truncate drops written sectors past size and clips the base image, so data
+// cut off reads as zero if the image grows again.
+func (s *shadowImage) Truncate(size int64) error {
+	if size < s.size {
+		last := size / int64(Sector)
+		for sec := range s.dirty {
+			if sec > last || sec == last && size%int64(Sector) == 0 {
+				delete(s.dirty, sec)
+			}
+		}
+		if s.dirty[last] {
+			tail := make([]byte, (last+1)*int64(Sector)-size)
+			if _, err := s.tmp.WriteAt(tail, size); err != nil {
+				return err
+			}
+		}
+		if size < s.baseSize {
+			s.baseSize = size
+		}
+	}
+	s.size = size
+	return nil
+}
+
+func (s *shadowImage) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= s.size {
+			return n, io.EOF
+		}
+		sec := pos / int64(Sector)
+		chunk := int64(Sector) - pos%int64(Sector)
+		if rest := int64(len(p) - n); chunk > rest {
+			chunk = rest
+		}
+		if rest := s.size - pos; chunk > rest {
+			chunk = rest
+		}
+		dst := p[n : n+int(chunk)]
+		if s.dirty[sec] {
+			if _, err := s.tmp.ReadAt(dst, pos); err != nil {
+				return n, err
+			}
+		} else if err := s.readBase(dst, pos); err != nil {
+			return n, err
+		}
+		n += int(chunk)
+	}
+	return n, nil
+}
+
+// readBase reads from the original image; bytes past its end read as zero.
+func (s *shadowImage) readBase(dst []byte, pos int64) error {
+	for i := range dst {
+		dst[i] = 0
+	}
+	if pos >= s.baseSize {
+		return nil
+	}
+	want := dst
+	if rest := s.baseSize - pos; int64(len(want)) > rest {
+		want = want[:rest]
+	}
+	if _, err := s.base.ReadAt(want, pos); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func (s *shadowImage) WriteAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	end := off + int64(len(p))
+	first := off / int64(Sector)
+	last := (end - 1) / int64(Sector)
+
+	// partially covered edge sectors need their old content first
+	for _, sec := range []int64{first, last} {
+		if s.dirty[sec] {
+			continue
+		}
+		if off > sec*int64(Sector) || end < (sec+1)*int64(Sector) {
+			buf := make([]byte, Sector)
+			if err := s.readBase(buf, sec*int64(Sector)); err != nil {
+				return 0, err
+			}
+			if _, err := s.tmp.WriteAt(buf, sec*int64(Sector)); err != nil {
+				return 0, err
+			}
+		}
+	}
+	for sec := first; sec <= last; sec++ {
+		s.dirty[sec] = true
+	}
+
+	if _, err := s.tmp.WriteAt(p, off); err != nil {
+		return 0, err
+	}
+	if end > s.size {
+		s.size = end
+	}
+	return len(p), nil
+}
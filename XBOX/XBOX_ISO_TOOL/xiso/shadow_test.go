@@ -0,0 +1,42 @@
+package xiso
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestShadowTruncateGrow(t *testing.T) {
+	const sec = int(Sector)
+	base := bytes.Repeat([]byte{0xBB}, 4*sec)
+	s, err := newShadowImage(bytes.NewReader(base), int64(len(base)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.WriteAt(bytes.Repeat([]byte{0xDD}, 2*sec), int64(sec)); err != nil {
+		t.Fatal(err)
+	}
+	cut := sec + 100
+	if err := s.Truncate(int64(cut)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Truncate(int64(len(base))); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]byte, len(base))
+	if _, err := s.ReadAt(got, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := make([]byte, len(base))
+	copy(want, base[:sec])
+	copy(want[sec:cut], bytes.Repeat([]byte{0xDD}, 100))
+	if !bytes.Equal(got, want) {
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("byte 0x%X is 0x%02X, want 0x%02X", i, got[i], want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package xiso
+
+import (
+	"fmt"
+	"sort"
+)
+
+// extent is a run of sectors occupied by a table or file
+type extent struct {
+	Start uint32
+	Count uint32
+}
+
+func (e extent) End() uint32 { return e.Start + e.Count }
+
+// usedExtents returns the merged, sorted sector ranges referenced by the
+// volume: the reserved header area, every directory table and all file data.
+func usedExtents(r ReaderAt, root DirTable) ([]extent, error) {
+	used := []extent{{Start: 0, Count: VolSector + 1}}
+	if !root.Empty() {
+		used = append(used, extent{Start: root.Region.Sector, Count: SectorsNeeded(uint64(root.Region.Size))})
+	}
+
+	tree, err := FileTree(r, root)
+	if err != nil {
+		return nil, fmt.Errorf("walk file tree: %w", err)
+	}
+	for _, fe := range tree {
+		d := fe.Entry.Node.Data
+		if d.Size == 0 {
+			continue
+		}
+		used = append(used, extent{Start: d.Sector, Count: SectorsNeeded(uint64(d.Size))})
+	}
+	return mergeExtents(used), nil
+}
+
+func mergeExtents(ext []extent) []extent {
+	if len(ext) == 0 {
+		return nil
+	}
+	sort.Slice(ext, func(i, j int) bool { return ext[i].Start < ext[j].Start })
+
+	result := []extent{ext[0]}
+	for _, e := range ext[1:] {
+		last := &result[len(result)-1]
+		if e.Start <= last.End() {
+			if e.End() > last.End() {
+				last.Count = e.End() - last.Start
+			}
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// findGap returns the first free run of at least need sectors below limit.
+func findGap(used []extent, need, limit uint32) (uint32, bool) {
+	var pos uint32
+	for _, u := range used {
+		if u.Start >= limit {
+			break
+		}
+		if u.Start > pos && u.Start-pos >= need {
+			return pos, true
+		}
+		if u.End() > pos {
+			pos = u.End()
+		}
+	}
+	if pos < limit && limit-pos >= need {
+		return pos, true
+	}
+	return 0, false
+}
+
+// endSector returns the first sector past both the used data and the image.
+func endSector(used []extent, imageSize int64) uint32 {
+	end := uint32((uint64(imageSize) + SectorU64 - 1) / SectorU64)
+	if len(used) > 0 && used[len(used)-1].End() > end {
+		end = used[len(used)-1].End()
+	}
+	return end
+}
@@ -9,7 +9,7 @@ import (
 )
 
 func ExportTable(r ReaderAt, size int64, csvPath string) error {
-	vol, err := ParseVolume(readSector(r, VolSector))
+	r, vol, err := OpenVolume(r)
 	if err != nil {
 		return fmt.Errorf("parse volume: %w", err)
 	}
@@ -34,12 +34,7 @@ func ExportTable(r ReaderAt, size int64, csvPath string) error {
 			continue
 		}
 
-		fullPath := fe.Dir + "\\" + fe.Entry.Name
-		fullPath = strings.ReplaceAll(fullPath, "/", "\\")
-		for strings.HasPrefix(fullPath, "\\\\") {
-			fullPath = fullPath[1:]
-		}
-
+		fullPath := fe.Path()
 		lba := fe.Entry.Node.Data.Sector
 		fsize := fe.Entry.Size()
 		sectors := SectorsNeeded(uint64(fsize))
@@ -57,3 +52,13 @@ func ExportTable(r ReaderAt, size int64, csvPath string) error {
 	fmt.Printf("[+] Exported %d files -> %s\n", count, csvPath)
 	return nil
 }
+
+// Path returns the entry's ISO path in the form used by ExportTable (\DATA\INDEX.BIN).
+func (fe FileEntry) Path() string {
+	fullPath := fe.Dir + "\\" + fe.Entry.Name
+	fullPath = strings.ReplaceAll(fullPath, "/", "\\")
+	for strings.HasPrefix(fullPath, "\\\\") {
+		fullPath = fullPath[1:]
+	}
+	return fullPath
+}
@@ -0,0 +1,154 @@
+package xiso
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// ImportTable moves file data to the LBAs listed in a CSV of the form written
+// by ExportTable and points the directory entries at the new sectors. The
+// resulting layout is checked first: if two files, a directory table or the
+// volume header would share a sector, or a file would end past the image,
+// nothing is written.
+func ImportTable(isoPath, csvPath string) error {
+	layout, err := LoadLayoutCSV(csvPath)
+	if err != nil {
+		return err
+	}
+	return withImage(isoPath, func(img Image) error {
+		return importTable(img, layout)
+	})
+}
+
+type placed struct {
+	name string
+	ext  extent
+}
+
+func importTable(f Image, layout Layout) error {
+	vol, err := ParseVolume(readSector(f, VolSector))
+	if err != nil {
+		return fmt.Errorf("parse volume: %w", err)
+	}
+	tree, err := FileTree(f, vol.Root)
+	if err != nil {
+		return fmt.Errorf("walk file tree: %w", err)
+	}
+
+	all := []placed{{name: "(volume header)", ext: extent{Start: 0, Count: VolSector + 1}}}
+	if !vol.Root.Empty() {
+		all = append(all, placed{name: "\\ (root table)", ext: extent{Start: vol.Root.Region.Sector, Count: SectorsNeeded(uint64(vol.Root.Region.Size))}})
+	}
+
+	var moves []FileEntry
+	var targets []uint32
+	seen := make(map[string]bool)
+	for _, fe := range tree {
+		ent := fe.Entry
+		key := layoutKey(fe.Path())
+		lba := ent.Node.Data.Sector
+		if ref, ok := layout[key]; ok && ent.IsFile() {
+			seen[key] = true
+			if ref.Size != ent.Size() {
+				return fmt.Errorf("%s: size in table is %d, ISO has %d", fe.Path(), ref.Size, ent.Size())
+			}
+			if ref.Sector != lba && ent.Size() > 0 {
+				moves = append(moves, fe)
+				targets = append(targets, ref.Sector)
+				lba = ref.Sector
+			}
+		}
+		if ent.Size() == 0 {
+			continue
+		}
+		all = append(all, placed{name: fe.Path(), ext: extent{Start: lba, Count: SectorsNeeded(uint64(ent.Size()))}})
+	}
+	for key := range layout {
+		if !seen[key] {
+			return fmt.Errorf("not a file in ISO: %s", key)
+		}
+	}
+	if len(moves) == 0 {
+		logf("[+] Table matches ISO, nothing to move\n")
+		return nil
+	}
+
+	size, err := f.Size()
+	if err != nil {
+		return err
+	}
+	limit := uint32(size / int64(Sector))
+	for i, fe := range moves {
+		ext := extent{Start: targets[i], Count: SectorsNeeded(uint64(fe.Entry.Size()))}
+		if ext.End() > limit {
+			return fmt.Errorf("%s: LBA %d-%d is past the end of the image (%d sectors), ISO not modified",
+				fe.Path(), ext.Start, ext.End()-1, limit)
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].ext.Start < all[j].ext.Start })
+	var overlaps int
+	last := 0 // the extent reaching furthest so far
+	for i := 1; i < len(all); i++ {
+		if all[last].ext.End() > all[i].ext.Start {
+			logf("  [OVERLAP] %s (LBA %d-%d) <-> %s (LBA %d-%d)\n",
+				all[last].name, all[last].ext.Start, all[last].ext.End()-1,
+				all[i].name, all[i].ext.Start, all[i].ext.End()-1)
+			overlaps++
+		}
+		if all[i].ext.End() > all[last].ext.End() {
+			last = i
+		}
+	}
+	if overlaps > 0 {
+		return fmt.Errorf("%d overlapping regions, ISO not modified", overlaps)
+	}
+
+	// stage the moved data first so files can trade places
+	stage, err := os.CreateTemp("", "xiso-stage-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(stage.Name())
+	defer stage.Close()
+
+	stageOff := make([]int64, len(moves))
+	var pos int64
+	for i, fe := range moves {
+		stageOff[i] = pos
+		src := io.NewSectionReader(f, int64(fe.Entry.Node.Data.Sector)*int64(Sector), int64(fe.Entry.Size()))
+		n, err := io.Copy(io.NewOffsetWriter(stage, pos), src)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", fe.Path(), err)
+		}
+		pos += n
+	}
+
+	for i, fe := range moves {
+		size := fe.Entry.Size()
+		padded := int64(SectorsNeeded(uint64(size))) * int64(Sector)
+		src := io.MultiReader(io.NewSectionReader(stage, stageOff[i], int64(size)), io.LimitReader(zeroReader{}, padded-int64(size)))
+		if _, err := io.Copy(io.NewOffsetWriter(f, int64(targets[i])*int64(Sector)), src); err != nil {
+			return fmt.Errorf("write %s: %w", fe.Path(), err)
+		}
+		old := fe.Entry.Node.Data.Sector
+		if err := writeRegion(f, fe.Entry, Region{Sector: targets[i], Size: size}); err != nil {
+			return err
+		}
+		logf("  [MOVED] %s LBA %d -> %d\n", fe.Path(), old, targets[i])
+	}
+
+	logf("[+] Relocated %d files\n", len(moves))
+	return nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -15,6 +15,8 @@ type Writer struct {
 type fileAlloc struct {
 	sector uint32
 	size   uint32
+	pinned bool   // sector taken from the reference layout
+	reason string // why a file in the layout was not pinned
 }
 
 type dirEntry struct {
@@ -31,12 +33,25 @@ type dirInfo struct {
 }
 
 func Repack(srcDir, isoPath string) error {
+	_, err := repack(srcDir, isoPath, nil)
+	return err
+}
+
+// RepackWithLayout rebuilds an ISO like Repack, but files found in layout keep
+// their original LBA as long as they still fit in their old sectors. Grown and
+// new files, and all directory tables, go into the remaining free space. The
+// returned moves list every file that did not keep its reference LBA.
+func RepackWithLayout(srcDir, isoPath string, layout Layout) ([]Move, error) {
+	return repack(srcDir, isoPath, layout)
+}
+
+func repack(srcDir, isoPath string, layout Layout) ([]Move, error) {
 	dirs, err := scanDir(srcDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if len(dirs) == 0 {
-		return fmt.Errorf("empty source directory")
+		return nil, fmt.Errorf("empty source directory")
 	}
 
 	// bottom-up: compute each tree's serialized size
@@ -46,7 +61,7 @@ func Repack(srcDir, isoPath string) error {
 
 	f, err := os.Create(isoPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer f.Close()
 
@@ -55,22 +70,47 @@ func Repack(srcDir, isoPath string) error {
 		out:   f,
 	}
 
+	fileSectors := make([][]fileAlloc, len(dirs))
+	for i, d := range dirs {
+		fileSectors[i] = make([]fileAlloc, len(d.Entries))
+		for j, e := range d.Entries {
+			fileSectors[i][j].size = e.Size
+		}
+	}
+
+	var alloc interface{ Alloc(bytes uint64) uint32 } = &w.alloc
+	if layout != nil {
+		ga := newGapAllocator()
+		pinLayout(srcDir, dirs, fileSectors, layout, ga)
+		alloc = ga
+	}
 
 	dirSectors := make([]uint32, len(dirs))
 	for i, d := range dirs {
-		dirSectors[i] = w.alloc.Alloc(uint64(d.TreeSize))
+		dirSectors[i] = alloc.Alloc(uint64(d.TreeSize))
 	}
 
-	fileSectors := make([][]fileAlloc, len(dirs))
+	var moves []Move
 	for i, d := range dirs {
-		fileSectors[i] = make([]fileAlloc, len(d.Entries))
 		for j, e := range d.Entries {
-			if !e.IsDir {
-				fileSectors[i][j].size = e.Size
-				if e.Size > 0 {
-					fileSectors[i][j].sector = w.alloc.Alloc(uint64(e.Size))
+			fa := &fileSectors[i][j]
+			if e.IsDir || e.Size == 0 || fa.pinned {
+				continue
+			}
+			fa.sector = alloc.Alloc(uint64(e.Size))
+			if layout == nil {
+				continue
+			}
+			key := layoutKey(repackPath(srcDir, d.Path, e.Name))
+			mv := Move{Path: key, NewLBA: fa.sector, Reason: "new"}
+			if ref, ok := layout[key]; ok {
+				if ref.Sector == fa.sector {
+					continue
 				}
+				mv.OldLBA = ref.Sector
+				mv.Reason = fa.reason
 			}
+			moves = append(moves, mv)
 		}
 	}
 
@@ -78,14 +118,14 @@ func Repack(srcDir, isoPath string) error {
 	for i, d := range dirs {
 		tableBytes, err := serializeDirTable(d, dirs, dirSectors, fileSectors[i])
 		if err != nil {
-			return fmt.Errorf("serialize dir %q: %w", d.Path, err)
+			return nil, fmt.Errorf("serialize dir %q: %w", d.Path, err)
 		}
 		off := int64(dirSectors[i]) * int64(Sector)
 		if _, err := w.out.Seek(off, io.SeekStart); err != nil {
-			return err
+			return nil, err
 		}
 		if _, err := w.out.Write(tableBytes); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -97,7 +137,7 @@ func Repack(srcDir, isoPath string) error {
 			fs := fileSectors[i][j]
 			off := int64(fs.sector) * int64(Sector)
 			if err := copyFileInto(w.out, filepath.Join(d.Path, e.Name), off, e.Size); err != nil {
-				return fmt.Errorf("write file %q: %w", e.Name, err)
+				return nil, fmt.Errorf("write file %q: %w", e.Name, err)
 			}
 		}
 	}
@@ -109,15 +149,15 @@ func Repack(srcDir, isoPath string) error {
 	volBuf := vol.Bytes()
 
 	if _, err := w.out.Seek(int64(VolSector)*int64(Sector), io.SeekStart); err != nil {
-		return err
+		return nil, err
 	}
 	if _, err := w.out.Write(volBuf); err != nil {
-		return err
+		return nil, err
 	}
 
 	endOff, err := w.out.Seek(0, io.SeekEnd)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	aligned := ((endOff + int64(32*Sector) - 1) / int64(32*Sector)) * int64(32*Sector)
 	if aligned > endOff {
@@ -125,7 +165,43 @@ func Repack(srcDir, isoPath string) error {
 		w.out.Write(padding)
 	}
 
-	return nil
+	return moves, nil
+}
+
+// pinLayout reserves the reference LBA of every file that still fits in its
+// old sectors and records why the others have to move.
+func pinLayout(srcDir string, dirs []dirInfo, fileSectors [][]fileAlloc, layout Layout, ga *gapAllocator) {
+	for i, d := range dirs {
+		for j, e := range d.Entries {
+			if e.IsDir || e.Size == 0 {
+				continue
+			}
+			ref, ok := layout[layoutKey(repackPath(srcDir, d.Path, e.Name))]
+			if !ok {
+				continue
+			}
+			fa := &fileSectors[i][j]
+			if ref.Size == 0 || SectorsNeeded(uint64(e.Size)) > SectorsNeeded(uint64(ref.Size)) {
+				fa.reason = "grown"
+				continue
+			}
+			if ref.Sector <= VolSector || !ga.reserve(extent{Start: ref.Sector, Count: SectorsNeeded(uint64(ref.Size))}) {
+				fa.reason = "overlap"
+				continue
+			}
+			fa.sector = ref.Sector
+			fa.pinned = true
+		}
+	}
+}
+
+// repackPath returns the ISO path of a file found while scanning srcDir.
+func repackPath(srcDir, dir, name string) string {
+	rel, err := filepath.Rel(srcDir, dir)
+	if err != nil || rel == "." {
+		rel = ""
+	}
+	return filepath.ToSlash(filepath.Join(rel, name))
 }
 
 func scanDir(srcDir string) ([]dirInfo, error) {
@@ -334,6 +410,11 @@ func serializeDirTable(di dirInfo, dirs []dirInfo, dirSectors []uint32, fAlloc [
 	return buf, nil
 }
 
+// copyFileAt is copyFileInto for destinations that are addressed by offset.
+func copyFileAt(w io.WriterAt, path string, off int64, size uint32) error {
+	return copyFileInto(io.NewOffsetWriter(w, 0), path, off, size)
+}
+
 func copyFileInto(w io.WriteSeeker, path string, off int64, size uint32) error {
 	f, err := os.Open(path)
 	if err != nil {
@@ -0,0 +1,3 @@
+module palquant
+
+go 1.22.2
@@ -0,0 +1,103 @@
+package palquant
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OffPalette describes the pixels KeepPalette could not match exactly.
+type OffPalette struct {
+	Pixels, Total int
+	// Heatmap is the image dimmed to grey with every off-palette pixel drawn
+	// from yellow (just off) to red (furthest off). Nil when nothing is off.
+	Heatmap *image.NRGBA
+}
+
+func (o OffPalette) String() string {
+	pct := 0.0
+	if o.Total > 0 {
+		pct = float64(o.Pixels) * 100 / float64(o.Total)
+	}
+	return fmt.Sprintf("%d of %d pixels off-palette (%.2f%%)", o.Pixels, o.Total, pct)
+}
+
+// HeatmapPath is where the injectors write the heatmap for output file out.
+func HeatmapPath(out string) string {
+	return strings.TrimSuffix(out, filepath.Ext(out)) + "_offpal.png"
+}
+
+// WriteHeatmap saves the heatmap as a PNG. It does nothing when no pixel
+// was off-palette.
+func (o OffPalette) WriteHeatmap(path string) error {
+	if o.Heatmap == nil {
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, o.Heatmap)
+}
+
+// KeepPalette maps img onto pal and leaves pal as it is, for textures whose
+// CLUT is shared with others. Pixels whose colour is in pal (any transparent
+// pixel matches a transparent entry) keep it; the rest take the nearest entry
+// by the alpha-weighted distance the quantiser uses and are counted.
+func KeepPalette(img image.Image, pal color.Palette) (*image.Paletted, OffPalette) {
+	out := Remap(img, pal, DitherNone)
+	m := newMapper(pal)
+	exact := map[uint32]bool{}
+	for _, c := range m.colors {
+		exact[key(c)] = true
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	report := OffPalette{Total: w * h}
+	dists := make([]float64, w*h) // -1 where the colour is in pal
+	maxDist := 0.0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := nrgbaAt(img, b.Min.X+x, b.Min.Y+y)
+			if exact[key(c)] {
+				dists[y*w+x] = -1
+				continue
+			}
+			d := math.Sqrt(dist(toVec(c), m.vs[out.Pix[y*out.Stride+x]]))
+			dists[y*w+x] = d
+			maxDist = math.Max(maxDist, d)
+			report.Pixels++
+		}
+	}
+	if report.Pixels == 0 {
+		return out, report
+	}
+
+	heat := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*heat.Stride + x*4
+			if d := dists[y*w+x]; d >= 0 {
+				t := 1.0
+				if maxDist > 0 {
+					t = d / maxDist
+				}
+				copy(heat.Pix[i:], []uint8{255, uint8(255 * (1 - t)), 0, 255})
+				continue
+			}
+			c := nrgbaAt(img, b.Min.X+x, b.Min.Y+y)
+			lum := (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000 * int(c.A) / 255
+			v := uint8(32 + lum/3)
+			copy(heat.Pix[i:], []uint8{v, v, v, 255})
+		}
+	}
+	report.Heatmap = heat
+	return out, report
+}
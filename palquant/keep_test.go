@@ -0,0 +1,65 @@
+package palquant
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+var keepPal = color.Palette{
+	color.NRGBA{0, 0, 0, 0},
+	color.NRGBA{255, 0, 0, 255},
+	color.NRGBA{0, 255, 0, 255},
+	color.NRGBA{0, 0, 255, 255},
+}
+
+func TestKeepPaletteExact(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		img.SetNRGBA(x, 0, keepPal[x].(color.NRGBA))
+		img.SetNRGBA(x, 1, keepPal[3-x].(color.NRGBA))
+	}
+	img.SetNRGBA(0, 0, color.NRGBA{12, 34, 56, 0}) // any transparent pixel matches entry 0
+
+	out, report := KeepPalette(img, keepPal)
+	if report.Pixels != 0 || report.Total != 8 {
+		t.Errorf("report %v, want 0 of 8", report)
+	}
+	if report.Heatmap != nil {
+		t.Error("Heatmap is set with no off-palette pixels")
+	}
+	for x := 0; x < 4; x++ {
+		if got := out.ColorIndexAt(x, 0); got != uint8(x) {
+			t.Errorf("(%d,0) index %d, want %d", x, got, x)
+		}
+		if got := out.ColorIndexAt(x, 1); got != uint8(3-x) {
+			t.Errorf("(%d,1) index %d, want %d", x, got, 3-x)
+		}
+	}
+}
+
+func TestKeepPaletteOff(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	img.SetNRGBA(1, 0, color.NRGBA{250, 10, 0, 255})
+	img.SetNRGBA(2, 0, color.NRGBA{0, 0, 200, 255})
+
+	out, report := KeepPalette(img, keepPal)
+	if report.Pixels != 2 || report.Total != 3 {
+		t.Errorf("report %v, want 2 of 3", report)
+	}
+	if report.Heatmap == nil || report.Heatmap.Bounds() != img.Bounds() {
+		t.Fatal("no heatmap of the image size")
+	}
+	for x, want := range []uint8{1, 1, 3} {
+		if got := out.ColorIndexAt(x, 0); got != want {
+			t.Errorf("(%d,0) index %d, want %d", x, got, want)
+		}
+	}
+	if c := report.Heatmap.NRGBAAt(0, 0); c.R != c.G || c.G != c.B {
+		t.Errorf("in-palette pixel is %v in the heatmap, want grey", c)
+	}
+	if c := report.Heatmap.NRGBAAt(2, 0); c.R != 255 || c.B != 0 {
+		t.Errorf("off-palette pixel is %v in the heatmap, want yellow to red", c)
+	}
+}
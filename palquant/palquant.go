@@ -0,0 +1,490 @@
+// Package palquant reduces RGBA images to an indexed palette of up to 256
+// colours in process, replacing the pngquant.exe the texture importers used to
+// shell out to.
+//
+// The palette is built by median cut and refined with k-means. Images with
+// more than a few thousand colours are bucketed first so both stay fast, and
+// images that already fit in the palette keep their exact colours. Colours are
+// compared premultiplied by alpha and weighted towards green, so transparent
+// pixels collapse together and the error lands where the eye notices it least.
+// Fully transparent pixels always get an exact {0,0,0,0} entry, placed first.
+// The same image and options always give the same palette and indices.
+package palquant
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sort"
+	"strings"
+)
+
+type Dither int
+
+const (
+	DitherNone Dither = iota
+	DitherFloydSteinberg
+	DitherOrdered
+)
+
+func (d Dither) String() string {
+	switch d {
+	case DitherFloydSteinberg:
+		return "fs"
+	case DitherOrdered:
+		return "ordered"
+	}
+	return "none"
+}
+
+// ParseDither accepts the names used by the -dither flags: none, fs
+// (Floyd–Steinberg) and ordered (4x4 Bayer).
+func ParseDither(s string) (Dither, error) {
+	switch strings.ToLower(s) {
+	case "", "none", "off":
+		return DitherNone, nil
+	case "fs", "floyd", "floyd-steinberg":
+		return DitherFloydSteinberg, nil
+	case "ordered", "bayer":
+		return DitherOrdered, nil
+	}
+	return DitherNone, fmt.Errorf("unknown dither mode %q (none, fs, ordered)", s)
+}
+
+type Options struct {
+	Colors int // 2-256, usually 16 or 256
+	Dither Dither
+}
+
+// Channel weights applied to the premultiplied difference before squaring:
+// roughly the square roots of the Rec.601 luma weights, alpha at full weight.
+const (
+	weightR = 0.55
+	weightG = 0.75
+	weightB = 0.35
+	weightA = 1.0
+)
+
+const kmeansRounds = 8
+
+type vec [4]float64
+
+func toVec(c color.NRGBA) vec {
+	a := float64(c.A) / 255
+	return vec{
+		float64(c.R) * a * weightR,
+		float64(c.G) * a * weightG,
+		float64(c.B) * a * weightB,
+		float64(c.A) * weightA,
+	}
+}
+
+func dist(a, b vec) float64 {
+	d0, d1, d2, d3 := a[0]-b[0], a[1]-b[1], a[2]-b[2], a[3]-b[3]
+	return d0*d0 + d1*d1 + d2*d2 + d3*d3
+}
+
+type histEntry struct {
+	c color.NRGBA
+	v vec
+	n int
+}
+
+func key(c color.NRGBA) uint32 {
+	if c.A == 0 {
+		return 0
+	}
+	return uint32(c.R) | uint32(c.G)<<8 | uint32(c.B)<<16 | uint32(c.A)<<24
+}
+
+func unkey(k uint32) color.NRGBA {
+	return color.NRGBA{uint8(k), uint8(k >> 8), uint8(k >> 16), uint8(k >> 24)}
+}
+
+func nrgbaAt(img image.Image, x, y int) color.NRGBA {
+	c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+	if c.A == 0 {
+		return color.NRGBA{}
+	}
+	return c
+}
+
+// histogram returns every distinct colour with its pixel count, sorted by
+// key so map order never leaks into the result.
+func histogram(img image.Image) []histEntry {
+	counts := map[uint32]int{}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			counts[key(nrgbaAt(img, x, y))]++
+		}
+	}
+	keys := make([]uint32, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	hist := make([]histEntry, len(keys))
+	for i, k := range keys {
+		c := unkey(k)
+		hist[i] = histEntry{c: c, v: toVec(c), n: counts[k]}
+	}
+	return hist
+}
+
+// maxBuckets bounds the colours median cut and k-means work on. Beyond it
+// the histogram is bucketed, dropping low bits per channel until it fits.
+const maxBuckets = 4096
+
+// bucket merges colours that agree in the top bits of every channel into
+// their alpha-weighted average. Fully transparent stays its own entry at the
+// front. hist must be sorted, which keeps the float sums in a fixed order.
+func bucket(hist []histEntry) []histEntry {
+	for bits := uint(6); bits >= 2; bits-- {
+		shift := 8 - bits
+		groups := map[uint32][]histEntry{}
+		for _, e := range hist {
+			k := uint32(0)
+			if e.c.A != 0 {
+				k = 1<<31 | uint32(e.c.R>>shift) | uint32(e.c.G>>shift)<<8 |
+					uint32(e.c.B>>shift)<<16 | uint32(e.c.A>>shift)<<24
+			}
+			groups[k] = append(groups[k], e)
+		}
+		if len(groups) > maxBuckets && bits > 2 {
+			continue
+		}
+		keys := make([]uint32, 0, len(groups))
+		for k := range groups {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		out := make([]histEntry, len(keys))
+		for i, k := range keys {
+			g := groups[k]
+			n := 0
+			for _, e := range g {
+				n += e.n
+			}
+			c := average(g)
+			out[i] = histEntry{c: c, v: toVec(c), n: n}
+		}
+		return out
+	}
+	return hist
+}
+
+// Palette builds a palette of at most n colours for img.
+func Palette(img image.Image, n int) (color.Palette, error) {
+	if n < 2 || n > 256 {
+		return nil, fmt.Errorf("palette size %d out of range (2-256)", n)
+	}
+	hist := histogram(img)
+
+	var pal color.Palette
+	if len(hist) > 0 && hist[0].c.A == 0 {
+		pal = append(pal, color.NRGBA{})
+		hist = hist[1:]
+		n--
+	}
+	if len(hist) <= n {
+		for _, e := range hist {
+			pal = append(pal, e.c)
+		}
+		return pal, nil
+	}
+
+	if len(hist) > maxBuckets {
+		hist = bucket(hist)
+	}
+	centres := kmeans(hist, medianCut(hist, n))
+	for _, c := range centres {
+		pal = append(pal, c)
+	}
+	return pal, nil
+}
+
+type box struct {
+	entries []histEntry
+	sse     float64
+}
+
+func newBox(entries []histEntry) box {
+	m := mean(entries)
+	var sse float64
+	for _, e := range entries {
+		sse += float64(e.n) * dist(e.v, m)
+	}
+	return box{entries, sse}
+}
+
+func mean(entries []histEntry) vec {
+	var m vec
+	total := 0
+	for _, e := range entries {
+		for i := range m {
+			m[i] += e.v[i] * float64(e.n)
+		}
+		total += e.n
+	}
+	for i := range m {
+		m[i] /= float64(total)
+	}
+	return m
+}
+
+// medianCut splits the box with the largest squared error along its widest
+// weighted axis at the pixel median until there are n boxes, and returns
+// their premultiplied means.
+func medianCut(hist []histEntry, n int) []color.NRGBA {
+	boxes := []box{newBox(append([]histEntry(nil), hist...))}
+	for len(boxes) < n {
+		pick := -1
+		for i, b := range boxes {
+			if len(b.entries) > 1 && (pick < 0 || b.sse > boxes[pick].sse) {
+				pick = i
+			}
+		}
+		if pick < 0 {
+			break
+		}
+		b := boxes[pick]
+
+		axis, widest := 0, -1.0
+		for a := 0; a < 4; a++ {
+			lo, hi := math.Inf(1), math.Inf(-1)
+			for _, e := range b.entries {
+				lo, hi = math.Min(lo, e.v[a]), math.Max(hi, e.v[a])
+			}
+			if hi-lo > widest {
+				axis, widest = a, hi-lo
+			}
+		}
+		sort.SliceStable(b.entries, func(i, j int) bool { return b.entries[i].v[axis] < b.entries[j].v[axis] })
+
+		total := 0
+		for _, e := range b.entries {
+			total += e.n
+		}
+		split, acc := 1, 0
+		for i, e := range b.entries[:len(b.entries)-1] {
+			acc += e.n
+			if acc*2 >= total {
+				split = i + 1
+				break
+			}
+		}
+		boxes[pick] = newBox(b.entries[:split])
+		boxes = append(boxes, newBox(b.entries[split:]))
+	}
+
+	out := make([]color.NRGBA, len(boxes))
+	for i, b := range boxes {
+		out[i] = average(b.entries)
+	}
+	return out
+}
+
+// average is the alpha-weighted mean colour, so faint pixels do not drag the
+// colour of a mostly opaque cluster.
+func average(entries []histEntry) color.NRGBA {
+	var r, g, b, a, n float64
+	for _, e := range entries {
+		w := float64(e.n) * float64(e.c.A)
+		r += w * float64(e.c.R)
+		g += w * float64(e.c.G)
+		b += w * float64(e.c.B)
+		a += float64(e.n) * float64(e.c.A)
+		n += float64(e.n)
+	}
+	if a == 0 {
+		return color.NRGBA{}
+	}
+	round := func(v float64) uint8 { return uint8(math.Min(255, math.Round(v))) }
+	return color.NRGBA{round(r / a), round(g / a), round(b / a), round(a / n)}
+}
+
+// kmeans moves every centre to the average of the colours nearest to it for
+// a few rounds, or until nothing changes. Empty clusters keep their centre.
+func kmeans(hist []histEntry, centres []color.NRGBA) []color.NRGBA {
+	assign := make([]int, len(hist))
+	for round := 0; round < kmeansRounds; round++ {
+		vs := make([]vec, len(centres))
+		for i, c := range centres {
+			vs[i] = toVec(c)
+		}
+		changed := false
+		for i, e := range hist {
+			best := nearestVec(vs, e.v)
+			if round == 0 || best != assign[i] {
+				changed = true
+			}
+			assign[i] = best
+		}
+		if !changed {
+			break
+		}
+		clusters := make([][]histEntry, len(centres))
+		for i, e := range hist {
+			clusters[assign[i]] = append(clusters[assign[i]], e)
+		}
+		for i, cl := range clusters {
+			if len(cl) > 0 {
+				centres[i] = average(cl)
+			}
+		}
+	}
+	return centres
+}
+
+func nearestVec(pal []vec, v vec) int {
+	best, bestD := 0, math.Inf(1)
+	for i, p := range pal {
+		if d := dist(v, p); d < bestD {
+			best, bestD = i, d
+		}
+	}
+	return best
+}
+
+// Quantize builds a palette for img and maps it onto that palette.
+func Quantize(img image.Image, opt Options) (*image.Paletted, error) {
+	pal, err := Palette(img, opt.Colors)
+	if err != nil {
+		return nil, err
+	}
+	return Remap(img, pal, opt.Dither), nil
+}
+
+// QuantizePNG is Quantize for encoded PNG data, in and out, the way the tools
+// used to pipe it through pngquant.
+func QuantizePNG(rawPng []byte, opt Options) ([]byte, error) {
+	img, err := png.Decode(bytes.NewReader(rawPng))
+	if err != nil {
+		return nil, err
+	}
+	out, err := Quantize(img, opt)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Remap maps img onto an existing palette with the same colour distance the
+// quantiser uses. Transparent pixels neither take nor spread dither error.
+func Remap(img image.Image, pal color.Palette, d Dither) *image.Paletted {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	out := image.NewPaletted(image.Rect(0, 0, w, h), pal)
+	m := newMapper(pal)
+
+	switch d {
+	case DitherFloydSteinberg:
+		cur := make([][4]float64, w+2)
+		next := make([][4]float64, w+2)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				src := nrgbaAt(img, b.Min.X+x, b.Min.Y+y)
+				if src.A == 0 {
+					out.Pix[y*out.Stride+x] = m.index(src)
+					continue
+				}
+				e := cur[x+1]
+				want := color.NRGBA{clamp(float64(src.R) + e[0]), clamp(float64(src.G) + e[1]),
+					clamp(float64(src.B) + e[2]), clamp(float64(src.A) + e[3])}
+				if want.A == 0 {
+					want.A = 1
+				}
+				idx := m.index(want)
+				out.Pix[y*out.Stride+x] = idx
+				got := m.colors[idx]
+				diff := [4]float64{
+					float64(want.R) - float64(got.R), float64(want.G) - float64(got.G),
+					float64(want.B) - float64(got.B), float64(want.A) - float64(got.A),
+				}
+				for i := range diff {
+					cur[x+2][i] += diff[i] * 7 / 16
+					next[x][i] += diff[i] * 3 / 16
+					next[x+1][i] += diff[i] * 5 / 16
+					next[x+2][i] += diff[i] * 1 / 16
+				}
+			}
+			cur, next = next, cur
+			for i := range next {
+				next[i] = [4]float64{}
+			}
+		}
+	case DitherOrdered:
+		spread := 128 / math.Cbrt(float64(len(pal)))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				src := nrgbaAt(img, b.Min.X+x, b.Min.Y+y)
+				if src.A != 0 {
+					t := ((float64(bayer4[y&3][x&3])+0.5)/16 - 0.5) * spread
+					src.R, src.G, src.B = clamp(float64(src.R)+t), clamp(float64(src.G)+t), clamp(float64(src.B)+t)
+				}
+				out.Pix[y*out.Stride+x] = m.index(src)
+			}
+		}
+	default:
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				out.Pix[y*out.Stride+x] = m.index(nrgbaAt(img, b.Min.X+x, b.Min.Y+y))
+			}
+		}
+	}
+	return out
+}
+
+var bayer4 = [4][4]int{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+func clamp(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(math.Round(v))
+}
+
+// mapper finds the nearest palette entry, caching by colour. On ties the
+// lowest index wins.
+type mapper struct {
+	colors []color.NRGBA
+	vs     []vec
+	cache  map[uint32]uint8
+}
+
+func newMapper(pal color.Palette) *mapper {
+	m := &mapper{cache: map[uint32]uint8{}}
+	for _, c := range pal {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		m.colors = append(m.colors, n)
+		m.vs = append(m.vs, toVec(n))
+	}
+	return m
+}
+
+func (m *mapper) index(c color.NRGBA) uint8 {
+	k := key(c)
+	if idx, ok := m.cache[k]; ok {
+		return idx
+	}
+	idx := uint8(nearestVec(m.vs, toVec(c)))
+	m.cache[k] = idx
+	return idx
+}
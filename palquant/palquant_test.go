@@ -0,0 +1,146 @@
+package palquant
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// testImage is a gradient with a transparent corner and some hard edges, so
+// every dither mode has error to spread.
+func testImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 48, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 48; x++ {
+			c := color.NRGBA{uint8(x * 5), uint8(y * 6), uint8((x ^ y) * 4), 255}
+			if x < 8 && y < 8 {
+				c.A = uint8(x * 32)
+			}
+			if (x/12+y/10)%3 == 0 {
+				c.R = 255 - c.R
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestQuantizeDeterministic(t *testing.T) {
+	img := testImage()
+	for _, n := range []int{16, 256} {
+		for _, d := range []Dither{DitherNone, DitherFloydSteinberg, DitherOrdered} {
+			a, err := Quantize(img, Options{Colors: n, Dither: d})
+			if err != nil {
+				t.Fatalf("%d colours, %s: %v", n, d, err)
+			}
+			b, err := Quantize(img, Options{Colors: n, Dither: d})
+			if err != nil {
+				t.Fatalf("%d colours, %s: %v", n, d, err)
+			}
+			if len(a.Palette) > n {
+				t.Errorf("%d colours, %s: palette has %d entries", n, d, len(a.Palette))
+			}
+			if len(a.Palette) != len(b.Palette) {
+				t.Fatalf("%d colours, %s: palette sizes %d and %d", n, d, len(a.Palette), len(b.Palette))
+			}
+			for i := range a.Palette {
+				if a.Palette[i] != b.Palette[i] {
+					t.Errorf("%d colours, %s: palette[%d] %v and %v", n, d, i, a.Palette[i], b.Palette[i])
+				}
+			}
+			if !bytes.Equal(a.Pix, b.Pix) {
+				t.Errorf("%d colours, %s: indices differ between runs", n, d)
+			}
+			for i, v := range a.Pix {
+				if int(v) >= len(a.Palette) {
+					t.Fatalf("%d colours, %s: pixel %d index %d outside the %d entry palette", n, d, i, v, len(a.Palette))
+				}
+			}
+		}
+	}
+}
+
+// noiseImage has more distinct colours than maxBuckets, so the histogram
+// gets bucketed. The noise is a fixed LCG to keep it identical everywhere.
+func noiseImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 128, 128))
+	seed := uint32(1)
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			seed = seed*1664525 + 1013904223
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x*2) + uint8(seed>>24)&31, uint8(y*2) + uint8(seed>>16)&31, uint8(seed >> 8), 255})
+		}
+	}
+	return img
+}
+
+func checksum(p *image.Paletted) string {
+	h := sha256.New()
+	for _, c := range p.Palette {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		h.Write([]byte{n.R, n.G, n.B, n.A})
+	}
+	h.Write(p.Pix)
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// TestQuantizeGolden pins palette and indices, so any change to the
+// quantiser's output shows up here rather than in a game's textures.
+func TestQuantizeGolden(t *testing.T) {
+	cases := []struct {
+		name string
+		img  image.Image
+		opt  Options
+		want string
+	}{
+		{"gradient/16/none", testImage(), Options{16, DitherNone}, "8bda96c2d88057a5"},
+		{"gradient/256/fs", testImage(), Options{256, DitherFloydSteinberg}, "e4bb97f7aa3a70c0"},
+		{"noise/16/ordered", noiseImage(), Options{16, DitherOrdered}, "1c1aa363b3684c30"},
+		{"noise/256/fs", noiseImage(), Options{256, DitherFloydSteinberg}, "d11b2fd28165f041"},
+	}
+	for _, c := range cases {
+		out, err := Quantize(c.img, c.opt)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got := checksum(out); got != c.want {
+			t.Errorf("%s: checksum %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestQuantizeKeepsFewColours(t *testing.T) {
+	want := []color.NRGBA{
+		{0, 0, 0, 0},
+		{255, 0, 0, 255},
+		{1, 2, 3, 255},
+		{1, 2, 4, 255},
+		{200, 100, 50, 128},
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			img.SetNRGBA(x, y, want[(x+y*3)%len(want)])
+		}
+	}
+	for _, n := range []int{len(want), 16, 256} {
+		out, err := Quantize(img, Options{Colors: n, Dither: DitherFloydSteinberg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out.Palette) != len(want) {
+			t.Fatalf("%d colours: palette has %d entries, want %d", n, len(out.Palette), len(want))
+		}
+		for y := 0; y < 10; y++ {
+			for x := 0; x < 10; x++ {
+				got := color.NRGBAModel.Convert(out.At(x, y)).(color.NRGBA)
+				if w := want[(x+y*3)%len(want)]; got != w {
+					t.Fatalf("%d colours: pixel %d,%d is %v, want %v", n, x, y, got, w)
+				}
+			}
+		}
+	}
+}